@@ -0,0 +1,79 @@
+package graphx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// AggregationOp identifies how an Aggregation combines the series of a chart metric
+type AggregationOp string
+
+const (
+	// AggregateTopK keeps the K series ranking highest
+	AggregateTopK AggregationOp = "top_k"
+	// AggregateBottomK keeps the K series ranking lowest
+	AggregateBottomK AggregationOp = "bottom_k"
+	// AggregateSum, AggregateAvg, AggregateMin and AggregateMax combine every series into a
+	// single series named after the op
+	AggregateSum AggregationOp = "sum"
+	AggregateAvg AggregationOp = "avg"
+	AggregateMin AggregationOp = "min"
+	AggregateMax AggregationOp = "max"
+	// AggregateQuantile combines every series into a single series of their Quantile
+	AggregateQuantile AggregationOp = "quantile"
+)
+
+// AggregationRank is what AggregateTopK and AggregateBottomK rank series by
+type AggregationRank string
+
+const (
+	// RankLatest ranks series by their latest value. this is the default
+	RankLatest AggregationRank = "latest"
+	// RankAvg ranks series by the average of their values
+	RankAvg AggregationRank = "avg"
+)
+
+// Aggregation combines the series of each of a chart's metrics after they were filtered by
+// name and transformed. it is computed by graphx the same way for every datasource.
+type Aggregation struct {
+	Op AggregationOp `json:"op"`
+	// the number of series AggregateTopK and AggregateBottomK keep
+	K int `json:"k,omitempty"`
+	// what AggregateTopK and AggregateBottomK rank series by. defaults to RankLatest
+	By AggregationRank `json:"by,omitempty"`
+	// when set the series AggregateTopK and AggregateBottomK do not keep are summed into
+	// a single series with this name
+	Other string `json:"other,omitempty"`
+	// the quantile between 0 and 1 AggregateQuantile computes
+	Quantile float64 `json:"quantile,omitempty"`
+}
+
+// Validate reports whether the aggregation's parameters suit its op.
+func (a Aggregation) Validate() error {
+	switch a.Op {
+	case AggregateTopK, AggregateBottomK:
+		if a.K < 1 {
+			return fmt.Errorf("%s requires a k of at least 1", a.Op)
+		}
+		switch a.By {
+		case "", RankLatest, RankAvg:
+		default:
+			return fmt.Errorf("unknown rank %q", a.By)
+		}
+	case AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+	case AggregateQuantile:
+		if math.IsNaN(a.Quantile) || a.Quantile < 0 || a.Quantile > 1 {
+			return errors.New("quantile requires a quantile between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("unknown aggregation %q", a.Op)
+	}
+	return nil
+}
+
+// Combines reports whether the aggregation combines every series into a single series
+// rather than selecting series.
+func (a Aggregation) Combines() bool {
+	return a.Op != AggregateTopK && a.Op != AggregateBottomK
+}
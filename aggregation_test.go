@@ -0,0 +1,53 @@
+package graphx
+
+import (
+	"math"
+	"testing"
+)
+
+var AggregationValidateTT = []struct {
+	name        string
+	aggregation Aggregation
+	valid       bool
+}{
+	{
+		name:        "top k",
+		aggregation: Aggregation{Op: AggregateTopK, K: 3, By: RankAvg},
+		valid:       true,
+	},
+	{
+		name:        "top k without k",
+		aggregation: Aggregation{Op: AggregateTopK},
+	},
+	{
+		name:        "quantile",
+		aggregation: Aggregation{Op: AggregateQuantile, Quantile: 0.9},
+		valid:       true,
+	},
+	{
+		name:        "quantile out of range",
+		aggregation: Aggregation{Op: AggregateQuantile, Quantile: 1.5},
+	},
+	{
+		name:        "quantile NaN",
+		aggregation: Aggregation{Op: AggregateQuantile, Quantile: math.NaN()},
+	},
+	{
+		name:        "unknown op",
+		aggregation: Aggregation{Op: "median"},
+	},
+}
+
+func TestAggregationValidate(t *testing.T) {
+	for _, tt := range AggregationValidateTT {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.aggregation.Validate()
+			if tt.valid && err != nil {
+				t.Fatalf("expected aggregation to be valid got: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("expected aggregation to be invalid")
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package graphx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// AlertCondition is what an AlertRule watches a chart metric for
+type AlertCondition string
+
+const (
+	// AlertAbove holds while a series' value is above the threshold
+	AlertAbove AlertCondition = "above"
+	// AlertBelow holds while a series' value is below the threshold
+	AlertBelow AlertCondition = "below"
+	// AlertAbsent holds while the chart metric's query returns no series
+	AlertAbsent AlertCondition = "absent"
+)
+
+// AlertRule is a threshold watched on every series of a chart metric.
+type AlertRule struct {
+	// identifies the rule within its chart metric
+	Name      string         `json:"name"`
+	Condition AlertCondition `json:"condition"`
+	Threshold float64        `json:"threshold,omitempty"`
+	// how long the condition must hold before the alert fires. zero fires on the first evaluation
+	For Duration `json:"for,omitempty"`
+	// how far a firing series' value must cross back past the threshold before the alert
+	// resolves, keeping a value hovering around the threshold from flapping
+	Hysteresis float64 `json:"hysteresis,omitempty"`
+	// copied to every alert of the rule, for example a severity or the team to notify
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Validate reports whether the rule can be evaluated.
+func (r AlertRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("alert rule requires a name")
+	}
+	switch r.Condition {
+	case AlertAbove, AlertBelow, AlertAbsent:
+	default:
+		return fmt.Errorf("alert rule %s has unknown condition %q", r.Name, r.Condition)
+	}
+	if r.For < 0 {
+		return fmt.Errorf("alert rule %s has a negative for", r.Name)
+	}
+	if r.Hysteresis < 0 {
+		return fmt.Errorf("alert rule %s has a negative hysteresis", r.Name)
+	}
+	return nil
+}
+
+// AlertState is the state of an alert
+type AlertState string
+
+const (
+	// AlertPending is an alert whose condition holds but not yet for the rule's For
+	AlertPending AlertState = "pending"
+	// AlertFiring is an alert whose condition held for the rule's For
+	AlertFiring AlertState = "firing"
+	// AlertResolved is a fired alert whose condition no longer holds
+	AlertResolved AlertState = "resolved"
+)
+
+// Alert is the state of an alert rule for a single series. alerts of AlertAbsent rules
+// concern the chart metric as a whole and have no series name.
+type Alert struct {
+	Rule   string `json:"rule"`
+	Chart  string `json:"chart"`
+	Metric string `json:"metric"`
+	// the name of the series
+	Name      string            `json:"name,omitempty"`
+	State     AlertState        `json:"state"`
+	Condition AlertCondition    `json:"condition"`
+	Threshold float64           `json:"threshold"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// the latest value of the series
+	Value string `json:"value,omitempty"`
+	// the Unix timestamps the condition started holding at, the alert fired at and resolved at
+	ActiveAt   int64 `json:"active_at,omitempty"`
+	FiredAt    int64 `json:"fired_at,omitempty"`
+	ResolvedAt int64 `json:"resolved_at,omitempty"`
+}
+
+// Alert is returned by a Streamer's Recv when an alert of one of its charts fires or resolves.
+func (a *Alert) Error() string {
+	if a.Name == "" {
+		return fmt.Sprintf("alert %s of %s is %s", a.Rule, a.Metric, a.State)
+	}
+	return fmt.Sprintf("alert %s of %s %s is %s", a.Rule, a.Metric, a.Name, a.State)
+}
+
+// SortAlerts orders alerts by chart, chart metric, rule and series name.
+func SortAlerts(alerts []*Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		switch {
+		case a.Chart != b.Chart:
+			return a.Chart < b.Chart
+		case a.Metric != b.Metric:
+			return a.Metric < b.Metric
+		case a.Rule != b.Rule:
+			return a.Rule < b.Rule
+		default:
+			return a.Name < b.Name
+		}
+	})
+}
+
+// AlertSource evaluates alert rules.
+type AlertSource interface {
+	// Alerts returns every pending, firing and resolved alert ordered by chart, chart metric,
+	// rule and series name
+	Alerts() []*Alert
+	// Watch calls fn with a copy of every alert which fires or resolves until stop is called.
+	// fn must not block
+	Watch(fn func(*Alert)) (stop func())
+}
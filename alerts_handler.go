@@ -0,0 +1,66 @@
+package graphx
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ldelossa/jsonerr"
+)
+
+const (
+	AlertsErrCode = "graphx.alerts_handler"
+)
+
+// AlertsResult is the response of the AlertsHandler
+type AlertsResult struct {
+	Alerts []*Alert `json:"alerts"`
+}
+
+// AlertsHandler returns the current alerts as JSON, optionally filtered by the chart_names
+// and state query parameters.
+func AlertsHandler(as AlertSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			log.Printf("methd not allowed")
+			resp := jsonerr.NewResponse("", AlertsErrCode, "method not allowed")
+			jsonerr.Error(w, resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		charts := map[string]bool{}
+		for _, name := range splitParam(q["chart_names"]) {
+			charts[name] = true
+		}
+		states := map[AlertState]bool{}
+		for _, state := range splitParam(q["state"]) {
+			switch s := AlertState(state); s {
+			case AlertPending, AlertFiring, AlertResolved:
+				states[s] = true
+			default:
+				resp := jsonerr.NewResponse("", AlertsErrCode, fmt.Sprintf("unknown state %q", state))
+				jsonerr.Error(w, resp, http.StatusBadRequest)
+				return
+			}
+		}
+
+		res := AlertsResult{Alerts: []*Alert{}}
+		for _, a := range as.Alerts() {
+			if len(charts) > 0 && !charts[a.Chart] {
+				continue
+			}
+			if len(states) > 0 && !states[a.State] {
+				continue
+			}
+			res.Alerts = append(res.Alerts, a)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(res)
+		if err != nil {
+			log.Printf("failed to write alerts: %v", err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package graphx
+
+// Backpressure determines what happens to metrics when a client reads them slower
+// than they are produced and its session's buffer fills.
+type Backpressure string
+
+const (
+	// BackpressureBlock stops polling for the session until the client catches up.
+	// sessions which block do not share pollers with other sessions.
+	BackpressureBlock Backpressure = "block"
+	// BackpressureDropOldest discards the oldest buffered metric to make room
+	BackpressureDropOldest Backpressure = "drop_oldest"
+	// BackpressureDropNewest discards incoming metrics until there is room. this is the default
+	BackpressureDropNewest Backpressure = "drop_newest"
+	// BackpressureCoalesce keeps only the latest buffered metric of each series
+	BackpressureCoalesce Backpressure = "coalesce"
+)
+
+const (
+	// DefaultBufferSize is the number of metrics buffered per session when not requested
+	DefaultBufferSize = 1024
+)
+
+// Lossy is implemented by Streamers which may discard metrics under backpressure.
+type Lossy interface {
+	// Dropped returns the total number of metrics discarded since the stream began
+	Dropped() uint64
+}
@@ -1,5 +1,9 @@
 package graphx
 
+import (
+	"time"
+)
+
 // Chart is a user defined container of ChartMetrics. Provides a
 // high level name for a chart and a container for all of a chart's metrics
 type Chart struct {
@@ -7,6 +11,20 @@ type Chart struct {
 	Name string `json:"name"`
 	// a list of chart metrics this high level chart comprises
 	ChartMetrics []ChartMetric `json:"metrics"`
+	// an optional minimum poll interval. charts whose queries are expensive or change slowly are
+	// polled at this interval when a session requests a shorter one
+	MinInterval Duration `json:"min_interval,omitempty"`
+	// an optional aggregation across the series of each chart metric, such as keeping the ten
+	// containers with the highest cpu usage
+	Aggregation *Aggregation `json:"aggregation,omitempty"`
+}
+
+// Interval returns the interval the chart is polled at for a session requesting pollInterval
+func (c *Chart) Interval(pollInterval time.Duration) time.Duration {
+	if min := time.Duration(c.MinInterval); min > pollInterval {
+		return min
+	}
+	return pollInterval
 }
 
 // ChartMetric
@@ -19,16 +37,36 @@ type ChartMetric struct {
 	Query string `json:"query"`
 	// the datasource that the query targets
 	Datasource string `json:"datasource"`
+	// an optional timeout for each live query, overriding the datasource's timeout
+	Timeout Duration `json:"timeout,omitempty"`
+	// an arithmetic expression over other chart metrics of the chart, such as "errors / requests".
+	// a chart metric with an expression is derived from the series of its operands sharing a
+	// name rather than queried, and its Query and Datasource are ignored
+	Expr string `json:"expr,omitempty"`
+	// transforms applied in order to the chart metric's values before delivery
+	Transforms []Transform `json:"transforms,omitempty"`
+	// alert rules evaluated on the chart metric's transformed values
+	Alerts []AlertRule `json:"alerts,omitempty"`
 }
 
+// DerivedDatasource is the datasource DatasourceTranspose files chart metrics with an Expr under
+const DerivedDatasource = "derived"
+
 // DatasourceTranpose takes a list of charts and returns a map
 // of ChartMetrics keye'd by their datasource. This is helpful for
-// handing specific ChartMetrics to the appropriate datasource clients
+// handing specific ChartMetrics to the appropriate datasource clients.
+// derived chart metrics are keyed by DerivedDatasource
 func DatasourceTranspose(charts []*Chart) map[string][]ChartMetric {
 	res := map[string][]ChartMetric{}
 
 	for _, chart := range charts {
 		for _, chartMetric := range chart.ChartMetrics {
+			if chartMetric.Chart == "" {
+				chartMetric.Chart = chart.Name
+			}
+			if chartMetric.Expr != "" {
+				chartMetric.Datasource = DerivedDatasource
+			}
 			res[chartMetric.Datasource] = append(res[chartMetric.Datasource], chartMetric)
 		}
 	}
@@ -18,6 +18,28 @@ type ChartsDescriptor struct {
 	Names []string `json:"names" validate:"required,min=1"`
 	// the value we poll the backend datastore and provide the client with updated metrics
 	PollInterval Duration `json:"poll_interval" validate:"required"`
+	// an optional upper bound allowing the poll interval to adapt to the data. polling backs off
+	// towards it while data does not change or queries are slow and returns to PollInterval once
+	// data moves. the effective interval of each chart is reported to the client
+	MaxPollInterval Duration `json:"max_poll_interval"`
+	// samples are only delivered once their value changes. an optional keepalive re-sends the
+	// latest sample of a series which has not changed for this long, telling clients the series
+	// is stale rather than gone
+	Keepalive Duration `json:"keepalive"`
+	// how long a series may be missing from query results before the client is told it was removed.
+	// defaults to two polls at the longest interval a chart is polled at
+	SeriesGrace Duration `json:"series_grace"`
+	// an optional upper bound on the number of historical points delivered per series. range
+	// queries step coarser to approach it and series still exceeding it are downsampled
+	MaxPoints int `json:"max_points" validate:"omitempty,min=2"`
+	// how series exceeding MaxPoints are reduced. defaults to DownsampleLTTB
+	Downsample Downsample `json:"downsample" validate:"omitempty,oneof=lttb minmax avg"`
+	// the representation historical metrics are delivered in. defaults to EncodingRows
+	Encoding Encoding `json:"encoding" validate:"omitempty,oneof=rows columnar gorilla"`
+	// what to do with metrics the client is too slow to receive. defaults to BackpressureDropNewest
+	Backpressure Backpressure `json:"backpressure" validate:"omitempty,oneof=block drop_oldest drop_newest coalesce"`
+	// the number of metrics buffered for the client. defaults to DefaultBufferSize
+	BufferSize int `json:"buffer_size" validate:"omitempty,min=1,max=65536"`
 }
 
 // ChartName is a type faciliating marshaling and unmarshaling a string to our ChartName type
@@ -41,7 +63,7 @@ type TimeStamp time.Time
 
 func (t TimeStamp) MarshalJSON() ([]byte, error) {
 	s := time.Time(t).Format(time.RFC3339)
-	return []byte(s), nil
+	return []byte(strconv.Quote(s)), nil
 }
 
 func (t *TimeStamp) UnmarshalJSON(b []byte) error {
@@ -60,7 +82,7 @@ type Duration time.Duration
 
 func (d Duration) MarshalJSON() ([]byte, error) {
 	s := fmt.Sprintf("%v", time.Duration(d))
-	return []byte(s), nil
+	return []byte(strconv.Quote(s)), nil
 }
 
 func (d *Duration) UnmarshalJSON(b []byte) error {
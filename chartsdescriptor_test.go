@@ -0,0 +1,33 @@
+package graphx
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChartsDescriptorRoundTrip(t *testing.T) {
+	cd := ChartsDescriptor{
+		Fill:         TimeStamp(time.Date(2019, 1, 29, 18, 12, 15, 0, time.UTC)),
+		ChartNames:   []string{"cpu"},
+		Names:        []string{"web_1", "web_2"},
+		PollInterval: Duration(5 * time.Second),
+	}
+
+	b, err := json.Marshal(cd)
+	if err != nil {
+		t.Fatalf("failed to marshal descriptor: %v", err)
+	}
+	var got ChartsDescriptor
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to unmarshal descriptor %s: %v", b, err)
+	}
+	if !time.Time(got.Fill).Equal(time.Time(cd.Fill)) {
+		t.Fatalf("expected fill %v got: %v", time.Time(cd.Fill), time.Time(got.Fill))
+	}
+	got.Fill = cd.Fill
+	if !reflect.DeepEqual(got, cd) {
+		t.Fatalf("expected %+v got: %+v", cd, got)
+	}
+}
@@ -0,0 +1,37 @@
+package graphx
+
+import (
+	"context"
+	"time"
+)
+
+type ctxKey int
+
+const (
+	pollIntervalKey ctxKey = iota
+	sessionKey
+)
+
+// WithPollInterval returns a context carrying the interval a query is being polled at.
+// datasources may use it to scale caching and timeouts to the poll interval.
+func WithPollInterval(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, pollIntervalKey, d)
+}
+
+// PollIntervalFromContext returns the poll interval carried by ctx, if any.
+func PollIntervalFromContext(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(pollIntervalKey).(time.Duration)
+	return d, ok
+}
+
+// WithSession returns a context carrying the session a query is issued for.
+// a Limiter queues fairly between sessions.
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey, id)
+}
+
+// SessionFromContext returns the session carried by ctx, if any.
+func SessionFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(sessionKey).(string)
+	return id, ok
+}
@@ -0,0 +1,67 @@
+package graphx
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cloudscaleorg/graphx/internal/downsample"
+)
+
+// Downsample determines how a backfilled series exceeding a ChartsDescriptor's MaxPoints is reduced.
+type Downsample string
+
+const (
+	// DownsampleLTTB keeps the points which best preserve the visual shape of the series using
+	// Largest-Triangle-Three-Buckets. this is the default.
+	DownsampleLTTB Downsample = "lttb"
+	// DownsampleMinMax keeps the minimum and maximum point of each bucket so spikes are never lost.
+	DownsampleMinMax Downsample = "minmax"
+	// DownsampleAvg replaces each bucket with its mean value.
+	DownsampleAvg Downsample = "avg"
+)
+
+// Downsample reduces the series to at most maxPoints points with the provided method.
+// a series which already fits or a non positive maxPoints leaves the series unchanged.
+func (s *Series) Downsample(method Downsample, maxPoints int) error {
+	if maxPoints <= 0 || len(s.TimeStamps) <= maxPoints {
+		return nil
+	}
+
+	vs := make([]float64, len(s.Values))
+	for i, v := range s.Values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("series %s.%s: failed to parse value %q: %v", s.Chart, s.Name, v, err)
+		}
+		vs[i] = f
+	}
+
+	switch method {
+	case "", DownsampleLTTB:
+		s.keep(downsample.LTTB(s.TimeStamps, vs, maxPoints))
+	case DownsampleMinMax:
+		s.keep(downsample.MinMax(vs, maxPoints))
+	case DownsampleAvg:
+		ts, avgs := downsample.Avg(s.TimeStamps, vs, maxPoints)
+		s.TimeStamps = ts
+		s.Values = make([]string, len(avgs))
+		for i, f := range avgs {
+			s.Values[i] = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	default:
+		return fmt.Errorf("unknown downsample method %q", method)
+	}
+	return nil
+}
+
+// keep retains the points at the provided ascending indices
+func (s *Series) keep(idx []int) {
+	ts := make([]int64, len(idx))
+	vs := make([]string, len(idx))
+	for i, j := range idx {
+		ts[i] = s.TimeStamps[j]
+		vs[i] = s.Values[j]
+	}
+	s.TimeStamps = ts
+	s.Values = vs
+}
@@ -0,0 +1,80 @@
+package graphx
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// QueryErrorKind classifies why a query failed
+type QueryErrorKind string
+
+const (
+	// QueryErrorClient is a failure communicating with the datasource or an error it returned
+	QueryErrorClient QueryErrorKind = "client"
+	// QueryErrorTimeout is a query which did not complete in time
+	QueryErrorTimeout QueryErrorKind = "timeout"
+	// QueryErrorBadType is a query which returned a result of an unexpected type
+	QueryErrorBadType QueryErrorKind = "bad_type"
+	// QueryErrorValidation is a query or chart metric the datasource rejected as invalid
+	QueryErrorValidation QueryErrorKind = "validation"
+	// QueryErrorSkipped is a poll which was skipped because the previous query was still running
+	QueryErrorSkipped QueryErrorKind = "skipped"
+	// QueryErrorUnavailable is a query which was not issued because its datasource is failing.
+	// it is reported on every poll until the datasource recovers
+	QueryErrorUnavailable QueryErrorKind = "unavailable"
+)
+
+// QueryError is delivered to a client when the query of a chart metric fails so the
+// specific chart can be shown as failing rather than empty.
+type QueryError struct {
+	Kind QueryErrorKind `json:"kind"`
+	// the chart and the name of the chart metric within it
+	Chart      string `json:"chart"`
+	Metric     string `json:"metric"`
+	Query      string `json:"query"`
+	Datasource string `json:"datasource"`
+	// a description of the failure
+	Message string `json:"message"`
+}
+
+// NewQueryError creates a QueryError for a chart metric.
+func NewQueryError(kind QueryErrorKind, cm ChartMetric, err error) *QueryError {
+	return &QueryError{
+		Kind:       kind,
+		Chart:      cm.Chart,
+		Metric:     cm.Name,
+		Query:      cm.Query,
+		Datasource: cm.Datasource,
+		Message:    err.Error(),
+	}
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s query for chart %s metric %s failed: %s", e.Kind, e.Chart, e.Metric, e.Message)
+}
+
+// For returns a copy of the error attributed to another chart metric running the same query.
+func (e *QueryError) For(cm ChartMetric) *QueryError {
+	qe := *e
+	qe.Chart = cm.Chart
+	qe.Metric = cm.Name
+	return &qe
+}
+
+// ChartStoreError is returned when the charts of a request could not be retrieved from the
+// chart store. it is a failure of the server rather then of the request.
+type ChartStoreError struct {
+	Err error
+}
+
+func (e *ChartStoreError) Error() string {
+	return fmt.Sprintf("failed to query chart store: %v", e.Err)
+}
+
+// errorStatus returns the http status a failure to open a stream or run a query is reported with
+func errorStatus(err error) int {
+	if _, ok := err.(*ChartStoreError); ok {
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,140 @@
+// Package downsample reduces the number of points of a series while preserving its shape.
+// points are split into buckets of equal point counts, which suits the evenly stepped
+// results of range queries.
+package downsample
+
+import (
+	"math"
+)
+
+// LTTB returns the indices of at most threshold points selected with the
+// Largest-Triangle-Three-Buckets algorithm. the first and last points are always kept and
+// every other bucket keeps the point forming the largest triangle with the point kept for
+// the previous bucket and the average of the next bucket.
+func LTTB(ts []int64, vs []float64, threshold int) []int {
+	n := len(vs)
+	if threshold >= n || threshold <= 0 {
+		return all(n)
+	}
+	if threshold < 3 {
+		return []int{0, n - 1}
+	}
+
+	sampled := make([]int, 0, threshold)
+	sampled = append(sampled, 0)
+
+	// the first and last points are buckets of their own
+	every := float64(n-2) / float64(threshold-2)
+	a := 0
+	for i := 0; i < threshold-2; i++ {
+		// the average point of the next bucket
+		avgStart := int(float64(i+1)*every) + 1
+		avgEnd := int(float64(i+2)*every) + 1
+		if avgEnd > n {
+			avgEnd = n
+		}
+		var avgX, avgY float64
+		for j := avgStart; j < avgEnd; j++ {
+			avgX += float64(ts[j])
+			avgY += vs[j]
+		}
+		count := float64(avgEnd - avgStart)
+		avgX /= count
+		avgY /= count
+
+		start := int(float64(i)*every) + 1
+		end := int(float64(i+1)*every) + 1
+		ax, ay := float64(ts[a]), vs[a]
+		maxArea := -1.0
+		next := start
+		for j := start; j < end; j++ {
+			area := math.Abs((ax-avgX)*(vs[j]-ay) - (ax-float64(ts[j]))*(avgY-ay))
+			if area > maxArea {
+				maxArea = area
+				next = j
+			}
+		}
+
+		sampled = append(sampled, next)
+		a = next
+	}
+
+	return append(sampled, n-1)
+}
+
+// MinMax returns the indices of the minimum and maximum point of threshold/2 buckets in
+// time order. spikes survive which averaging would flatten.
+func MinMax(vs []float64, threshold int) []int {
+	n := len(vs)
+	if threshold >= n || threshold <= 0 {
+		return all(n)
+	}
+	buckets := threshold / 2
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	idx := make([]int, 0, 2*buckets)
+	for b := 0; b < buckets; b++ {
+		start, end := b*n/buckets, (b+1)*n/buckets
+		lo, hi := start, start
+		for j := start + 1; j < end; j++ {
+			if vs[j] < vs[lo] {
+				lo = j
+			}
+			if vs[j] > vs[hi] {
+				hi = j
+			}
+		}
+
+		switch {
+		case lo == hi:
+			idx = append(idx, lo)
+		case lo < hi:
+			idx = append(idx, lo, hi)
+		default:
+			idx = append(idx, hi, lo)
+		}
+	}
+	return idx
+}
+
+// Avg splits the points into threshold buckets and returns the timestamp of the first point
+// and the mean value of each. NaN values are ignored unless a bucket holds nothing else.
+func Avg(ts []int64, vs []float64, threshold int) ([]int64, []float64) {
+	n := len(vs)
+	if threshold >= n || threshold <= 0 {
+		return ts, vs
+	}
+
+	ots := make([]int64, 0, threshold)
+	ovs := make([]float64, 0, threshold)
+	for b := 0; b < threshold; b++ {
+		start, end := b*n/threshold, (b+1)*n/threshold
+		var sum float64
+		var count int
+		for j := start; j < end; j++ {
+			if math.IsNaN(vs[j]) {
+				continue
+			}
+			sum += vs[j]
+			count++
+		}
+
+		avg := math.NaN()
+		if count > 0 {
+			avg = sum / float64(count)
+		}
+		ots = append(ots, ts[start])
+		ovs = append(ovs, avg)
+	}
+	return ots, ovs
+}
+
+func all(n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
@@ -0,0 +1,74 @@
+package downsample
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// spike is a flat series with a single spike and a single dip
+var spike = []float64{1, 1, 1, 9, 1, 1, 1, 1, -5, 1, 1, 1}
+
+func timestamps(n int) []int64 {
+	ts := make([]int64, n)
+	for i := range ts {
+		ts[i] = int64(i * 10)
+	}
+	return ts
+}
+
+var LTTBTT = []struct {
+	name      string
+	vs        []float64
+	threshold int
+	expected  []int
+}{
+	{
+		name:      "keeps every point under the threshold",
+		vs:        []float64{1, 2, 3},
+		threshold: 5,
+		expected:  []int{0, 1, 2},
+	},
+	{
+		name:      "keeps the first and last points for tiny thresholds",
+		vs:        spike,
+		threshold: 2,
+		expected:  []int{0, 11},
+	},
+	{
+		name:      "keeps the spike and the dip",
+		vs:        spike,
+		threshold: 4,
+		expected:  []int{0, 3, 8, 11},
+	},
+}
+
+func TestLTTB(t *testing.T) {
+	for _, tt := range LTTBTT {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LTTB(timestamps(len(tt.vs)), tt.vs, tt.threshold)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("got: %v want: %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	// two buckets of six points, each keeping its extremes in time order
+	got := MinMax(spike, 4)
+	expected := []int{0, 3, 6, 8}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got: %v want: %v", got, expected)
+	}
+}
+
+func TestAvg(t *testing.T) {
+	ts, vs := Avg(timestamps(6), []float64{1, 3, math.NaN(), 5, math.NaN(), math.NaN()}, 3)
+	if !reflect.DeepEqual(ts, []int64{0, 20, 40}) {
+		t.Fatalf("expected the first timestamp of each bucket got: %v", ts)
+	}
+	if vs[0] != 2 || vs[1] != 5 || !math.IsNaN(vs[2]) {
+		t.Fatalf("unexpected averages: %v", vs)
+	}
+}
@@ -0,0 +1,264 @@
+// Package expr parses and evaluates arithmetic expressions over named operands such as
+// "errors / requests * 100".
+//
+// operands are identifiers made of letters, digits, '_', '.' and ':' which do not start
+// with a digit. expressions support +, -, *, /, unary minus and parentheses with the usual
+// precedence. evaluation follows IEEE 754, dividing by zero yields an infinity or NaN.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Expr is a parsed expression
+type Expr struct {
+	root node
+	// distinct operands in order of appearance
+	operands []string
+}
+
+// Parse parses an expression.
+func Parse(s string) (*Expr, error) {
+	p := &parser{s: s}
+	p.next()
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+
+	e := &Expr{root: root}
+	seen := map[string]bool{}
+	root.walk(func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			e.operands = append(e.operands, name)
+		}
+	})
+	return e, nil
+}
+
+// Operands returns the distinct operands the expression references in order of appearance.
+func (e *Expr) Operands() []string {
+	return e.operands
+}
+
+// Eval evaluates the expression. operands missing from values evaluate to NaN.
+func (e *Expr) Eval(values map[string]float64) float64 {
+	return e.root.eval(values)
+}
+
+type node interface {
+	eval(values map[string]float64) float64
+	walk(fn func(operand string))
+}
+
+type number float64
+
+func (n number) eval(map[string]float64) float64 { return float64(n) }
+func (n number) walk(func(string))               {}
+
+type operand string
+
+func (o operand) eval(values map[string]float64) float64 {
+	v, ok := values[string(o)]
+	if !ok {
+		return math.NaN()
+	}
+	return v
+}
+func (o operand) walk(fn func(string)) { fn(string(o)) }
+
+type negate struct{ x node }
+
+func (n negate) eval(values map[string]float64) float64 { return -n.x.eval(values) }
+func (n negate) walk(fn func(string))                   { n.x.walk(fn) }
+
+type binary struct {
+	op   byte
+	l, r node
+}
+
+func (b binary) eval(values map[string]float64) float64 {
+	l, r := b.l.eval(values), b.r.eval(values)
+	switch b.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	default:
+		return l / r
+	}
+}
+
+func (b binary) walk(fn func(string)) {
+	b.l.walk(fn)
+	b.r.walk(fn)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// parser is a recursive descent parser of the grammar
+//
+//	expr  = term { ("+" | "-") term }
+//	term  = unary { ("*" | "/") unary }
+//	unary = "-" unary | primary
+//	primary = number | operand | "(" expr ")"
+type parser struct {
+	s   string
+	pos int
+	tok token
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q at %d: %s", p.s, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expr() (node, error) {
+	l, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := p.tok.text[0]
+		p.next()
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) term() (node, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/") {
+		op := p.tok.text[0]
+		p.next()
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.tok.kind == tokOp && p.tok.text == "-" {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negate{x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", tok)
+		}
+		p.next()
+		return number(f), nil
+	case tokIdent:
+		p.next()
+		return operand(tok.text), nil
+	case tokLParen:
+		p.next()
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected \")\" got %s", p.tok)
+		}
+		p.next()
+		return x, nil
+	default:
+		return nil, p.errorf("unexpected %s", tok)
+	}
+}
+
+// next scans the next token into tok
+func (p *parser) next() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.s) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := p.s[p.pos]
+	switch {
+	case c == '+' || c == '-' || c == '*' || c == '/':
+		p.pos++
+		p.tok = token{kind: tokOp, text: string(c), pos: start}
+	case c == '(':
+		p.pos++
+		p.tok = token{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.tok = token{kind: tokRParen, text: ")", pos: start}
+	case isDigit(c) || c == '.':
+		for p.pos < len(p.s) && (isDigit(p.s[p.pos]) || p.s[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.s[start:p.pos], pos: start}
+	case isIdentStart(c):
+		for p.pos < len(p.s) && (isIdentStart(p.s[p.pos]) || isDigit(p.s[p.pos]) || p.s[p.pos] == '.' || p.s[p.pos] == ':') {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.s[start:p.pos], pos: start}
+	default:
+		p.pos++
+		p.tok = token{kind: tokOp, text: string(c), pos: start}
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
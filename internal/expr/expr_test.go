@@ -0,0 +1,64 @@
+package expr
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+var values = map[string]float64{
+	"errors":   5,
+	"requests": 20,
+	"cpu.user": 3,
+	"zero":     0,
+}
+
+var ExprTT = []struct {
+	expr     string
+	operands []string
+	expected float64
+}{
+	{expr: "errors / requests", operands: []string{"errors", "requests"}, expected: 0.25},
+	{expr: "errors / requests * 100", operands: []string{"errors", "requests"}, expected: 25},
+	{expr: "errors + requests * 2", operands: []string{"errors", "requests"}, expected: 45},
+	{expr: "(errors + requests) * 2", operands: []string{"errors", "requests"}, expected: 50},
+	{expr: "requests - errors - errors", operands: []string{"requests", "errors"}, expected: 10},
+	{expr: "-errors + 1.5", operands: []string{"errors"}, expected: -3.5},
+	{expr: "cpu.user * errors / errors", operands: []string{"cpu.user", "errors"}, expected: 3},
+	{expr: "errors / zero", operands: []string{"errors", "zero"}, expected: math.Inf(1)},
+}
+
+func TestExpr(t *testing.T) {
+	for _, tt := range ExprTT {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !reflect.DeepEqual(e.Operands(), tt.operands) {
+				t.Fatalf("got operands: %v want: %v", e.Operands(), tt.operands)
+			}
+			if got := e.Eval(values); got != tt.expected {
+				t.Fatalf("got: %v want: %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExprMissingOperand(t *testing.T) {
+	e, err := Parse("errors / missing")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if got := e.Eval(values); !math.IsNaN(got) {
+		t.Fatalf("expected NaN got: %v", got)
+	}
+}
+
+func TestExprInvalid(t *testing.T) {
+	for _, s := range []string{"", "errors /", "(errors", "errors requests", "errors % 2", "1..2", ")"} {
+		if _, err := Parse(s); err == nil {
+			t.Fatalf("expected %q to fail to parse", s)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package gorilla
+
+import (
+	"errors"
+)
+
+// ErrShortStream is returned when a bit stream ends before the expected
+// number of bits could be read.
+var ErrShortStream = errors.New("gorilla: unexpected end of bit stream")
+
+// bwriter appends individual bits to a byte slice, most significant bit first.
+type bwriter struct {
+	b []byte
+	// the number of bits still free in the last byte of b
+	free uint8
+}
+
+func (w *bwriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.b = append(w.b, 0)
+		w.free = 8
+	}
+	if bit {
+		w.b[len(w.b)-1] |= 1 << (w.free - 1)
+	}
+	w.free--
+}
+
+// writeBits writes the n least significant bits of u.
+func (w *bwriter) writeBits(u uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit((u>>uint(i))&1 == 1)
+	}
+}
+
+// breader reads individual bits from a byte slice, most significant bit first.
+type breader struct {
+	b []byte
+	// the index of the next bit to read
+	pos int
+}
+
+func (r *breader) readBit() (bool, error) {
+	if r.pos >= len(r.b)*8 {
+		return false, ErrShortStream
+	}
+	bit := r.b[r.pos/8]&(1<<(7-uint(r.pos%8))) != 0
+	r.pos++
+	return bit, nil
+}
+
+// readBits reads n bits into the least significant bits of the returned value.
+func (r *breader) readBits(n int) (uint64, error) {
+	var u uint64
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,242 @@
+// Package gorilla implements the timestamp and value compression scheme described in
+// "Gorilla: A Fast, Scalable, In-Memory Time Series Database" (Pelkonen et al, 2015).
+//
+// timestamps are stored as delta-of-deltas and values as the XOR of the previous value,
+// both of which collapse to a handful of bits for regularly scraped, slowly moving series.
+// the stream begins with a 32 bit point count so it may be decoded without any framing.
+package gorilla
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// Encoder compresses a series of timestamp and value pairs.
+// timestamps must be pushed in ascending order.
+type Encoder struct {
+	w bwriter
+	// the number of points pushed
+	n uint32
+	// the previous timestamp and delta
+	t     int64
+	delta int64
+	// the previous value as raw float bits
+	v uint64
+	// the leading and trailing zeros of the previous meaningful xor window
+	leading  int
+	trailing int
+}
+
+// NewEncoder is a constructor for an Encoder.
+func NewEncoder() *Encoder {
+	e := &Encoder{
+		leading: -1,
+	}
+	// reserve space for the point count
+	e.w.writeBits(0, 32)
+	return e
+}
+
+// Push appends a point to the stream.
+func (e *Encoder) Push(t int64, v float64) {
+	vb := math.Float64bits(v)
+	if e.n == 0 {
+		e.w.writeBits(uint64(t), 64)
+		e.w.writeBits(vb, 64)
+		e.t, e.v = t, vb
+		e.n++
+		return
+	}
+
+	delta := t - e.t
+	e.writeDoD(delta - e.delta)
+	e.writeXOR(vb ^ e.v)
+
+	e.t, e.delta, e.v = t, delta, vb
+	e.n++
+}
+
+// Bytes returns the encoded stream. the Encoder may continue to be used afterwards.
+func (e *Encoder) Bytes() []byte {
+	b := make([]byte, len(e.w.b))
+	copy(b, e.w.b)
+	binary.BigEndian.PutUint32(b[0:4], e.n)
+	return b
+}
+
+func (e *Encoder) writeDoD(dod int64) {
+	switch {
+	case dod == 0:
+		e.w.writeBit(false)
+	case dod >= -64 && dod <= 63:
+		e.w.writeBits(0x2, 2)
+		e.w.writeBits(uint64(dod), 7)
+	case dod >= -256 && dod <= 255:
+		e.w.writeBits(0x6, 3)
+		e.w.writeBits(uint64(dod), 9)
+	case dod >= -2048 && dod <= 2047:
+		e.w.writeBits(0xe, 4)
+		e.w.writeBits(uint64(dod), 12)
+	default:
+		e.w.writeBits(0xf, 4)
+		e.w.writeBits(uint64(dod), 64)
+	}
+}
+
+func (e *Encoder) writeXOR(xor uint64) {
+	if xor == 0 {
+		e.w.writeBit(false)
+		return
+	}
+	e.w.writeBit(true)
+
+	leading := bits.LeadingZeros64(xor)
+	trailing := bits.TrailingZeros64(xor)
+	// leading zeros are stored in 5 bits
+	if leading > 31 {
+		leading = 31
+	}
+
+	// reuse the previous window if the meaningful bits fit inside of it
+	if e.leading != -1 && leading >= e.leading && trailing >= e.trailing {
+		e.w.writeBit(false)
+		e.w.writeBits(xor>>uint(e.trailing), 64-e.leading-e.trailing)
+		return
+	}
+
+	sigbits := 64 - leading - trailing
+	e.w.writeBit(true)
+	e.w.writeBits(uint64(leading), 5)
+	// 64 significant bits does not fit in 6 bits and is stored as 0
+	e.w.writeBits(uint64(sigbits&0x3f), 6)
+	e.w.writeBits(xor>>uint(trailing), sigbits)
+
+	e.leading, e.trailing = leading, trailing
+}
+
+// Decode decompresses a stream produced by an Encoder.
+func Decode(b []byte) ([]int64, []float64, error) {
+	r := &breader{b: b}
+
+	n, err := r.readBits(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the first point takes 128 bits and every following point at least 2, a count the
+	// remaining input cannot hold is rejected before allocating for it
+	if rem := uint64(len(b))*8 - 32; n > 0 && (rem < 128 || n-1 > (rem-128)/2) {
+		return nil, nil, ErrShortStream
+	}
+	ts := make([]int64, 0, n)
+	vs := make([]float64, 0, n)
+	if n == 0 {
+		return ts, vs, nil
+	}
+
+	t, err := r.readBits(64)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := r.readBits(64)
+	if err != nil {
+		return nil, nil, err
+	}
+	ts = append(ts, int64(t))
+	vs = append(vs, math.Float64frombits(v))
+
+	var delta int64
+	leading, trailing := 0, 0
+	for i := uint64(1); i < n; i++ {
+		dod, err := readDoD(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		delta += dod
+		t += uint64(delta)
+
+		xor, err := readXOR(r, &leading, &trailing)
+		if err != nil {
+			return nil, nil, err
+		}
+		v ^= xor
+
+		ts = append(ts, int64(t))
+		vs = append(vs, math.Float64frombits(v))
+	}
+
+	return ts, vs, nil
+}
+
+func readDoD(r *breader) (int64, error) {
+	// count the leading one bits of the control prefix, at most four
+	var prefix int
+	for prefix < 4 {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		prefix++
+	}
+
+	var size int
+	switch prefix {
+	case 0:
+		return 0, nil
+	case 1:
+		size = 7
+	case 2:
+		size = 9
+	case 3:
+		size = 12
+	default:
+		size = 64
+	}
+
+	u, err := r.readBits(size)
+	if err != nil {
+		return 0, err
+	}
+	// sign extend
+	shift := uint(64 - size)
+	return int64(u<<shift) >> shift, nil
+}
+
+func readXOR(r *breader, leading, trailing *int) (uint64, error) {
+	bit, err := r.readBit()
+	if err != nil {
+		return 0, err
+	}
+	if !bit {
+		return 0, nil
+	}
+
+	bit, err = r.readBit()
+	if err != nil {
+		return 0, err
+	}
+	if bit {
+		l, err := r.readBits(5)
+		if err != nil {
+			return 0, err
+		}
+		sigbits, err := r.readBits(6)
+		if err != nil {
+			return 0, err
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		*leading = int(l)
+		*trailing = 64 - int(l) - int(sigbits)
+	}
+
+	u, err := r.readBits(64 - *leading - *trailing)
+	if err != nil {
+		return 0, err
+	}
+	return u << uint(*trailing), nil
+}
@@ -0,0 +1,90 @@
+package gorilla
+
+import (
+	"math"
+	"testing"
+)
+
+var GorillaTT = []struct {
+	name string
+	ts   []int64
+	vs   []float64
+}{
+	{
+		name: "empty",
+	},
+	{
+		name: "single point",
+		ts:   []int64{1548785535},
+		vs:   []float64{12.5},
+	},
+	{
+		name: "regular interval, constant value",
+		ts:   []int64{1548785535, 1548785545, 1548785555, 1548785565},
+		vs:   []float64{1, 1, 1, 1},
+	},
+	{
+		name: "irregular interval, moving values",
+		ts:   []int64{1548785535, 1548785536, 1548785600, 1548789000, 1548789001, 1648789001},
+		vs:   []float64{0.25, 17.125, -3, 1e300, 5e-300, 42},
+	},
+	{
+		name: "special values",
+		ts:   []int64{1, 2, 3, 4},
+		vs:   []float64{math.NaN(), math.Inf(1), math.Inf(-1), 0},
+	},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range GorillaTT {
+
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEncoder()
+			for i := range tt.ts {
+				e.Push(tt.ts[i], tt.vs[i])
+			}
+
+			ts, vs, err := Decode(e.Bytes())
+			if err != nil {
+				t.Fatalf("failed to decode stream: %v", err)
+			}
+
+			if len(ts) != len(tt.ts) || len(vs) != len(tt.vs) {
+				t.Fatalf("expected %d points got %d timestamps and %d values", len(tt.ts), len(ts), len(vs))
+			}
+			for i := range tt.ts {
+				if ts[i] != tt.ts[i] {
+					t.Fatalf("point %d: expected ts: %v got ts: %v", i, tt.ts[i], ts[i])
+				}
+				if math.Float64bits(vs[i]) != math.Float64bits(tt.vs[i]) {
+					t.Fatalf("point %d: expected value: %v got value: %v", i, tt.vs[i], vs[i])
+				}
+			}
+		})
+
+	}
+}
+
+func TestShortStream(t *testing.T) {
+	e := NewEncoder()
+	e.Push(1548785535, 1)
+	e.Push(1548785545, 2)
+
+	b := e.Bytes()
+	_, _, err := Decode(b[:len(b)-2])
+	if err != ErrShortStream {
+		t.Fatalf("expected ErrShortStream got: %v", err)
+	}
+}
+
+func TestHugeCount(t *testing.T) {
+	e := NewEncoder()
+	e.Push(1548785535, 1)
+
+	b := e.Bytes()
+	b[0], b[1], b[2], b[3] = 0xff, 0xff, 0xff, 0xff
+	_, _, err := Decode(b)
+	if err != ErrShortStream {
+		t.Fatalf("expected ErrShortStream got: %v", err)
+	}
+}
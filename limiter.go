@@ -0,0 +1,176 @@
+package graphx
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LimiterStats are the queueing statistics of a Limiter
+type LimiterStats struct {
+	// the number of callers holding and waiting for a slot
+	Running int `json:"running"`
+	Queued  int `json:"queued"`
+	// the number of slots acquired and how many of those had to queue
+	Acquired uint64 `json:"acquired"`
+	Waited   uint64 `json:"waited"`
+	// the total, average and longest time spent queued for a slot by callers which had to queue
+	WaitTime Duration `json:"wait_time"`
+	AvgWait  Duration `json:"avg_wait"`
+	MaxWait  Duration `json:"max_wait"`
+	// callers whose context was done while queued
+	Abandoned uint64 `json:"abandoned"`
+}
+
+// Limiter bounds the number of concurrent queries issued to a backend. callers which must
+// wait are queued per session, taken from the context with SessionFromContext, and sessions
+// are served round robin so a session issuing many queries cannot starve the others.
+type Limiter struct {
+	max int
+
+	mu      sync.Mutex
+	running int
+	// the queue of each session with waiting callers
+	queues map[string]*sessionQueue
+	// sessions with waiting callers in the order they are served
+	order *list.List
+	stats LimiterStats
+}
+
+type sessionQueue struct {
+	waiters *list.List
+	// the session's element in order
+	el *list.Element
+}
+
+type waiter struct {
+	session string
+	queued  time.Time
+	ready   chan struct{}
+	granted bool
+}
+
+// NewLimiter is a constructor for a Limiter allowing max concurrent callers.
+func NewLimiter(max int) *Limiter {
+	if max < 1 {
+		max = 1
+	}
+	return &Limiter{
+		max:    max,
+		queues: make(map[string]*sessionQueue),
+		order:  list.New(),
+	}
+}
+
+// Acquire blocks until a slot is available or ctx is done. the returned function must be
+// called to release the slot once the query completes.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	if l.running < l.max && l.order.Len() == 0 {
+		l.running++
+		l.stats.Acquired++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+
+	session, _ := SessionFromContext(ctx)
+	w := &waiter{
+		session: session,
+		queued:  time.Now(),
+		ready:   make(chan struct{}),
+	}
+	l.enqueue(w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		if w.granted {
+			// raced with dispatch, hand the slot on
+			l.mu.Unlock()
+			l.release()
+			return nil, ctx.Err()
+		}
+		l.remove(w)
+		l.stats.Abandoned++
+		l.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Stats returns the limiter's current statistics.
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	stats.Running = l.running
+	if stats.Waited > 0 {
+		stats.AvgWait = stats.WaitTime / Duration(stats.Waited)
+	}
+	return stats
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.dispatch()
+}
+
+// enqueue adds a waiter to the back of its session's queue. callers must hold mu.
+func (l *Limiter) enqueue(w *waiter) {
+	sq, ok := l.queues[w.session]
+	if !ok {
+		sq = &sessionQueue{waiters: list.New()}
+		sq.el = l.order.PushBack(w.session)
+		l.queues[w.session] = sq
+	}
+	sq.waiters.PushBack(w)
+	l.stats.Queued++
+}
+
+// remove drops an abandoned waiter from its session's queue. callers must hold mu.
+func (l *Limiter) remove(w *waiter) {
+	sq := l.queues[w.session]
+	for el := sq.waiters.Front(); el != nil; el = el.Next() {
+		if el.Value.(*waiter) == w {
+			sq.waiters.Remove(el)
+			l.stats.Queued--
+			break
+		}
+	}
+	if sq.waiters.Len() == 0 {
+		l.order.Remove(sq.el)
+		delete(l.queues, w.session)
+	}
+}
+
+// dispatch grants free slots to waiters, taking one waiter from each session in turn. callers must hold mu.
+func (l *Limiter) dispatch() {
+	for l.running < l.max && l.order.Len() > 0 {
+		session := l.order.Remove(l.order.Front()).(string)
+		sq := l.queues[session]
+		w := sq.waiters.Remove(sq.waiters.Front()).(*waiter)
+		if sq.waiters.Len() > 0 {
+			sq.el = l.order.PushBack(session)
+		} else {
+			delete(l.queues, session)
+		}
+
+		wait := time.Since(w.queued)
+		l.stats.Queued--
+		l.stats.Acquired++
+		l.stats.Waited++
+		l.stats.WaitTime += Duration(wait)
+		if Duration(wait) > l.stats.MaxWait {
+			l.stats.MaxWait = Duration(wait)
+		}
+
+		l.running++
+		w.granted = true
+		close(w.ready)
+	}
+}
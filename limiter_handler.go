@@ -0,0 +1,42 @@
+package graphx
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/ldelossa/jsonerr"
+)
+
+const (
+	LimitersErrCode = "graphx.limiters_handler"
+)
+
+// LimitersResult is the response of the LimitersHandler
+type LimitersResult struct {
+	Limiters map[string]LimiterStats `json:"limiters"`
+}
+
+// LimitersHandler returns the statistics of the provided limiters keyed by name as JSON, such
+// as the limiter of each datasource and a global limiter.
+func LimitersHandler(limiters map[string]*Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			log.Printf("methd not allowed")
+			resp := jsonerr.NewResponse("", LimitersErrCode, "method not allowed")
+			jsonerr.Error(w, resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		res := LimitersResult{Limiters: make(map[string]LimiterStats, len(limiters))}
+		for name, l := range limiters {
+			res.Limiters[name] = l.Stats()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(res)
+		if err != nil {
+			log.Printf("failed to write limiter stats: %v", err)
+		}
+	}
+}
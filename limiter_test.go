@@ -0,0 +1,107 @@
+package graphx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterFairness(t *testing.T) {
+	l := NewLimiter(1)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	// a busy session queues several queries before a quiet one queues a single query
+	order := make(chan string, 4)
+	for i, session := range []string{"busy", "busy", "busy", "quiet"} {
+		ctx := WithSession(context.Background(), session)
+		go func(session string) {
+			r, err := l.Acquire(ctx)
+			if err != nil {
+				t.Errorf("failed to acquire: %v", err)
+				return
+			}
+			order <- session
+			r()
+		}(session)
+		// let the waiter enqueue before the next
+		for l.Stats().Queued != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	release()
+
+	got := []string{}
+	for i := 0; i < 4; i++ {
+		select {
+		case s := <-order:
+			got = append(got, s)
+		case <-time.After(time.Second):
+			t.Fatalf("waiters were not granted: %v", got)
+		}
+	}
+	// the quiet session is served after the first busy query rather then after all of them
+	if got[1] != "quiet" {
+		t.Fatalf("expected quiet session to be served second got: %v", got)
+	}
+
+	stats := l.Stats()
+	if stats.Acquired != 5 || stats.Waited != 4 || stats.Running != 0 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLimiterAbandoned(t *testing.T) {
+	l := NewLimiter(1)
+	release, _ := l.Acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded got: %v", err)
+	}
+	release()
+
+	// the abandoned waiter does not hold the slot
+	r, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	r()
+	if stats := l.Stats(); stats.Abandoned != 1 || stats.Running != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLimitersHandler(t *testing.T) {
+	l := NewLimiter(1)
+	release, _ := l.Acquire(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	r, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	r()
+
+	rec := httptest.NewRecorder()
+	LimitersHandler(map[string]*Limiter{"prometheus": l})(rec, httptest.NewRequest(http.MethodGet, "/limiters", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	var res LimitersResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	stats, ok := res.Limiters["prometheus"]
+	if !ok || stats.Waited != 1 || stats.AvgWait <= 0 || stats.AvgWait != stats.MaxWait {
+		t.Fatalf("unexpected stats: %+v", res)
+	}
+}
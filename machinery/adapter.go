@@ -0,0 +1,123 @@
+package machinery
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// adapter adapts a poller's interval between min and max to the data it polls. polling backs
+// off while values do not change or queries are slow and returns to the fastest useful interval
+// once values move. the fastest useful interval is the larger of min and the resolution of the
+// data, learned from the latest timestamps at which series values change so it follows data
+// which slows down as well as data which speeds up.
+type adapter struct {
+	min time.Duration
+	max time.Duration
+
+	mu       sync.Mutex
+	interval time.Duration
+	// the latest sample of each series
+	last map[string]sample
+	// the series observed by the running poll
+	seen map[string]bool
+	// whether any series changed since the previous poll
+	changed bool
+	// the number of polls completed
+	polls int
+}
+
+type sample struct {
+	value string
+	// the timestamp and poll the value last changed at
+	changedAt int64
+	poll      int
+	// the time between changes of the series' value, zero until it changed twice
+	resolution time.Duration
+}
+
+func newAdapter(min time.Duration, max time.Duration) *adapter {
+	return &adapter{
+		min:      min,
+		max:      max,
+		interval: min,
+		last:     make(map[string]sample),
+		seen:     make(map[string]bool),
+	}
+}
+
+// observe records a polled metric
+func (a *adapter) observe(m *graphx.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.seen[m.Name] = true
+	s, ok := a.last[m.Name]
+	if ok && s.value == m.Value {
+		return
+	}
+	a.changed = true
+	next := sample{value: m.Value, changedAt: m.TimeStamp, poll: a.polls, resolution: s.resolution}
+
+	gap := time.Duration(m.TimeStamp-s.changedAt) * time.Second
+	switch {
+	case !ok || gap <= 0:
+	case a.polls-s.poll > 1:
+		// the value held for at least a poll, the gap measures the data
+		next.resolution = gap
+	case s.resolution == 0 || gap < s.resolution:
+		// the value changed on consecutive polls, the data may be faster then the gap
+		next.resolution = gap
+	}
+	a.last[m.Name] = next
+}
+
+// polled returns the interval to poll at after a poll which took d and whose metrics were observed
+func (a *adapter) polled(d time.Duration) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.polls++
+
+	// series missing from the poll are forgotten. a poll without results, such as one whose
+	// query failed, says nothing about them
+	if len(a.seen) > 0 {
+		for name := range a.last {
+			if !a.seen[name] {
+				delete(a.last, name)
+			}
+		}
+		a.seen = make(map[string]bool)
+	}
+
+	// the resolution of the fastest changing series
+	var resolution time.Duration
+	for _, s := range a.last {
+		if s.resolution > 0 && (resolution == 0 || s.resolution < resolution) {
+			resolution = s.resolution
+		}
+	}
+	floor := a.min
+	if resolution > floor {
+		floor = resolution
+	}
+
+	switch {
+	case d > a.interval/2:
+		// the query takes a significant share of the interval, give the datasource room
+		a.interval *= 2
+	case !a.changed:
+		a.interval *= 2
+	default:
+		a.interval = floor
+	}
+	a.changed = false
+
+	if a.interval < floor {
+		a.interval = floor
+	}
+	if a.interval > a.max {
+		a.interval = a.max
+	}
+	return a.interval
+}
@@ -0,0 +1,121 @@
+package machinery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// poll is the metrics returned by a single poll and how long it took
+type poll struct {
+	metrics []*graphx.Metric
+	took    time.Duration
+}
+
+func sampled(ts int64, value string) *graphx.Metric {
+	return &graphx.Metric{Name: "web_1", TimeStamp: ts, Value: value}
+}
+
+var AdapterTT = []struct {
+	name     string
+	polls    []poll
+	expected []time.Duration
+}{
+	{
+		name: "backs off while values do not change",
+		polls: []poll{
+			{metrics: []*graphx.Metric{sampled(0, "1")}},
+			{metrics: []*graphx.Metric{sampled(1, "1")}},
+			{metrics: []*graphx.Metric{sampled(3, "1")}},
+			{metrics: []*graphx.Metric{sampled(7, "1")}},
+			{metrics: []*graphx.Metric{sampled(15, "1")}},
+		},
+		expected: []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second},
+	},
+	{
+		name: "speeds up once values move",
+		polls: []poll{
+			{metrics: []*graphx.Metric{sampled(0, "1")}},
+			{metrics: []*graphx.Metric{sampled(1, "1")}},
+			{metrics: []*graphx.Metric{sampled(3, "2")}},
+		},
+		expected: []time.Duration{1 * time.Second, 2 * time.Second, 3 * time.Second},
+	},
+	{
+		name: "learns the resolution of the data",
+		polls: []poll{
+			{metrics: []*graphx.Metric{sampled(0, "1")}},
+			{metrics: []*graphx.Metric{sampled(5, "2")}},
+			{metrics: []*graphx.Metric{sampled(6, "2")}},
+			{metrics: []*graphx.Metric{sampled(10, "3")}},
+		},
+		expected: []time.Duration{1 * time.Second, 5 * time.Second, 8 * time.Second, 5 * time.Second},
+	},
+	{
+		name: "raises the resolution once the data slows",
+		polls: []poll{
+			{metrics: []*graphx.Metric{sampled(0, "1")}},
+			{metrics: []*graphx.Metric{sampled(1, "2")}},
+			{metrics: []*graphx.Metric{sampled(2, "2")}},
+			{metrics: []*graphx.Metric{sampled(4, "2")}},
+			{metrics: []*graphx.Metric{sampled(8, "3")}},
+		},
+		expected: []time.Duration{1 * time.Second, 1 * time.Second, 2 * time.Second, 4 * time.Second, 7 * time.Second},
+	},
+	{
+		name: "keeps the resolution while slow queries stretch the interval",
+		polls: []poll{
+			{metrics: []*graphx.Metric{sampled(0, "1")}},
+			{metrics: []*graphx.Metric{sampled(1, "2")}, took: 800 * time.Millisecond},
+			{metrics: []*graphx.Metric{sampled(3, "3")}},
+		},
+		expected: []time.Duration{1 * time.Second, 2 * time.Second, 1 * time.Second},
+	},
+	{
+		name: "backs off from slow queries",
+		polls: []poll{
+			{metrics: []*graphx.Metric{sampled(0, "1")}, took: 800 * time.Millisecond},
+			{metrics: []*graphx.Metric{sampled(1, "2")}, took: 1500 * time.Millisecond},
+			{metrics: []*graphx.Metric{sampled(2, "3")}, took: 100 * time.Millisecond},
+		},
+		expected: []time.Duration{2 * time.Second, 4 * time.Second, 1 * time.Second},
+	},
+}
+
+func TestAdapter(t *testing.T) {
+	for _, tt := range AdapterTT {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAdapter(1*time.Second, 8*time.Second)
+			for i, p := range tt.polls {
+				for _, m := range p.metrics {
+					a.observe(m)
+				}
+				got := a.polled(p.took)
+				if got != tt.expected[i] {
+					t.Fatalf("poll %d: got: %v want: %v", i, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAdapterForgetsSeries(t *testing.T) {
+	a := newAdapter(1*time.Second, 8*time.Second)
+	a.observe(&graphx.Metric{Name: "web_1", TimeStamp: 0, Value: "1"})
+	a.observe(&graphx.Metric{Name: "web_2", TimeStamp: 0, Value: "1"})
+	a.polled(0)
+
+	// a poll without results keeps every series
+	a.polled(0)
+	if len(a.last) != 2 {
+		t.Fatalf("expected both series to be kept got %v", a.last)
+	}
+
+	// web_1 left the query results
+	a.observe(&graphx.Metric{Name: "web_2", TimeStamp: 2, Value: "1"})
+	a.polled(0)
+	if _, ok := a.last["web_1"]; ok || len(a.last) != 1 {
+		t.Fatalf("expected only web_2 to be kept got %v", a.last)
+	}
+}
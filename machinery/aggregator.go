@@ -2,6 +2,10 @@ package machinery
 
 import (
 	"context"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/cloudscaleorg/graphx"
@@ -9,6 +13,9 @@ import (
 	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
 )
 
+// oversample is how many times more points than a backfill's MaxPoints a range query may return
+const oversample = 4
+
 // Aggregator implements the Streamer interface.
 // Aggregator is instantiated with a list of Charts, merges those charts
 // and then starts the necessary Queries. each Querier is provided a
@@ -17,61 +24,682 @@ type aggregator struct {
 	AggregatorOpts
 	// an id representing this streaming session
 	id string
-	// the metrics channel Queriers will deliver metrics on
-	mChan chan *graphx.Metric
+	// the session context, derived from the context NewAggregator was provided.
+	// Recv ends the stream once it is done
+	ctx    context.Context
+	cancel context.CancelFunc
+	// closed once the stream has ended and every hub subscription was released
+	released chan struct{}
+	// the queue the hub delivers metrics on
+	q *Queue
 	// the error channel Queriers will deliver errors on
 	eChan chan error
+	// suppresses samples which were already delivered
+	dedup *dedup
+	// tracks the series present in query results
+	presence *presence
+	// evaluates derived chart metrics
+	deriver *deriver
+	// applies the transforms of chart metrics
+	transformer *transformer
+	// aggregates the series of charts with an aggregation
+	combiner *combiner
+	// metrics and series events waiting to be returned by Recv. only accessed by Recv
+	outputs []output
+	// protects the fields below along with PollInterval, Charts and Names
+	mu sync.RWMutex
+	// the set of names metrics are delivered for
+	names map[string]struct{}
+	// the running hub subscriptions and queriers keyed by chart name
+	pollers map[string]*chartPoller
+	// the number of hub subscriptions not yet released
+	live int
+	// why the stream ended, empty while it is running
+	reason graphx.EndReason
+	// set once watch observed the session context is done
+	stopped bool
+	// stops delivering alerts, set when an AlertSource is watched
+	unwatch func()
+}
+
+// output is a metric or a series event waiting to be returned by Recv
+type output struct {
+	m   *graphx.Metric
+	err error
+}
+
+// chartPoller is the hub subscriptions and queriers of a single chart
+type chartPoller struct {
+	chart *graphx.Chart
+	// the interval the chart is polled at and its upper bound when adaptive
+	interval    time.Duration
+	maxInterval time.Duration
+	subs        []*Subscription
+	queriers    []graphx.Querier
+	// the chart's derived chart metrics
+	derived []*derivation
+	cancel  context.CancelFunc
 }
 
 // AggregatorOpts are the options for an aggregator
 type AggregatorOpts struct {
 	PollInterval time.Duration
-	Charts       []*graphx.Chart
+	// the upper bound of an adaptive poll interval. zero polls at PollInterval
+	MaxPollInterval time.Duration
+	Charts          []*graphx.Chart
+	// the names to deliver metrics for. metrics for any other name are discarded
+	Names        []string
 	ChartMetrics map[string][]*graphx.ChartMetric
 	PromClient   promapi.API
+	// the hub polling is shared through. a private hub is created if nil
+	Hub *Hub
+	// the options of a private hub
+	HubOpts HubOpts
+	// the policy applied once BufferSize metrics are buffered for the client
+	Backpressure graphx.Backpressure
+	BufferSize   int
+	// how long a series may go without a delivery before its latest sample is sent again.
+	// zero only delivers samples whose value changed
+	Keepalive time.Duration
+	// how long a series may be missing from query results before it is removed.
+	// zero removes series missing from two polls at the longest interval a chart is polled at
+	SeriesGrace time.Duration
+	// the number of points each backfilled series is downsampled to with Downsample. zero keeps every point
+	MaxPoints  int
+	Downsample graphx.Downsample
+	// delivers the alerts of the streamed charts which fire or resolve. may be nil
+	Alerts graphx.AlertSource
 }
 
 // NewAggregator creates an aggregator Streamer. make sure to cancel ctx
-// to not leak go routines.
+// or Close the streamer to not leak go routines.
 func NewAggregator(ctx context.Context, id string, opts AggregatorOpts) graphx.Streamer {
-	// TODO: determine best size for buffered channel.
-	mChan := make(chan *graphx.Metric, 1024)
-	eChan := make(chan error, 1024)
+	if opts.Hub == nil {
+		opts.Hub = NewHub(opts.PromClient, opts.HubOpts)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	a := &aggregator{
+		AggregatorOpts: opts,
+		id:             id,
+		ctx:            ctx,
+		cancel:         cancel,
+		released:       make(chan struct{}),
+		q:              NewQueue(opts.Backpressure, opts.BufferSize),
+		eChan:          make(chan error, 1024),
+		dedup:          newDedup(opts.Keepalive),
+		presence:       newPresence(),
+		deriver:        newDeriver(),
+		transformer:    newTransformer(),
+		combiner:       newCombiner(),
+		names:          nameSet(opts.Names),
+		pollers:        make(map[string]*chartPoller),
+	}
+
+	a.mu.Lock()
+	for _, chart := range opts.Charts {
+		a.start(chart)
+	}
+	// every subscription failed, there is nothing to stream
+	if a.live == 0 {
+		a.end(graphx.EndFinished)
+	}
+	a.mu.Unlock()
+
+	// alerts already firing are delivered first
+	if opts.Alerts != nil {
+		a.unwatch = opts.Alerts.Watch(a.alerted)
+		for _, al := range opts.Alerts.Alerts() {
+			if al.State == graphx.AlertFiring {
+				a.alerted(al)
+			}
+		}
+	}
+
+	go a.watch()
+	return a
+}
+
+// watch records why the session context is done and releases Recv once
+// every hub subscription has been released
+func (a *aggregator) watch() {
+	<-a.ctx.Done()
+	if a.unwatch != nil {
+		a.unwatch()
+	}
 
-	chartMetrics := graphx.DatasourceTranspose(opts.Charts)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.reason == "" {
+		a.reason = graphx.EndCancelled
+	}
+	a.stopped = true
+	if a.live == 0 {
+		close(a.released)
+	}
+}
+
+// end cancels the session with the provided reason unless it already ended. callers must hold mu.
+func (a *aggregator) end(reason graphx.EndReason) {
+	if a.reason != "" {
+		return
+	}
+	if a.ctx.Err() != nil {
+		// the parent context was cancelled before watch recorded it
+		reason = graphx.EndCancelled
+	}
+	a.reason = reason
+	a.cancel()
+}
+
+// release accounts for a hub subscription which was removed. the stream is finished once
+// its last subscription is released while it is still running.
+func (a *aggregator) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.live--
+	switch {
+	case a.live > 0:
+	case a.stopped:
+		// watch observed the context and is waiting on the last release
+		close(a.released)
+	case a.ctx.Err() == nil:
+		log.Printf("session id %s: no pollers left running. ending stream", a.id)
+		a.end(graphx.EndFinished)
+	}
+}
+
+// start subscribes to the hub for each of a chart's metrics and creates the queriers
+// used to fill the chart. callers must hold mu.
+func (a *aggregator) start(chart *graphx.Chart) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	cp := &chartPoller{
+		chart:       chart,
+		interval:    chart.Interval(a.PollInterval),
+		maxInterval: chart.Interval(a.MaxPollInterval),
+		cancel:      cancel,
+	}
+
+	// a chart with an invalid aggregation is not polled rather than streaming every series
+	if chart.Aggregation != nil {
+		if err := chart.Aggregation.Validate(); err != nil {
+			log.Printf("session id %s: invalid aggregation of chart %s: %v", a.id, chart.Name, err)
+			a.sendErr(&graphx.QueryError{Kind: graphx.QueryErrorValidation, Chart: chart.Name, Message: err.Error()})
+			a.pollers[chart.Name] = cp
+			return
+		}
+	}
+
+	chartMetrics := graphx.DatasourceTranspose([]*graphx.Chart{chart})
+
+	// chart metrics with invalid transforms are not polled
+	transforms := map[string]pipeline{}
+	for datasource, cms := range chartMetrics {
+		ps, errs := pipelines(cms)
+		for name, p := range ps {
+			transforms[name] = p
+		}
+		invalid := map[string]bool{}
+		for _, qe := range errs {
+			log.Printf("session id %s: invalid transforms of %s: %s", a.id, qe.Metric, qe.Message)
+			a.sendErr(qe)
+			invalid[qe.Metric] = true
+		}
+		valid := cms[:0]
+		for _, cm := range cms {
+			if !invalid[cm.Name] {
+				// the hub delivers metrics for the chart a chart metric names
+				cm.Chart = chart.Name
+				valid = append(valid, cm)
+			}
+		}
+		chartMetrics[datasource] = valid
+	}
 
 	for datasource, chartMetrics := range chartMetrics {
+		// derived chart metrics are evaluated from the metrics of the chart as they arrive
+		if datasource == graphx.DerivedDatasource {
+			for _, chartMetric := range chartMetrics {
+				dv, err := newDerivation(chart, chartMetric)
+				if err != nil {
+					log.Printf("session id %s: invalid derived chart metric %s: %v", a.id, chartMetric.Name, err)
+					a.sendErr(graphx.NewQueryError(graphx.QueryErrorValidation, chartMetric, err))
+					continue
+				}
+				cp.derived = append(cp.derived, dv)
+			}
+			continue
+		}
+
 		switch datasource {
 		case prometheus.Datasource:
 			pOpts := prometheus.QuerierOpts{
-				ID:           id,
-				Client:       opts.PromClient,
+				ID:           a.id,
+				Client:       a.PromClient,
 				ChartMetrics: chartMetrics,
-				MChan:        mChan,
-				EChan:        eChan,
+				EChan:        a.eChan,
+				Timeout:      a.HubOpts.Timeouts[datasource],
 			}
 
-			// create a prometheus querier and a poller and launch
+			// create a prometheus querier for range queries. live polling is shared through the hub
 			pq := prometheus.NewQuerier(pOpts)
-			poller := NewPoller(id, pq, opts.PollInterval)
-			go poller.Poll(ctx)
-		case "influxdb":
+			cp.queriers = append(cp.queriers, pq)
+		}
+
+		for _, chartMetric := range chartMetrics {
+			sub, err := a.Hub.Subscribe(graphx.WithSession(ctx, a.id), chartMetric, cp.interval, cp.maxInterval, a.q, a.eChan)
+			if err != nil {
+				log.Printf("session id %s: failed to subscribe to %s: %v", a.id, chartMetric.Name, err)
+				a.sendErr(graphx.NewQueryError(graphx.QueryErrorValidation, chartMetric, err))
+				continue
+			}
+			cp.subs = append(cp.subs, sub)
+			a.live++
+			go func() {
+				<-sub.Done
+				a.release()
+			}()
 		}
 	}
 
-	return &aggregator{
-		AggregatorOpts: opts,
-		id:             id,
-		mChan:          mChan,
-		eChan:          eChan,
+	a.deriver.start(chart.Name, cp.derived)
+	a.transformer.start(chart.Name, transforms)
+	a.combiner.start(chart.Name, chart.ChartMetrics, chart.Aggregation)
+	a.pollers[chart.Name] = cp
+}
+
+// Update implements graphx.Updater. only the subscriptions of charts which were added, removed or
+// changed are started and stopped along with those whose intervals change with the poll intervals.
+func (a *aggregator) Update(charts []*graphx.Chart, cd graphx.ChartsDescriptor) (*graphx.Diff, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.reason != "" {
+		return nil, &graphx.EndOfStream{Reason: a.reason, Err: a.ctx.Err()}
+	}
+
+	diff := &graphx.Diff{}
+
+	pollInterval := time.Duration(cd.PollInterval)
+	if pollInterval != a.PollInterval {
+		diff.PollInterval = cd.PollInterval
 	}
+	a.PollInterval = pollInterval
+
+	maxPollInterval := time.Duration(cd.MaxPollInterval)
+	if maxPollInterval != a.MaxPollInterval {
+		diff.MaxPollInterval = cd.MaxPollInterval
+	}
+	a.MaxPollInterval = maxPollInterval
+
+	keepalive := time.Duration(cd.Keepalive)
+	if keepalive != a.Keepalive {
+		diff.Keepalive = cd.Keepalive
+		a.dedup.setKeepalive(keepalive)
+	}
+	a.Keepalive = keepalive
+
+	seriesGrace := time.Duration(cd.SeriesGrace)
+	if seriesGrace != a.SeriesGrace {
+		diff.SeriesGrace = cd.SeriesGrace
+	}
+	a.SeriesGrace = seriesGrace
+	a.MaxPoints = cd.MaxPoints
+	a.Downsample = cd.Downsample
+
+	next := make(map[string]*graphx.Chart, len(charts))
+	for _, chart := range charts {
+		next[chart.Name] = chart
+	}
+
+	running := make(map[string]bool, len(a.pollers))
+	for name, cp := range a.pollers {
+		running[name] = true
+		chart, ok := next[name]
+		switch {
+		case !ok:
+			diff.ChartsRemoved = append(diff.ChartsRemoved, name)
+		case !reflect.DeepEqual(chart, cp.chart):
+			diff.ChartsChanged = append(diff.ChartsChanged, name)
+		case chart.Interval(pollInterval) == cp.interval && chart.Interval(maxPollInterval) == cp.maxInterval:
+			// unaffected, keep polling
+			continue
+		}
+		cp.cancel()
+		a.deriver.stop(name)
+		a.transformer.stop(name)
+		a.combiner.stop(name)
+		delete(a.pollers, name)
+	}
+	for name, chart := range next {
+		if _, ok := a.pollers[name]; ok {
+			continue
+		}
+		if !running[name] {
+			diff.ChartsAdded = append(diff.ChartsAdded, name)
+		}
+		a.start(chart)
+	}
+	a.Charts = charts
+
+	names := nameSet(cd.Names)
+	for name := range names {
+		if _, ok := a.names[name]; !ok {
+			diff.NamesAdded = append(diff.NamesAdded, name)
+		}
+	}
+	for name := range a.names {
+		if _, ok := names[name]; !ok {
+			diff.NamesRemoved = append(diff.NamesRemoved, name)
+		}
+	}
+	a.names = names
+	a.Names = cd.Names
+	a.dedup.retain(names)
+	a.deriver.retain(names)
+	a.transformer.retain(names)
+	a.combiner.retain(names)
+
+	// series the client stopped streaming are forgotten rather than removed
+	chartMetrics := make(map[metricKey]struct{})
+	for _, chart := range charts {
+		for _, cm := range chart.ChartMetrics {
+			chartMetrics[metricKey{chart: chart.Name, metric: cm.Name}] = struct{}{}
+		}
+	}
+	a.presence.retain(func(key seriesKey) bool {
+		_, ok := names[key.name]
+		_, cok := chartMetrics[metricKey{chart: key.chart, metric: key.metric}]
+		return ok && cok
+	})
+
+	sort.Strings(diff.ChartsAdded)
+	sort.Strings(diff.ChartsRemoved)
+	sort.Strings(diff.ChartsChanged)
+	sort.Strings(diff.NamesAdded)
+	sort.Strings(diff.NamesRemoved)
+	return diff, nil
+}
+
+// Fill retrieves historical metrics from every querier supporting range queries, stepping at
+// the interval each chart is polled at. the series of charts with an aggregation are aggregated
+// after they were transformed. with MaxPoints the step is lengthened to avoid
+// retrieving far more points than are delivered and each series is downsampled to fit.
+func (a *aggregator) Fill(ctx context.Context, from time.Time) ([]*graphx.Series, error) {
+	type chartFill struct {
+		chart    string
+		queriers []graphx.Querier
+		step     time.Duration
+		derived  []*derivation
+	}
+
+	a.mu.RLock()
+	fills := make([]chartFill, 0, len(a.pollers))
+	for _, cp := range a.pollers {
+		fills = append(fills, chartFill{cp.chart.Name, cp.queriers, cp.interval, cp.derived})
+	}
+	maxPoints, method := a.MaxPoints, a.Downsample
+	a.mu.RUnlock()
+
+	ctx = graphx.WithSession(ctx, a.id)
+	now := time.Now()
+	series := []*graphx.Series{}
+
+	for _, f := range fills {
+		chartSeries := []*graphx.Series{}
+		for _, q := range f.queriers {
+			rq, ok := q.(graphx.RangeQuerier)
+			if !ok {
+				continue
+			}
+
+			s, err := rq.QueryRange(ctx, from, now, fillStep(f.step, now.Sub(from), maxPoints))
+			if err != nil {
+				return nil, err
+			}
+			chartSeries = append(chartSeries, s...)
+		}
+		for _, dv := range f.derived {
+			chartSeries = append(chartSeries, dv.derive(chartSeries)...)
+		}
+
+		wanted := chartSeries[:0]
+		for _, sr := range chartSeries {
+			if !a.wants(sr.Name) {
+				continue
+			}
+			// live samples up to the end of the backfill were already delivered
+			if n := len(sr.TimeStamps); n > 0 {
+				a.dedup.seen(f.chart, sr.Chart, sr.Name, sr.TimeStamps[n-1], sr.Values[n-1], now)
+				a.presence.known(f.chart, sr.Chart, sr.Name, sr.TimeStamps[n-1], now)
+			}
+			a.transformer.backfill(f.chart, sr)
+			wanted = append(wanted, sr)
+		}
+
+		for _, sr := range a.combiner.backfill(f.chart, wanted) {
+			if err := sr.Downsample(method, maxPoints); err != nil {
+				return nil, err
+			}
+			series = append(series, sr)
+		}
+	}
+
+	return series, nil
 }
 
 func (a *aggregator) Recv() (*graphx.Metric, error) {
+	for {
+		if len(a.outputs) > 0 {
+			o := a.outputs[0]
+			a.outputs = a.outputs[1:]
+			return o.m, o.err
+		}
+
+		now := time.Now()
+		for _, ex := range a.presence.expire(now, a.seriesGrace()) {
+			// aggregated series leave the result rather than the stream
+			if a.combiner.removed(ex.chart, ex.ev.Chart, ex.ev.Name) {
+				continue
+			}
+			a.outputs = append(a.outputs, output{err: ex.ev})
+		}
+		if len(a.outputs) > 0 {
+			continue
+		}
+
+		if it, ok := a.q.TryNext(); ok {
+			switch {
+			case it.Metric == nil:
+				// a poll completed, deliver the aggregates it completed
+				a.outputs = append(a.outputs, a.combiner.polled(it.Chart, it.Polled)...)
+			case a.wants(it.Metric.Name):
+				a.emit(it.Chart, it.Metric, now)
+				for _, dm := range a.deriver.observe(it.Chart, it.Metric) {
+					a.emit(it.Chart, dm, now)
+				}
+			}
+			continue
+		}
+
+		// wake up once a series may have been missing for the grace period
+		var expiry <-chan time.Time
+		var t *time.Timer
+		if d, ok := a.presence.next(now); ok {
+			t = time.NewTimer(d)
+			expiry = t.C
+		}
+
+		var err error
+		select {
+		case <-a.q.Ready():
+		case <-expiry:
+		case err = <-a.eChan:
+			if qe, ok := err.(*graphx.QueryError); ok {
+				a.presence.hold(qe.Chart, qe.Metric, time.Now())
+			}
+		case <-a.ctx.Done():
+			err = a.drain()
+		}
+		if t != nil {
+			t.Stop()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// emit queues a received or derived metric of chart for Recv, preceded by an event if its series
+// is new. the metrics of aggregated chart metrics are held by the combiner which reports its own events
+func (a *aggregator) emit(chart string, m *graphx.Metric, now time.Time) {
+	aggregated := a.combiner.aggregates(chart, m.Chart)
+	if ev := a.presence.observe(chart, m, now); ev != nil && !aggregated {
+		a.outputs = append(a.outputs, output{err: ev})
+	}
+	if !a.dedup.deliver(chart, m, now) {
+		return
+	}
+	tm, ok := a.transformer.metric(chart, m)
+	switch {
+	case !ok:
+	case aggregated:
+		a.combiner.hold(chart, tm)
+	default:
+		a.outputs = append(a.outputs, output{m: tm})
+	}
+}
+
+// drain returns the errors explaining why a stream finished before ending it
+func (a *aggregator) drain() error {
 	select {
-	case m := <-a.mChan:
-		return m, nil
 	case e := <-a.eChan:
-		return nil, e
+		return e
+	default:
+	}
+	<-a.released
+	return a.endOfStream()
+}
+
+// Close implements graphx.Streamer
+func (a *aggregator) Close() error {
+	a.mu.Lock()
+	a.end(graphx.EndClosed)
+	a.mu.Unlock()
+
+	<-a.released
+	return nil
+}
+
+func (a *aggregator) endOfStream() *graphx.EndOfStream {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	eos := &graphx.EndOfStream{Reason: a.reason}
+	if a.reason == graphx.EndCancelled {
+		eos.Err = a.ctx.Err()
+	}
+	return eos
+}
+
+// seriesGrace returns how long a series may be missing from query results before it is removed
+func (a *aggregator) seriesGrace() time.Duration {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.SeriesGrace > 0 {
+		return a.SeriesGrace
+	}
+	longest := a.PollInterval
+	for _, cp := range a.pollers {
+		if cp.interval > longest {
+			longest = cp.interval
+		}
+		if cp.maxInterval > longest {
+			longest = cp.maxInterval
+		}
+	}
+	return 2 * longest
+}
+
+// alerted delivers an alert of a streamed chart to Recv. alerts of series the client does
+// not stream are discarded
+func (a *aggregator) alerted(al *graphx.Alert) {
+	a.mu.RLock()
+	_, ok := a.pollers[al.Chart]
+	a.mu.RUnlock()
+	if !ok || (al.Name != "" && !a.wants(al.Name)) {
+		return
+	}
+	a.sendErr(al)
+}
+
+// sendErr delivers an error to Recv without blocking
+func (a *aggregator) sendErr(err error) {
+	select {
+	case a.eChan <- err:
+	default:
+		log.Printf("session id %s: unable to deliver error to channel: %v", a.id, err)
+	}
+}
+
+// Changes implements graphx.Adaptive
+func (a *aggregator) Changes() uint64 {
+	return a.Hub.Changes()
+}
+
+// Intervals implements graphx.Adaptive. a chart whose metrics are polled at different
+// intervals reports the shortest.
+func (a *aggregator) Intervals() map[string]graphx.Duration {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	intervals := make(map[string]graphx.Duration, len(a.pollers))
+	for name, cp := range a.pollers {
+		for _, sub := range cp.subs {
+			d := graphx.Duration(sub.Interval())
+			if cur, ok := intervals[name]; !ok || d < cur {
+				intervals[name] = d
+			}
+		}
+	}
+	return intervals
+}
+
+// Dropped implements graphx.Lossy
+func (a *aggregator) Dropped() uint64 {
+	return a.q.Dropped()
+}
+
+// wants reports whether metrics for the provided name should be delivered
+func (a *aggregator) wants(name string) bool {
+	a.mu.RLock()
+	_, ok := a.names[name]
+	a.mu.RUnlock()
+	return ok
+}
+
+// fillStep returns the step of a range query spanning span which yields at most oversample times
+// maxPoints points, leaving the downsampler detail to choose from. the step is never shorter
+// than interval and is rounded up to whole seconds
+func fillStep(interval time.Duration, span time.Duration, maxPoints int) time.Duration {
+	if maxPoints <= 0 {
+		return interval
+	}
+	step := span / time.Duration(oversample*maxPoints)
+	if rem := step % time.Second; rem != 0 {
+		step += time.Second - rem
+	}
+	if step < interval {
+		step = interval
+	}
+	return step
+}
+
+func nameSet(names []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
 	}
+	return set
 }
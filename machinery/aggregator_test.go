@@ -0,0 +1,309 @@
+package machinery
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/prometheus"
+)
+
+var EndOfStreamTT = []struct {
+	name       string
+	datasource string
+	// ends the stream, nil when the stream ends on its own
+	end    func(cancel context.CancelFunc, st graphx.Streamer)
+	reason graphx.EndReason
+}{
+	{
+		name:       "closed",
+		datasource: prometheus.Datasource,
+		end:        func(cancel context.CancelFunc, st graphx.Streamer) { st.Close() },
+		reason:     graphx.EndClosed,
+	},
+	{
+		name:       "cancelled",
+		datasource: prometheus.Datasource,
+		end:        func(cancel context.CancelFunc, st graphx.Streamer) { cancel() },
+		reason:     graphx.EndCancelled,
+	},
+	{
+		name:       "finished",
+		datasource: "unsupported",
+		reason:     graphx.EndFinished,
+	},
+}
+
+func TestEndOfStream(t *testing.T) {
+	for _, tt := range EndOfStreamTT {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub(newFakeAPI(), HubOpts{})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			chart := &graphx.Chart{
+				Name: "chart",
+				ChartMetrics: []graphx.ChartMetric{
+					{Name: "usage", Query: "cpu", Datasource: tt.datasource},
+				},
+			}
+			st := NewAggregator(ctx, "test", AggregatorOpts{
+				PollInterval: 20 * time.Millisecond,
+				Charts:       []*graphx.Chart{chart},
+				Names:        []string{"web_1"},
+				Hub:          hub,
+			})
+			if tt.end != nil {
+				tt.end(cancel, st)
+			}
+
+			eChan := make(chan error, 1)
+			go func() {
+				for {
+					_, err := st.Recv()
+					if _, ok := err.(*graphx.EndOfStream); ok {
+						eChan <- err
+						return
+					}
+				}
+			}()
+
+			var eos *graphx.EndOfStream
+			select {
+			case err := <-eChan:
+				eos = err.(*graphx.EndOfStream)
+			case <-time.After(time.Second):
+				t.Fatalf("stream did not end")
+			}
+			if eos.Reason != tt.reason {
+				t.Fatalf("got: %v want: %v", eos.Reason, tt.reason)
+			}
+
+			// every subscription is released once the stream ended
+			hub.mu.Lock()
+			n := len(hub.pollers)
+			hub.mu.Unlock()
+			if n != 0 {
+				t.Fatalf("expected no pollers after stream ended got: %d", n)
+			}
+
+			// closing an ended stream returns immediately
+			st.Close()
+		})
+	}
+}
+
+var FillStepTT = []struct {
+	name      string
+	interval  time.Duration
+	span      time.Duration
+	maxPoints int
+	expected  time.Duration
+}{
+	{
+		name:     "steps at the poll interval without a budget",
+		interval: 5 * time.Second,
+		span:     7 * 24 * time.Hour,
+		expected: 5 * time.Second,
+	},
+	{
+		name:      "lengthens the step to the budget",
+		interval:  time.Second,
+		span:      7 * 24 * time.Hour,
+		maxPoints: 1000,
+		// 604800s / 4000 points
+		expected: 152 * time.Second,
+	},
+	{
+		name:      "never steps shorter than the poll interval",
+		interval:  10 * time.Second,
+		span:      time.Hour,
+		maxPoints: 1000,
+		expected:  10 * time.Second,
+	},
+}
+
+func TestFillStep(t *testing.T) {
+	for _, tt := range FillStepTT {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fillStep(tt.interval, tt.span, tt.maxPoints); got != tt.expected {
+				t.Fatalf("got: %v want: %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQueryErrorsRouted(t *testing.T) {
+	hub := NewHub(newFakeAPI(), HubOpts{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// both charts run the same failing query through a single shared poller
+	charts := []*graphx.Chart{
+		{Name: "cpu", ChartMetrics: []graphx.ChartMetric{{Name: "usage", Datasource: prometheus.Datasource}}},
+		{Name: "mem", ChartMetrics: []graphx.ChartMetric{{Name: "rss", Datasource: prometheus.Datasource}}},
+	}
+	st := NewAggregator(ctx, "test", AggregatorOpts{
+		PollInterval: 20 * time.Millisecond,
+		Charts:       charts,
+		Names:        []string{"web_1"},
+		Hub:          hub,
+	})
+	defer st.Close()
+
+	errs := make(chan *graphx.QueryError, 16)
+	go func() {
+		for {
+			_, err := st.Recv()
+			if _, ok := err.(*graphx.EndOfStream); ok {
+				return
+			}
+			if qe, ok := err.(*graphx.QueryError); ok {
+				errs <- qe
+			}
+		}
+	}()
+
+	seen := map[string]string{}
+	deadline := time.After(time.Second)
+	for len(seen) < 2 {
+		select {
+		case qe := <-errs:
+			if qe.Kind != graphx.QueryErrorValidation {
+				t.Fatalf("expected a validation error got %+v", qe)
+			}
+			seen[qe.Chart] = qe.Metric
+		case <-deadline:
+			t.Fatalf("expected an error attributed to each chart got %v", seen)
+		}
+	}
+	if seen["cpu"] != "usage" || seen["mem"] != "rss" {
+		t.Fatalf("expected errors attributed to each chart metric got %v", seen)
+	}
+}
+
+// hubQueries returns the queries the hub is polling
+func hubQueries(hub *Hub) []string {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	var queries []string
+	for key := range hub.pollers {
+		queries = append(queries, key.query)
+	}
+	sort.Strings(queries)
+	return queries
+}
+
+func TestAggregatorUpdate(t *testing.T) {
+	hub := NewHub(newFakeAPI(), HubOpts{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chart := func(name string, query string) *graphx.Chart {
+		return &graphx.Chart{
+			Name:         name,
+			ChartMetrics: []graphx.ChartMetric{{Name: name + "_usage", Query: query, Datasource: prometheus.Datasource}},
+		}
+	}
+	st := NewAggregator(ctx, "test", AggregatorOpts{
+		PollInterval: time.Second,
+		Charts:       []*graphx.Chart{chart("cpu", "cpu"), chart("mem", "mem"), chart("net", "net")},
+		Names:        []string{"web_1"},
+		Hub:          hub,
+	})
+	defer st.Close()
+	a := st.(*aggregator)
+	a.mu.Lock()
+	cpu := a.pollers["cpu"]
+	a.mu.Unlock()
+
+	diff, err := a.Update([]*graphx.Chart{chart("cpu", "cpu"), chart("mem", "mem_2"), chart("disk", "disk")}, graphx.ChartsDescriptor{
+		ChartNames:   []string{"cpu", "mem", "disk"},
+		Names:        []string{"web_2"},
+		PollInterval: graphx.Duration(time.Second),
+	})
+	if err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	expected := &graphx.Diff{
+		ChartsAdded:   []string{"disk"},
+		ChartsRemoved: []string{"net"},
+		ChartsChanged: []string{"mem"},
+		NamesAdded:    []string{"web_2"},
+		NamesRemoved:  []string{"web_1"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("got: %+v want: %+v", diff, expected)
+	}
+
+	// the unchanged chart keeps polling in place
+	a.mu.Lock()
+	kept := a.pollers["cpu"] == cpu
+	a.mu.Unlock()
+	if !kept {
+		t.Fatalf("expected the unchanged chart to keep its poller")
+	}
+
+	want := []string{"cpu", "disk", "mem_2"}
+	deadline := time.Now().Add(time.Second)
+	for got := hubQueries(hub); !reflect.DeepEqual(got, want); got = hubQueries(hub) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the hub to poll %v got %v", want, got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAggregatorChartsSharingMetricName(t *testing.T) {
+	hub := NewHub(newFakeAPI(), HubOpts{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// both charts define a usage chart metric, only mem halves it
+	charts := []*graphx.Chart{
+		{Name: "cpu", ChartMetrics: []graphx.ChartMetric{{Name: "usage", Query: "cpu", Datasource: prometheus.Datasource}}},
+		{Name: "mem", ChartMetrics: []graphx.ChartMetric{{
+			Name: "usage", Query: "mem", Datasource: prometheus.Datasource,
+			Transforms: []graphx.Transform{{Type: graphx.TransformClamp, Max: float(0.5)}},
+		}}},
+	}
+	st := NewAggregator(ctx, "test", AggregatorOpts{
+		PollInterval: time.Second,
+		Charts:       charts,
+		Names:        []string{"web_1"},
+		Hub:          hub,
+	})
+	defer st.Close()
+
+	values := make(chan string, 16)
+	go func() {
+		for {
+			m, err := st.Recv()
+			if _, ok := err.(*graphx.EndOfStream); ok {
+				return
+			}
+			if m != nil {
+				values <- m.Value
+			}
+		}
+	}()
+
+	// each chart delivers its own sample transformed by its own transforms
+	var got []string
+	deadline := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case v := <-values:
+			got = append(got, v)
+		case <-deadline:
+			t.Fatalf("expected a sample of each chart got %v", got)
+		}
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"0.5", "1"}) {
+		t.Fatalf("expected the samples of cpu and mem got %v", got)
+	}
+}
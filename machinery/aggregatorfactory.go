@@ -10,24 +10,57 @@ import (
 
 // aggregatorFactory holds any constant runtime depedencies for an aggregator streamer.
 type aggregatorFactory struct {
+	// the hub shared by every aggregator the factory creates
+	hub *Hub
 	// prometheus client
 	pc promapi.API
+	// the options of the shared hub and private hubs
+	hubOpts HubOpts
+	// the alerts delivered to streams. may be nil
+	alerts graphx.AlertSource
 	// influx client
 	// opentsd client
 	// ...
 }
 
-func NewAggregatorFactory(promClient promapi.API) graphx.StreamerFactory {
+// NewAggregatorFactory is a constructor for an aggregator StreamerFactory.
+func NewAggregatorFactory(promClient promapi.API, opts HubOpts) graphx.StreamerFactory {
+	return NewHubAggregatorFactory(NewHub(promClient, opts), nil)
+}
+
+// NewHubAggregatorFactory is a constructor for an aggregator StreamerFactory polling through
+// an existing hub, such as the hub an Evaluator polls through. the streams it creates deliver
+// the alerts of their charts when alerts is not nil.
+func NewHubAggregatorFactory(hub *Hub, alerts graphx.AlertSource) graphx.StreamerFactory {
 	return &aggregatorFactory{
-		pc: promClient,
+		hub:     hub,
+		pc:      hub.pc,
+		hubOpts: hub.opts,
+		alerts:  alerts,
 	}
 }
 
-func (af *aggregatorFactory) NewStreamer(ctx context.Context, id string, charts []*graphx.Chart, pollInterval time.Duration) graphx.Streamer {
+func (af *aggregatorFactory) NewStreamer(ctx context.Context, id string, charts []*graphx.Chart, cd graphx.ChartsDescriptor) graphx.Streamer {
 	opts := AggregatorOpts{
-		PollInterval: pollInterval,
-		Charts:       charts,
-		PromClient:   af.pc,
+		PollInterval:    time.Duration(cd.PollInterval),
+		MaxPollInterval: time.Duration(cd.MaxPollInterval),
+		Charts:          charts,
+		Names:           cd.Names,
+		PromClient:      af.pc,
+		Hub:             af.hub,
+		HubOpts:         af.hubOpts,
+		Backpressure:    cd.Backpressure,
+		BufferSize:      cd.BufferSize,
+		Keepalive:       time.Duration(cd.Keepalive),
+		SeriesGrace:     time.Duration(cd.SeriesGrace),
+		MaxPoints:       cd.MaxPoints,
+		Downsample:      cd.Downsample,
+		Alerts:          af.alerts,
+	}
+
+	// blocking slows polling to the client's pace, which must not stall other sessions
+	if cd.Backpressure == graphx.BackpressureBlock {
+		opts.Hub = nil
 	}
 
 	streamer := NewAggregator(ctx, id, opts)
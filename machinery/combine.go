@@ -0,0 +1,520 @@
+package machinery
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// ranked is a series and the value it is ranked by
+type ranked struct {
+	name  string
+	value float64
+}
+
+// selectK returns the names of the K series an AggregateTopK or AggregateBottomK aggregation
+// keeps in rank order. series without a value rank last and ties are broken by name
+func selectK(ag graphx.Aggregation, ranks []ranked) []string {
+	sort.Slice(ranks, func(i, j int) bool {
+		vi, vj := ranks[i].value, ranks[j].value
+		switch {
+		case math.IsNaN(vi) != math.IsNaN(vj):
+			return !math.IsNaN(vi)
+		case vi == vj || math.IsNaN(vi):
+			return ranks[i].name < ranks[j].name
+		case ag.Op == graphx.AggregateBottomK:
+			return vi < vj
+		default:
+			return vi > vj
+		}
+	})
+
+	n := ag.K
+	if n > len(ranks) {
+		n = len(ranks)
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = ranks[i].name
+	}
+	return names
+}
+
+// reduce combines the values of series at a single point in time. values are never empty
+// and never NaN
+func reduce(ag graphx.Aggregation, values []float64) float64 {
+	switch ag.Op {
+	case graphx.AggregateAvg:
+		return sum(values) / float64(len(values))
+	case graphx.AggregateMin:
+		min := values[0]
+		for _, v := range values[1:] {
+			min = math.Min(min, v)
+		}
+		return min
+	case graphx.AggregateMax:
+		max := values[0]
+		for _, v := range values[1:] {
+			max = math.Max(max, v)
+		}
+		return max
+	case graphx.AggregateQuantile:
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		pos := ag.Quantile * float64(len(sorted)-1)
+		lower := int(math.Floor(pos))
+		if lower == len(sorted)-1 {
+			return sorted[lower]
+		}
+		return sorted[lower] + (sorted[lower+1]-sorted[lower])*(pos-float64(lower))
+	default:
+		return sum(values)
+	}
+}
+
+func sum(values []float64) float64 {
+	var s float64
+	for _, v := range values {
+		s += v
+	}
+	return s
+}
+
+// summed is how the series AggregateTopK and AggregateBottomK do not keep are combined
+var summed = graphx.Aggregation{Op: graphx.AggregateSum}
+
+// pointwise reduces series into a single series with a point at every timestamp any of
+// them has a value at
+func pointwise(ag graphx.Aggregation, name string, chart string, series []*graphx.Series) *graphx.Series {
+	points := map[int64][]float64{}
+	for _, s := range series {
+		for i, ts := range s.TimeStamps {
+			f, err := strconv.ParseFloat(s.Values[i], 64)
+			if err != nil || math.IsNaN(f) {
+				continue
+			}
+			points[ts] = append(points[ts], f)
+		}
+	}
+	tss := make([]int64, 0, len(points))
+	for ts := range points {
+		tss = append(tss, ts)
+	}
+	sort.Slice(tss, func(i, j int) bool { return tss[i] < tss[j] })
+
+	out := &graphx.Series{Name: name, Chart: chart}
+	for _, ts := range tss {
+		out.Append(ts, format(reduce(ag, points[ts])))
+	}
+	return out
+}
+
+// rank returns the value a series is ranked by. NaN when it has no value
+func rank(by graphx.AggregationRank, s *graphx.Series) float64 {
+	var total float64
+	var count int
+	for i := len(s.Values) - 1; i >= 0; i-- {
+		f, err := strconv.ParseFloat(s.Values[i], 64)
+		if err != nil || math.IsNaN(f) {
+			continue
+		}
+		if by != graphx.RankAvg {
+			return f
+		}
+		total += f
+		count++
+	}
+	if count == 0 {
+		return math.NaN()
+	}
+	return total / float64(count)
+}
+
+// combineSeries aggregates the series of a single chart metric
+func combineSeries(ag graphx.Aggregation, series []*graphx.Series) []*graphx.Series {
+	if len(series) == 0 {
+		return series
+	}
+	chart := series[0].Chart
+	if ag.Combines() {
+		return []*graphx.Series{pointwise(ag, string(ag.Op), chart, series)}
+	}
+
+	ranks := make([]ranked, len(series))
+	for i, s := range series {
+		ranks[i] = ranked{name: s.Name, value: rank(ag.By, s)}
+	}
+	keep := map[string]bool{}
+	for _, name := range selectK(ag, ranks) {
+		keep[name] = true
+	}
+
+	var kept, rest []*graphx.Series
+	for _, s := range series {
+		if keep[s.Name] {
+			kept = append(kept, s)
+		} else {
+			rest = append(rest, s)
+		}
+	}
+	if ag.Other != "" && len(rest) > 0 {
+		kept = append(kept, pointwise(summed, ag.Other, chart, rest))
+	}
+	return kept
+}
+
+// combineChart aggregates the series of each chart metric of a chart. series of every chart
+// metric are aggregated separately as chart metrics rarely share a unit
+func combineChart(ag graphx.Aggregation, series []*graphx.Series) []*graphx.Series {
+	byChart := map[string][]*graphx.Series{}
+	var order []string
+	for _, s := range series {
+		if _, ok := byChart[s.Chart]; !ok {
+			order = append(order, s.Chart)
+		}
+		byChart[s.Chart] = append(byChart[s.Chart], s)
+	}
+
+	combined := make([]*graphx.Series, 0, len(series))
+	for _, chart := range order {
+		combined = append(combined, combineSeries(ag, byChart[chart])...)
+	}
+	return combined
+}
+
+// combiner aggregates the live series of the chart metrics of charts with an aggregation.
+// the samples of a chart metric are held until the hub marks its poll complete and then
+// replaced with the aggregated samples. derived chart metrics are aggregated once a poll of
+// any chart metric of their chart completes. the client is told about series entering and
+// leaving the aggregated result with series events.
+type combiner struct {
+	mu sync.Mutex
+	// the aggregated chart metric names of each chart
+	charts map[string][]string
+	// the state of each aggregated chart metric
+	metrics map[metricKey]*combined
+}
+
+// combined is the state of an aggregated chart metric
+type combined struct {
+	chart string
+	ag    graphx.Aggregation
+	// whether the chart metric is derived rather than polled
+	derived bool
+	// the series present in query results keyed by name
+	series map[string]*combinedSeries
+	// the names of series which received a sample since the last flush
+	pending map[string]bool
+	// the latest timestamp of the pending samples
+	ts int64
+	// whether series were removed since the last flush
+	changed bool
+	// the output series the client was told about and the timestamp delivered last for each
+	shown map[string]int64
+}
+
+type combinedSeries struct {
+	latest *graphx.Metric
+	value  float64
+	// the sum and number of values seen, ranking RankAvg
+	sum   float64
+	count int
+}
+
+func (cs *combinedSeries) observe(m *graphx.Metric) {
+	cs.latest = m
+	cs.value = math.NaN()
+	f, err := strconv.ParseFloat(m.Value, 64)
+	if err != nil || math.IsNaN(f) {
+		return
+	}
+	cs.value = f
+	cs.sum += f
+	cs.count++
+}
+
+func (cs *combinedSeries) rank(by graphx.AggregationRank) float64 {
+	if by != graphx.RankAvg {
+		return cs.value
+	}
+	if cs.count == 0 {
+		return math.NaN()
+	}
+	return cs.sum / float64(cs.count)
+}
+
+func newCombiner() *combiner {
+	return &combiner{
+		charts:  make(map[string][]string),
+		metrics: make(map[metricKey]*combined),
+	}
+}
+
+// start aggregates the chart metrics of a chart, discarding the state of their series
+func (c *combiner) start(chart string, chartMetrics []graphx.ChartMetric, ag *graphx.Aggregation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset(chart)
+	if ag == nil {
+		return
+	}
+	names := make([]string, 0, len(chartMetrics))
+	for _, cm := range chartMetrics {
+		names = append(names, cm.Name)
+		c.metrics[metricKey{chart: chart, metric: cm.Name}] = &combined{
+			chart:   cm.Name,
+			ag:      *ag,
+			derived: cm.Expr != "",
+			series:  make(map[string]*combinedSeries),
+			pending: make(map[string]bool),
+			shown:   make(map[string]int64),
+		}
+	}
+	c.charts[chart] = names
+}
+
+// stop stops aggregating the chart metrics of a chart
+func (c *combiner) stop(chart string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset(chart)
+}
+
+// reset forgets the aggregated chart metrics of a chart. callers must hold mu.
+func (c *combiner) reset(chart string) {
+	for _, name := range c.charts[chart] {
+		delete(c.metrics, metricKey{chart: chart, metric: name})
+	}
+	delete(c.charts, chart)
+}
+
+// aggregates reports whether the series of a chart metric of chart are aggregated
+func (c *combiner) aggregates(chart string, chartMetric string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.metrics[metricKey{chart: chart, metric: chartMetric}]
+	return ok
+}
+
+// hold records the sample of an aggregated chart metric of chart until its poll completes
+func (c *combiner) hold(chart string, m *graphx.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cm, ok := c.metrics[metricKey{chart: chart, metric: m.Chart}]
+	if !ok {
+		return
+	}
+	cs, ok := cm.series[m.Name]
+	if !ok {
+		cs = &combinedSeries{}
+		cm.series[m.Name] = cs
+	}
+	cs.observe(m)
+	cm.pending[m.Name] = true
+	if m.TimeStamp > cm.ts {
+		cm.ts = m.TimeStamp
+	}
+}
+
+// polled returns the aggregated outputs of a chart metric of chart whose poll completed and of
+// the derived chart metrics of the chart, when they received samples or lost series since their
+// last flush
+func (c *combiner) polled(chart string, chartMetric string) []output {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.metrics[metricKey{chart: chart, metric: chartMetric}]; !ok {
+		return nil
+	}
+	var outs []output
+	for _, name := range c.charts[chart] {
+		cm := c.metrics[metricKey{chart: chart, metric: name}]
+		if name != chartMetric && !cm.derived {
+			continue
+		}
+		if len(cm.pending) > 0 || cm.changed {
+			outs = append(outs, cm.flush()...)
+		}
+	}
+	return outs
+}
+
+// removed forgets a series missing from the query results of an aggregated chart metric of
+// chart. false when the chart metric is not aggregated
+func (c *combiner) removed(chart string, chartMetric string, name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cm, ok := c.metrics[metricKey{chart: chart, metric: chartMetric}]
+	if !ok {
+		return false
+	}
+	if _, ok := cm.series[name]; ok {
+		delete(cm.series, name)
+		delete(cm.pending, name)
+		cm.changed = true
+	}
+	return true
+}
+
+// backfill aggregates the backfilled series of a chart, seeding the state of aggregated chart
+// metrics so live samples continue the backfilled result
+func (c *combiner) backfill(chart string, series []*graphx.Series) []*graphx.Series {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byMetric := map[string][]*graphx.Series{}
+	var order []string
+	out := make([]*graphx.Series, 0, len(series))
+	for _, s := range series {
+		if _, ok := c.metrics[metricKey{chart: chart, metric: s.Chart}]; !ok {
+			out = append(out, s)
+			continue
+		}
+		if _, ok := byMetric[s.Chart]; !ok {
+			order = append(order, s.Chart)
+		}
+		byMetric[s.Chart] = append(byMetric[s.Chart], s)
+	}
+
+	for _, metric := range order {
+		cm := c.metrics[metricKey{chart: chart, metric: metric}]
+		for _, s := range byMetric[metric] {
+			cs := &combinedSeries{}
+			for i, ts := range s.TimeStamps {
+				cs.observe(&graphx.Metric{Name: s.Name, Chart: s.Chart, TimeStamp: ts, Value: s.Values[i]})
+			}
+			if cs.latest == nil {
+				continue
+			}
+			cm.series[s.Name] = cs
+			if cs.latest.TimeStamp > cm.ts {
+				cm.ts = cs.latest.TimeStamp
+			}
+		}
+		cm.pending = make(map[string]bool)
+
+		combined := combineSeries(cm.ag, byMetric[metric])
+		for _, s := range combined {
+			if n := len(s.TimeStamps); n > 0 {
+				cm.shown[s.Name] = s.TimeStamps[n-1]
+			}
+		}
+		out = append(out, combined...)
+	}
+	return out
+}
+
+// retain forgets the series of names which are no longer streamed
+func (c *combiner) retain(names map[string]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cm := range c.metrics {
+		for name := range cm.series {
+			if _, ok := names[name]; !ok {
+				delete(cm.series, name)
+				delete(cm.pending, name)
+				cm.changed = true
+			}
+		}
+	}
+}
+
+// flush aggregates the latest sample of every series. the outputs start with removed events
+// for series which left the result followed by the aggregated samples, each preceded by an
+// added event when its series entered the result. callers must hold the combiner's mu.
+func (cm *combined) flush() []output {
+	polled := len(cm.pending) > 0
+	// the output series which belong to the result and the samples delivered for them
+	result := map[string]bool{}
+	var metrics []*graphx.Metric
+
+	if cm.ag.Combines() {
+		var values []float64
+		for _, cs := range cm.series {
+			if !math.IsNaN(cs.value) {
+				values = append(values, cs.value)
+			}
+		}
+		if len(cm.series) > 0 {
+			result[string(cm.ag.Op)] = true
+		}
+		if polled && len(values) > 0 {
+			metrics = append(metrics, cm.metric(string(cm.ag.Op), reduce(cm.ag, values)))
+		}
+	} else {
+		ranks := make([]ranked, 0, len(cm.series))
+		for name, cs := range cm.series {
+			ranks = append(ranks, ranked{name: name, value: cs.rank(cm.ag.By)})
+		}
+		for _, name := range selectK(cm.ag, ranks) {
+			result[name] = true
+			// series entering the result deliver their latest sample even when it is not new
+			if _, shown := cm.shown[name]; cm.pending[name] || !shown {
+				metrics = append(metrics, cm.series[name].latest)
+			}
+		}
+
+		var values []float64
+		for name, cs := range cm.series {
+			if !result[name] && !math.IsNaN(cs.value) {
+				values = append(values, cs.value)
+			}
+		}
+		if cm.ag.Other != "" && len(cm.series) > len(result) {
+			result[cm.ag.Other] = true
+			if polled && len(values) > 0 {
+				metrics = append(metrics, cm.metric(cm.ag.Other, sum(values)))
+			}
+		}
+	}
+
+	var outs []output
+	var removed []string
+	for name := range cm.shown {
+		if !result[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		outs = append(outs, output{err: &graphx.SeriesEvent{
+			State:    graphx.SeriesRemoved,
+			Name:     name,
+			Chart:    cm.chart,
+			LastSeen: cm.shown[name],
+		}})
+		delete(cm.shown, name)
+	}
+	for _, m := range metrics {
+		if _, ok := cm.shown[m.Name]; !ok {
+			outs = append(outs, output{err: &graphx.SeriesEvent{
+				State:    graphx.SeriesAdded,
+				Name:     m.Name,
+				Chart:    cm.chart,
+				LastSeen: m.TimeStamp,
+			}})
+		}
+		cm.shown[m.Name] = m.TimeStamp
+		outs = append(outs, output{m: m})
+	}
+
+	cm.pending = make(map[string]bool)
+	cm.changed = false
+	return outs
+}
+
+// metric returns an aggregated sample at the timestamp of the latest poll
+func (cm *combined) metric(name string, value float64) *graphx.Metric {
+	return &graphx.Metric{
+		Name:      name,
+		Chart:     cm.chart,
+		TimeStamp: cm.ts,
+		Value:     format(value),
+	}
+}
@@ -0,0 +1,162 @@
+package machinery
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// usage returns a series of the usage chart metric with points ten seconds apart
+func usage(name string, values ...string) *graphx.Series {
+	s := &graphx.Series{Name: name, Chart: "usage"}
+	for i, v := range values {
+		s.Append(int64(10*(i+1)), v)
+	}
+	return s
+}
+
+var CombineTT = []struct {
+	name        string
+	aggregation graphx.Aggregation
+	// the names of the series returned and their values
+	expected map[string][]string
+}{
+	{
+		name:        "top k by latest",
+		aggregation: graphx.Aggregation{Op: graphx.AggregateTopK, K: 2},
+		expected:    map[string][]string{"web_2": {"2", "2"}, "web_3": {"3", "3"}},
+	},
+	{
+		name:        "top k by average",
+		aggregation: graphx.Aggregation{Op: graphx.AggregateTopK, K: 1, By: graphx.RankAvg},
+		expected:    map[string][]string{"web_1": {"9", "1"}},
+	},
+	{
+		name:        "bottom k with other",
+		aggregation: graphx.Aggregation{Op: graphx.AggregateBottomK, K: 1, Other: "other"},
+		expected:    map[string][]string{"web_1": {"9", "1"}, "other": {"5", "5"}},
+	},
+	{
+		name:        "sum",
+		aggregation: graphx.Aggregation{Op: graphx.AggregateSum},
+		expected:    map[string][]string{"sum": {"14", "6"}},
+	},
+	{
+		name:        "max",
+		aggregation: graphx.Aggregation{Op: graphx.AggregateMax},
+		expected:    map[string][]string{"max": {"9", "3"}},
+	},
+	{
+		name:        "median",
+		aggregation: graphx.Aggregation{Op: graphx.AggregateQuantile, Quantile: 0.5},
+		expected:    map[string][]string{"quantile": {"3", "2"}},
+	},
+}
+
+func TestCombineSeries(t *testing.T) {
+	for _, tt := range CombineTT {
+		t.Run(tt.name, func(t *testing.T) {
+			series := []*graphx.Series{usage("web_1", "9", "1"), usage("web_2", "2", "2"), usage("web_3", "3", "3")}
+			got := map[string][]string{}
+			for _, s := range combineSeries(tt.aggregation, series) {
+				if s.Chart != "usage" {
+					t.Fatalf("expected chart metric usage got %s", s.Chart)
+				}
+				got[s.Name] = s.Values
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %v got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCombinerTopK(t *testing.T) {
+	c := newCombiner()
+	c.start("cpu", []graphx.ChartMetric{{Name: "usage"}}, &graphx.Aggregation{Op: graphx.AggregateTopK, K: 1, Other: "other"})
+
+	backfilled := c.backfill("cpu", []*graphx.Series{usage("web_1", "5"), usage("web_2", "1")})
+	if len(backfilled) != 2 || backfilled[0].Name != "web_1" || backfilled[1].Name != "other" {
+		t.Fatalf("expected web_1 and other to be backfilled got %v", backfilled)
+	}
+
+	// samples are held until the poll completes
+	c.hold("cpu", operandMetric("usage", "web_1", 20, "2"))
+	c.hold("cpu", operandMetric("usage", "web_2", 20, "3"))
+
+	// web_2 overtook web_1, which is now summed into other
+	outs := c.polled("cpu", "usage")
+	var got []string
+	for _, o := range outs {
+		switch {
+		case o.m != nil:
+			got = append(got, o.m.Name+"="+o.m.Value)
+		default:
+			ev := o.err.(*graphx.SeriesEvent)
+			got = append(got, string(ev.State)+" "+ev.Name)
+		}
+	}
+	expected := []string{"removed web_1", "added web_2", "web_2=3", "other=2"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v got %v", expected, got)
+	}
+
+	c.hold("cpu", operandMetric("usage", "web_2", 30, "4"))
+	c.removed("cpu", "usage", "web_1")
+	outs = c.polled("cpu", "usage")
+	if len(outs) != 2 || outs[0].err.(*graphx.SeriesEvent).Name != "other" || outs[1].m.Value != "4" {
+		t.Fatalf("expected other to be removed once web_1 went away got %v", outs)
+	}
+}
+
+func TestCombinerPolled(t *testing.T) {
+	c := newCombiner()
+	c.start("cpu", []graphx.ChartMetric{{Name: "usage"}, {Name: "free", Query: "free"}, {Name: "total", Expr: "usage + free"}}, &graphx.Aggregation{Op: graphx.AggregateSum})
+
+	// a poll delivered over several wakeups is aggregated once it completes
+	c.hold("cpu", operandMetric("usage", "web_1", 20, "1"))
+	if outs := c.polled("cpu", "free"); len(outs) != 0 {
+		t.Fatalf("expected the poll of another chart metric to not flush usage got %v", outs)
+	}
+	c.hold("cpu", operandMetric("usage", "web_2", 20, "2"))
+	c.hold("cpu", operandMetric("total", "web_1", 20, "5"))
+
+	outs := c.polled("cpu", "usage")
+	var got []string
+	for _, o := range outs {
+		if o.m != nil {
+			got = append(got, o.m.Chart+"="+o.m.Value)
+		}
+	}
+	expected := []string{"usage=3", "total=5"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v got %v", expected, got)
+	}
+	if outs := c.polled("cpu", "usage"); len(outs) != 0 {
+		t.Fatalf("expected nothing to flush without new samples got %v", outs)
+	}
+}
+
+func TestCombinerCharts(t *testing.T) {
+	c := newCombiner()
+	ag := &graphx.Aggregation{Op: graphx.AggregateSum}
+	c.start("cpu", []graphx.ChartMetric{{Name: "usage"}}, ag)
+	c.start("memory", []graphx.ChartMetric{{Name: "usage"}}, ag)
+
+	// a chart metric name shared by two charts is aggregated separately
+	c.hold("cpu", operandMetric("usage", "web_1", 20, "1"))
+	c.hold("memory", operandMetric("usage", "web_1", 20, "5"))
+	if outs := c.polled("cpu", "usage"); len(outs) != 2 || outs[1].m.Value != "1" {
+		t.Fatalf("expected the sum of cpu got %v", outs)
+	}
+
+	// stopping one chart leaves the other aggregating
+	c.stop("cpu")
+	if c.aggregates("cpu", "usage") || !c.aggregates("memory", "usage") {
+		t.Fatalf("expected only memory to be aggregated")
+	}
+	if outs := c.polled("memory", "usage"); len(outs) != 2 || outs[1].m.Value != "5" {
+		t.Fatalf("expected the sum of memory got %v", outs)
+	}
+}
@@ -0,0 +1,86 @@
+package machinery
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// dedup suppresses samples which repeat the last sample delivered for their series. instant
+// queries are evaluated at the time of the poll, so every poll returns a newer timestamp while
+// the value stays the same until prometheus scrapes again. a sample is a repeat when its value
+// did not change or its timestamp did not advance. with a keepalive the latest sample of a
+// series is delivered once more when keepalive passed without a delivery, letting clients tell
+// a stale series from a dead one.
+type dedup struct {
+	mu        sync.Mutex
+	keepalive time.Duration
+	// the last sample delivered for each series
+	last map[seriesKey]delivery
+}
+
+type delivery struct {
+	ts    int64
+	value string
+	at    time.Time
+}
+
+func newDedup(keepalive time.Duration) *dedup {
+	return &dedup{
+		keepalive: keepalive,
+		last:      make(map[seriesKey]delivery),
+	}
+}
+
+// deliver reports whether a metric of chart should be delivered at now and records it if so
+func (d *dedup) deliver(chart string, m *graphx.Metric, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := seriesKey{chart: chart, metric: m.Chart, name: m.Name}
+	ts := m.TimeStamp
+	last, ok := d.last[key]
+	if ok && (ts <= last.ts || m.Value == last.value) {
+		if d.keepalive <= 0 || now.Sub(last.at) < d.keepalive {
+			return false
+		}
+		// a late sample sent as the keepalive must not rewind the series
+		if ts < last.ts {
+			ts = last.ts
+		}
+	}
+	d.last[key] = delivery{ts: ts, value: m.Value, at: now}
+	return true
+}
+
+// seen records the last sample of a series delivered outside of the stream, such as a backfill
+func (d *dedup) seen(chart string, chartMetric string, name string, ts int64, value string, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := seriesKey{chart: chart, metric: chartMetric, name: name}
+	if last, ok := d.last[key]; ok && last.ts >= ts {
+		return
+	}
+	d.last[key] = delivery{ts: ts, value: value, at: now}
+}
+
+// setKeepalive changes the keepalive of a running stream
+func (d *dedup) setKeepalive(keepalive time.Duration) {
+	d.mu.Lock()
+	d.keepalive = keepalive
+	d.mu.Unlock()
+}
+
+// retain forgets the series of names which are no longer streamed
+func (d *dedup) retain(names map[string]struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key := range d.last {
+		if _, ok := names[key.name]; !ok {
+			delete(d.last, key)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package machinery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/prometheus"
+)
+
+// dedupSample is a value of a single series received at a timestamp
+type dedupSample struct {
+	ts    int64
+	value string
+}
+
+var DedupTT = []struct {
+	name      string
+	keepalive time.Duration
+	// the samples received for a single series, one poll a second apart. like instant
+	// queries the timestamp is the time of the poll
+	received []dedupSample
+	expected []bool
+}{
+	{
+		name:     "suppresses unchanged values",
+		received: []dedupSample{{10, "1"}, {11, "1"}, {12, "1"}, {13, "2"}, {14, "2"}},
+		expected: []bool{true, false, false, true, false},
+	},
+	{
+		name:     "delivers a value returning to an earlier value",
+		received: []dedupSample{{10, "1"}, {11, "2"}, {12, "1"}},
+		expected: []bool{true, true, true},
+	},
+	{
+		name:     "suppresses unchanged timestamps",
+		received: []dedupSample{{10, "1"}, {10, "2"}, {11, "2"}},
+		expected: []bool{true, false, true},
+	},
+	{
+		name:     "suppresses late samples",
+		received: []dedupSample{{10, "1"}, {25, "2"}, {10, "3"}},
+		expected: []bool{true, true, false},
+	},
+	{
+		name:      "resends the latest sample after the keepalive",
+		keepalive: 2 * time.Second,
+		received:  []dedupSample{{10, "1"}, {11, "1"}, {12, "1"}, {13, "1"}, {14, "1"}, {15, "2"}},
+		expected:  []bool{true, false, true, false, true, true},
+	},
+}
+
+func TestDedup(t *testing.T) {
+	for _, tt := range DedupTT {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDedup(tt.keepalive)
+			now := time.Unix(1000, 0)
+			for i, s := range tt.received {
+				m := &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: s.ts, Value: s.value}
+				if got := d.deliver("cpu", m, now); got != tt.expected[i] {
+					t.Fatalf("sample %d: got: %v want: %v", i, got, tt.expected[i])
+				}
+				now = now.Add(time.Second)
+			}
+		})
+	}
+}
+
+// TestDedupQuerier polls a series whose value does not change through the prometheus querier,
+// which returns the evaluation time as the timestamp of every sample
+func TestDedupQuerier(t *testing.T) {
+	q := prometheus.NewQuerier(prometheus.QuerierOpts{
+		ID:           "dedup",
+		Client:       newFakeAPI(),
+		ChartMetrics: []graphx.ChartMetric{{Name: "usage", Query: "cpu", Datasource: prometheus.Datasource}},
+	}).(graphx.InstantQuerier)
+
+	d := newDedup(0)
+	now := time.Unix(1548785535, 0)
+	var delivered int
+	for i := 0; i < 3; i++ {
+		metrics, err := q.QueryInstant(context.Background(), now)
+		if err != nil {
+			t.Fatalf("failed to query: %v", err)
+		}
+		if metrics[0].TimeStamp != now.Unix() {
+			t.Fatalf("expected the sample to carry the evaluation time got %d", metrics[0].TimeStamp)
+		}
+		if d.deliver("cpu", metrics[0], now) {
+			delivered++
+		}
+		now = now.Add(time.Second)
+	}
+	if delivered != 1 {
+		t.Fatalf("expected the unchanged sample to be delivered once got %d", delivered)
+	}
+}
+
+func TestDedupSeen(t *testing.T) {
+	d := newDedup(0)
+	now := time.Unix(1000, 0)
+	d.seen("cpu", "usage", "web_1", 20, "1", now)
+
+	if d.deliver("cpu", &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 20, Value: "2"}, now) {
+		t.Fatalf("expected the last backfilled sample to be suppressed")
+	}
+	if d.deliver("cpu", &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 21, Value: "1"}, now) {
+		t.Fatalf("expected the unchanged value after the backfill to be suppressed")
+	}
+	if !d.deliver("cpu", &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 22, Value: "2"}, now) {
+		t.Fatalf("expected a changed sample after the backfill to be delivered")
+	}
+
+	d.retain(map[string]struct{}{})
+	if !d.deliver("cpu", &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 22, Value: "2"}, now) {
+		t.Fatalf("expected a forgotten series to be delivered")
+	}
+}
+
+func TestDedupCharts(t *testing.T) {
+	d := newDedup(0)
+	now := time.Unix(1000, 0)
+	m := &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 20, Value: "1"}
+
+	// a chart metric name shared by two charts are separate series
+	for _, chart := range []string{"cpu", "memory"} {
+		if !d.deliver(chart, m, now) {
+			t.Fatalf("expected the sample of %s to be delivered", chart)
+		}
+	}
+	if d.deliver("cpu", m, now) {
+		t.Fatalf("expected the repeated sample to be suppressed")
+	}
+}
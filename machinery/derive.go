@@ -0,0 +1,247 @@
+package machinery
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/internal/expr"
+)
+
+// derivation is a parsed derived chart metric
+type derivation struct {
+	cm   graphx.ChartMetric
+	expr *expr.Expr
+	// the operand timestamps the latest value of each name was evaluated from, index
+	// aligned with the expression's operands
+	evaluated map[string][]int64
+}
+
+// newDerivation parses a derived chart metric of chart. every operand must name a queried
+// chart metric of the same chart
+func newDerivation(chart *graphx.Chart, cm graphx.ChartMetric) (*derivation, error) {
+	e, err := expr.Parse(cm.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	queried := make(map[string]bool, len(chart.ChartMetrics))
+	for _, other := range chart.ChartMetrics {
+		queried[other.Name] = other.Expr == ""
+	}
+	for _, name := range e.Operands() {
+		isQueried, ok := queried[name]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("operand %s is not a chart metric of chart %s", name, chart.Name)
+		case !isQueried:
+			return nil, fmt.Errorf("operand %s is itself derived", name)
+		}
+	}
+
+	return &derivation{
+		cm:        cm,
+		expr:      e,
+		evaluated: make(map[string][]int64),
+	}, nil
+}
+
+// derive evaluates the derivation at every timestamp all operand series of a name share
+func (d *derivation) derive(series []*graphx.Series) []*graphx.Series {
+	operands := d.expr.Operands()
+	index := make(map[string]int, len(operands))
+	for i, name := range operands {
+		index[name] = i
+	}
+
+	// the operand series of each name, index aligned with operands
+	byName := map[string][]*graphx.Series{}
+	names := []string{}
+	for _, s := range series {
+		i, ok := index[s.Chart]
+		if !ok {
+			continue
+		}
+		if _, ok := byName[s.Name]; !ok {
+			byName[s.Name] = make([]*graphx.Series, len(operands))
+			names = append(names, s.Name)
+		}
+		byName[s.Name][i] = s
+	}
+
+	derived := []*graphx.Series{}
+	for _, name := range names {
+		ops := byName[name]
+		complete := true
+		points := make([]map[int64]float64, len(ops))
+		for i, s := range ops {
+			if s == nil {
+				complete = false
+				break
+			}
+			points[i] = make(map[int64]float64, len(s.TimeStamps))
+			for j, ts := range s.TimeStamps {
+				if f, err := strconv.ParseFloat(s.Values[j], 64); err == nil {
+					points[i][ts] = f
+				}
+			}
+		}
+		if !complete {
+			continue
+		}
+
+		out := &graphx.Series{Name: name, Chart: d.cm.Name}
+		values := make(map[string]float64, len(operands))
+	timestamps:
+		for _, ts := range ops[0].TimeStamps {
+			for i, op := range operands {
+				f, ok := points[i][ts]
+				if !ok {
+					continue timestamps
+				}
+				values[op] = f
+			}
+			out.Append(ts, format(d.expr.Eval(values)))
+		}
+		derived = append(derived, out)
+	}
+	return derived
+}
+
+// deriver evaluates the derived chart metrics of a session as operand samples arrive. a
+// derived chart metric is evaluated for a name once every operand delivered a newer sample
+// for the name, so operands polled from different datasources are combined once per poll
+// cycle rather than with stale samples of their slower operands.
+type deriver struct {
+	mu sync.Mutex
+	// the derivations of each chart
+	charts map[string][]*derivation
+	// the latest sample of each operand series of each chart
+	latest map[seriesKey]operandSample
+}
+
+type operandSample struct {
+	value float64
+	ts    int64
+}
+
+func newDeriver() *deriver {
+	return &deriver{
+		charts: make(map[string][]*derivation),
+		latest: make(map[seriesKey]operandSample),
+	}
+}
+
+// start evaluates the derived chart metrics of a chart, discarding the samples of its operands
+func (d *deriver) start(chart string, derivations []*derivation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reset(chart)
+	if len(derivations) == 0 {
+		return
+	}
+	d.charts[chart] = derivations
+}
+
+// stop stops evaluating the derived chart metrics of a chart
+func (d *deriver) stop(chart string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reset(chart)
+}
+
+// reset forgets the derivations of a chart and the samples of its operands. callers must hold mu.
+func (d *deriver) reset(chart string) {
+	for key := range d.latest {
+		if key.chart == chart {
+			delete(d.latest, key)
+		}
+	}
+	delete(d.charts, chart)
+}
+
+// observe records a received metric of chart and returns the derived metrics of the chart it completes
+func (d *deriver) observe(chart string, m *graphx.Metric) []*graphx.Metric {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	derivations, ok := d.charts[chart]
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(m.Value, 64)
+	if err != nil {
+		return nil
+	}
+	d.latest[seriesKey{chart: chart, metric: m.Chart, name: m.Name}] = operandSample{value: f, ts: m.TimeStamp}
+
+	var derived []*graphx.Metric
+derivations:
+	for _, dv := range derivations {
+		operands := dv.expr.Operands()
+		if !contains(operands, m.Chart) {
+			continue
+		}
+
+		last := dv.evaluated[m.Name]
+		values := make(map[string]float64, len(operands))
+		tss := make([]int64, len(operands))
+		var ts int64
+		for i, op := range operands {
+			s, ok := d.latest[seriesKey{chart: chart, metric: op, name: m.Name}]
+			if !ok || (last != nil && s.ts <= last[i]) {
+				continue derivations
+			}
+			values[op] = s.value
+			tss[i] = s.ts
+			if s.ts > ts {
+				ts = s.ts
+			}
+		}
+
+		dv.evaluated[m.Name] = tss
+		derived = append(derived, &graphx.Metric{
+			Name:      m.Name,
+			Chart:     dv.cm.Name,
+			TimeStamp: ts,
+			Value:     format(dv.expr.Eval(values)),
+		})
+	}
+	return derived
+}
+
+// retain forgets the samples of names which are no longer streamed
+func (d *deriver) retain(names map[string]struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key := range d.latest {
+		if _, ok := names[key.name]; !ok {
+			delete(d.latest, key)
+		}
+	}
+	for _, derivations := range d.charts {
+		for _, dv := range derivations {
+			for name := range dv.evaluated {
+				if _, ok := names[name]; !ok {
+					delete(dv.evaluated, name)
+				}
+			}
+		}
+	}
+}
+
+// format formats a value the way prometheus values are delivered
+func format(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
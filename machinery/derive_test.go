@@ -0,0 +1,110 @@
+package machinery
+
+import (
+	"testing"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+var ratioChart = &graphx.Chart{
+	Name: "http",
+	ChartMetrics: []graphx.ChartMetric{
+		{Name: "errors", Query: "errors", Datasource: "prometheus"},
+		{Name: "requests", Query: "requests", Datasource: "influx"},
+		{Name: "ratio", Expr: "errors / requests"},
+	},
+}
+
+func operandMetric(chart string, name string, ts int64, value string) *graphx.Metric {
+	return &graphx.Metric{Name: name, Chart: chart, TimeStamp: ts, Value: value}
+}
+
+func TestDeriverWaitsForEveryOperand(t *testing.T) {
+	dv, err := newDerivation(ratioChart, ratioChart.ChartMetrics[2])
+	if err != nil {
+		t.Fatalf("failed to create derivation: %v", err)
+	}
+	d := newDeriver()
+	d.start(ratioChart.Name, []*derivation{dv})
+
+	if got := d.observe(ratioChart.Name, operandMetric("errors", "web_1", 10, "1")); len(got) != 0 {
+		t.Fatalf("expected nothing to be derived before requests arrive got: %v", got)
+	}
+	got := d.observe(ratioChart.Name, operandMetric("requests", "web_1", 11, "4"))
+	if len(got) != 1 || got[0].Chart != "ratio" || got[0].Name != "web_1" || got[0].Value != "0.25" || got[0].TimeStamp != 11 {
+		t.Fatalf("expected web_1 ratio of 0.25 got: %+v", got)
+	}
+
+	// a new cycle is only complete once both operands advanced
+	if got := d.observe(ratioChart.Name, operandMetric("errors", "web_1", 20, "2")); len(got) != 0 {
+		t.Fatalf("expected nothing to be derived from a stale requests sample got: %v", got)
+	}
+	if got := d.observe(ratioChart.Name, operandMetric("requests", "web_1", 11, "4")); len(got) != 0 {
+		t.Fatalf("expected nothing to be derived from a repeated requests sample got: %v", got)
+	}
+	got = d.observe(ratioChart.Name, operandMetric("requests", "web_1", 21, "8"))
+	if len(got) != 1 || got[0].Value != "0.25" || got[0].TimeStamp != 21 {
+		t.Fatalf("expected web_1 ratio of 0.25 got: %+v", got)
+	}
+
+	// names are matched independently
+	if got := d.observe(ratioChart.Name, operandMetric("errors", "web_2", 21, "1")); len(got) != 0 {
+		t.Fatalf("expected nothing to be derived for web_2 got: %v", got)
+	}
+
+	d.stop(ratioChart.Name)
+	if got := d.observe(ratioChart.Name, operandMetric("requests", "web_2", 21, "1")); len(got) != 0 {
+		t.Fatalf("expected nothing to be derived once stopped got: %v", got)
+	}
+}
+
+func TestDerivationSeries(t *testing.T) {
+	dv, err := newDerivation(ratioChart, ratioChart.ChartMetrics[2])
+	if err != nil {
+		t.Fatalf("failed to create derivation: %v", err)
+	}
+
+	errors := &graphx.Series{Name: "web_1", Chart: "errors", TimeStamps: []int64{10, 20, 30}, Values: []string{"1", "2", "3"}}
+	requests := &graphx.Series{Name: "web_1", Chart: "requests", TimeStamps: []int64{10, 30}, Values: []string{"2", "0"}}
+	orphan := &graphx.Series{Name: "web_2", Chart: "errors", TimeStamps: []int64{10}, Values: []string{"1"}}
+
+	derived := dv.derive([]*graphx.Series{errors, requests, orphan})
+	if len(derived) != 1 {
+		t.Fatalf("expected a single derived series got: %d", len(derived))
+	}
+	s := derived[0]
+	if s.Name != "web_1" || s.Chart != "ratio" {
+		t.Fatalf("unexpected derived series: %+v", s)
+	}
+	// only shared timestamps are evaluated
+	if len(s.TimeStamps) != 2 || s.TimeStamps[0] != 10 || s.TimeStamps[1] != 30 || s.Values[0] != "0.5" || s.Values[1] != "+Inf" {
+		t.Fatalf("unexpected derived points: %v %v", s.TimeStamps, s.Values)
+	}
+}
+
+func TestDerivationInvalid(t *testing.T) {
+	for _, expr := range []string{"errors / latency", "ratio * 2", "errors /"} {
+		if _, err := newDerivation(ratioChart, graphx.ChartMetric{Name: "bad", Expr: expr}); err == nil {
+			t.Fatalf("expected %q to be invalid", expr)
+		}
+	}
+}
+
+func TestDeriverCharts(t *testing.T) {
+	dv, err := newDerivation(ratioChart, ratioChart.ChartMetrics[2])
+	if err != nil {
+		t.Fatalf("failed to create derivation: %v", err)
+	}
+	d := newDeriver()
+	d.start(ratioChart.Name, []*derivation{dv})
+
+	// an operand of another chart sharing the chart metric name is not an operand of the derivation
+	d.observe(ratioChart.Name, operandMetric("errors", "web_1", 10, "1"))
+	if got := d.observe("grpc", operandMetric("requests", "web_1", 11, "4")); len(got) != 0 {
+		t.Fatalf("expected nothing to be derived from another chart got: %v", got)
+	}
+	got := d.observe(ratioChart.Name, operandMetric("requests", "web_1", 11, "2"))
+	if len(got) != 1 || got[0].Value != "0.5" {
+		t.Fatalf("expected web_1 ratio of 0.5 got: %+v", got)
+	}
+}
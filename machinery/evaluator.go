@@ -0,0 +1,546 @@
+package machinery
+
+import (
+	"context"
+	"log"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+const (
+	// DefaultEvaluationInterval is how often alert rules are evaluated when not configured
+	DefaultEvaluationInterval = 30 * time.Second
+	// EvaluatorSession is the session the queries of an Evaluator are issued for
+	EvaluatorSession = "evaluator"
+)
+
+// EvaluatorOpts are the options for an Evaluator
+type EvaluatorOpts struct {
+	// the interval chart metrics with alert rules are polled and evaluated at
+	Interval time.Duration
+	// how often the chart store is read for added, changed and removed rules. defaults to Interval
+	Reload time.Duration
+}
+
+// Evaluator evaluates the alert rules of the charts in a chart store in the background. chart
+// metrics are polled through a hub, sharing pollers with sessions streaming the same query at
+// the same interval, and are derived and transformed the way sessions receive them before
+// their rules are evaluated.
+type Evaluator struct {
+	EvaluatorOpts
+	hub *Hub
+	cs  graphx.ChartStore
+
+	mu sync.Mutex
+	// the charts with alert rules keyed by chart name
+	charts map[string]*evaluatedChart
+	// the valid rules of each chart metric
+	rules map[metricKey][]graphx.AlertRule
+	// the state of each rule of each series
+	alerts map[alertKey]*alertState
+	// called with every alert which fires or resolves
+	watchers    map[int]func(*graphx.Alert)
+	nextWatcher int
+}
+
+// evaluatedChart is a chart with alert rules and the pipeline its chart metrics are received
+// through. chart metric names are only unique within a chart, so every chart is polled on its
+// own queue
+type evaluatedChart struct {
+	chart  *graphx.Chart
+	cancel context.CancelFunc
+	// the queue the hub delivers metrics on and the channel it delivers query errors on
+	q     *Queue
+	eChan chan error
+	// evaluates derived chart metrics
+	deriver *deriver
+	// applies the transforms of chart metrics
+	transformer *transformer
+}
+
+// alertKey identifies the alert of a rule for a series. the name is empty for AlertAbsent rules
+type alertKey struct {
+	chart  string
+	metric string
+	rule   string
+	name   string
+}
+
+// alertState is the alert of a rule for a series and what it is evaluated from
+type alertState struct {
+	rule  graphx.AlertRule
+	alert graphx.Alert
+	// when the series was last received and its latest value
+	seen  time.Time
+	value float64
+	// when the condition started holding, zero while it does not
+	since time.Time
+}
+
+// NewEvaluator is a constructor for an Evaluator polling through hub. Run starts evaluating.
+func NewEvaluator(hub *Hub, cs graphx.ChartStore, opts EvaluatorOpts) *Evaluator {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultEvaluationInterval
+	}
+	if opts.Reload <= 0 {
+		opts.Reload = opts.Interval
+	}
+	return &Evaluator{
+		EvaluatorOpts: opts,
+		hub:           hub,
+		cs:            cs,
+		charts:        make(map[string]*evaluatedChart),
+		rules:         make(map[metricKey][]graphx.AlertRule),
+		alerts:        make(map[alertKey]*alertState),
+		watchers:      make(map[int]func(*graphx.Alert)),
+	}
+}
+
+// Run evaluates alert rules until ctx is done.
+func (e *Evaluator) Run(ctx context.Context) error {
+	e.reload(ctx, time.Now())
+
+	evaluate := time.NewTicker(e.Interval)
+	defer evaluate.Stop()
+	reload := time.NewTicker(e.Reload)
+	defer reload.Stop()
+
+	for {
+		select {
+		case now := <-evaluate.C:
+			e.evaluate(now)
+		case <-reload.C:
+			e.reload(ctx, time.Now())
+		case <-ctx.Done():
+			e.mu.Lock()
+			for name := range e.charts {
+				e.stop(name)
+			}
+			e.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+// Alerts implements graphx.AlertSource
+func (e *Evaluator) Alerts() []*graphx.Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := []*graphx.Alert{}
+	for _, st := range e.alerts {
+		if st.alert.State == "" {
+			continue
+		}
+		alerts = append(alerts, st.event())
+	}
+	graphx.SortAlerts(alerts)
+	return alerts
+}
+
+// Watch implements graphx.AlertSource
+func (e *Evaluator) Watch(fn func(*graphx.Alert)) func() {
+	e.mu.Lock()
+	id := e.nextWatcher
+	e.nextWatcher++
+	e.watchers[id] = fn
+	e.mu.Unlock()
+
+	return func() {
+		e.mu.Lock()
+		delete(e.watchers, id)
+		e.mu.Unlock()
+	}
+}
+
+// reload starts evaluating charts whose rules were added or changed and stops evaluating
+// charts whose rules were removed
+func (e *Evaluator) reload(ctx context.Context, now time.Time) {
+	charts, err := e.cs.Get()
+	if err != nil {
+		log.Printf("evaluator: failed to query chart store: %v", err)
+		return
+	}
+	next := make(map[string]*graphx.Chart, len(charts))
+	for _, chart := range charts {
+		for _, cm := range chart.ChartMetrics {
+			if len(cm.Alerts) > 0 {
+				next[chart.Name] = chart
+				break
+			}
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for name, ec := range e.charts {
+		if chart, ok := next[name]; ok && reflect.DeepEqual(chart, ec.chart) {
+			continue
+		}
+		e.stop(name)
+	}
+	for name, chart := range next {
+		if _, ok := e.charts[name]; ok {
+			continue
+		}
+		e.start(ctx, chart, now)
+	}
+
+	// alerts survive a restarted chart unless their rule changed
+	for key, st := range e.alerts {
+		rules, ok := e.rules[metricKey{chart: key.chart, metric: key.metric}]
+		if !ok || !containsRule(rules, st.rule) {
+			delete(e.alerts, key)
+		}
+	}
+}
+
+// start subscribes to the chart metrics a chart's rules are evaluated from. callers must hold mu.
+func (e *Evaluator) start(ctx context.Context, chart *graphx.Chart, now time.Time) {
+	ctx, cancel := context.WithCancel(ctx)
+	ec := &evaluatedChart{
+		chart:  chart,
+		cancel: cancel,
+		// only the latest sample of a series matters to its rules
+		q:           NewQueue(graphx.BackpressureCoalesce, 0),
+		eChan:       make(chan error, 1024),
+		deriver:     newDeriver(),
+		transformer: newTransformer(),
+	}
+	e.charts[chart.Name] = ec
+
+	byDatasource := graphx.DatasourceTranspose([]*graphx.Chart{chart})
+	var all []graphx.ChartMetric
+	for _, chartMetrics := range byDatasource {
+		all = append(all, chartMetrics...)
+	}
+
+	// chart metrics with invalid transforms are not evaluated
+	transforms, errs := pipelines(all)
+	invalid := map[string]bool{}
+	for _, qe := range errs {
+		log.Printf("evaluator: invalid transforms of %s: %s", qe.Metric, qe.Message)
+		invalid[qe.Metric] = true
+	}
+	ec.transformer.start(chart.Name, transforms)
+
+	for _, cm := range all {
+		if invalid[cm.Name] {
+			continue
+		}
+		var rules []graphx.AlertRule
+		names := map[string]bool{}
+		for _, rule := range cm.Alerts {
+			if err := rule.Validate(); err != nil {
+				log.Printf("evaluator: invalid alert rule of %s: %v", cm.Name, err)
+				continue
+			}
+			if names[rule.Name] {
+				log.Printf("evaluator: duplicate alert rule %s of %s", rule.Name, cm.Name)
+				continue
+			}
+			names[rule.Name] = true
+			rules = append(rules, rule)
+		}
+		if len(rules) > 0 {
+			e.rules[metricKey{chart: chart.Name, metric: cm.Name}] = rules
+		}
+	}
+
+	// the operands of derived chart metrics with rules are polled along with them
+	polled := map[string]bool{}
+	var derivations []*derivation
+	for _, cm := range byDatasource[graphx.DerivedDatasource] {
+		mk := metricKey{chart: chart.Name, metric: cm.Name}
+		if _, ok := e.rules[mk]; !ok {
+			continue
+		}
+		dv, err := newDerivation(chart, cm)
+		if err != nil {
+			log.Printf("evaluator: invalid derived chart metric %s: %v", cm.Name, err)
+			delete(e.rules, mk)
+			continue
+		}
+		derivations = append(derivations, dv)
+		for _, op := range dv.expr.Operands() {
+			polled[op] = true
+		}
+	}
+	ec.deriver.start(chart.Name, derivations)
+
+	for datasource, chartMetrics := range byDatasource {
+		if datasource == graphx.DerivedDatasource {
+			continue
+		}
+		for _, cm := range chartMetrics {
+			if _, ok := e.rules[metricKey{chart: chart.Name, metric: cm.Name}]; !ok && !polled[cm.Name] {
+				continue
+			}
+			_, err := e.hub.Subscribe(graphx.WithSession(ctx, EvaluatorSession), cm, e.Interval, 0, ec.q, ec.eChan)
+			if err != nil {
+				log.Printf("evaluator: failed to subscribe to %s: %v", cm.Name, err)
+			}
+		}
+	}
+
+	// an absent chart metric is measured from the moment it is polled
+	for _, cm := range all {
+		for _, rule := range e.rules[metricKey{chart: chart.Name, metric: cm.Name}] {
+			key := alertKey{chart: chart.Name, metric: cm.Name, rule: rule.Name}
+			if _, ok := e.alerts[key]; rule.Condition == graphx.AlertAbsent && !ok {
+				e.alerts[key] = newAlertState(rule, key, now)
+			}
+		}
+	}
+	go e.receive(ctx, ec)
+}
+
+// stop stops polling the chart metrics of a chart. callers must hold mu.
+func (e *Evaluator) stop(chart string) {
+	ec, ok := e.charts[chart]
+	if !ok {
+		return
+	}
+	ec.cancel()
+	for mk := range e.rules {
+		if mk.chart == chart {
+			delete(e.rules, mk)
+		}
+	}
+	delete(e.charts, chart)
+}
+
+// receive evaluates the metrics and query errors the hub delivers for a chart until ctx is done
+func (e *Evaluator) receive(ctx context.Context, ec *evaluatedChart) {
+	for {
+		if m, ok := ec.q.TryPop(); ok {
+			e.observe(ec, m, time.Now())
+			continue
+		}
+
+		select {
+		case <-ec.q.Ready():
+		case err := <-ec.eChan:
+			e.failed(ec.chart.Name, err, time.Now())
+		case <-ctx.Done():
+			ec.deriver.stop(ec.chart.Name)
+			ec.transformer.stop(ec.chart.Name)
+			return
+		}
+	}
+}
+
+// observe evaluates the rules of a received metric and of the derived metrics it completes
+func (e *Evaluator) observe(ec *evaluatedChart, m *graphx.Metric, now time.Time) {
+	var metrics []*graphx.Metric
+	if tm, ok := ec.transformer.metric(ec.chart.Name, m); ok {
+		metrics = append(metrics, tm)
+	}
+	for _, dm := range ec.deriver.observe(ec.chart.Name, m) {
+		if tm, ok := ec.transformer.metric(ec.chart.Name, dm); ok {
+			metrics = append(metrics, tm)
+		}
+	}
+
+	e.mu.Lock()
+	var events []*graphx.Alert
+	// a chart which was stopped or restarted no longer owns its rules
+	if e.charts[ec.chart.Name] == ec {
+		for _, tm := range metrics {
+			events = append(events, e.record(ec.chart.Name, tm, now)...)
+		}
+	}
+	e.mu.Unlock()
+	e.notify(events)
+}
+
+// record updates the alerts of a metric's series. callers must hold mu.
+func (e *Evaluator) record(chart string, m *graphx.Metric, now time.Time) []*graphx.Alert {
+	rules, ok := e.rules[metricKey{chart: chart, metric: m.Chart}]
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(m.Value, 64)
+	if err != nil {
+		f = math.NaN()
+	}
+
+	var events []*graphx.Alert
+	for _, rule := range rules {
+		key := alertKey{chart: chart, metric: m.Chart, rule: rule.Name, name: m.Name}
+		if rule.Condition == graphx.AlertAbsent {
+			key.name = ""
+		}
+		st, ok := e.alerts[key]
+		if !ok {
+			st = newAlertState(rule, key, now)
+			e.alerts[key] = st
+		}
+		st.seen = now
+		if rule.Condition != graphx.AlertAbsent {
+			st.value = f
+			st.alert.Value = m.Value
+		}
+		if ev := st.evaluate(now, e.Interval); ev != nil {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// evaluate evaluates every alert, firing those whose condition held for long enough and
+// evaluating absent chart metrics and series which stopped being received
+func (e *Evaluator) evaluate(now time.Time) {
+	e.mu.Lock()
+	var events []*graphx.Alert
+	for key, st := range e.alerts {
+		if ev := st.evaluate(now, e.Interval); ev != nil {
+			events = append(events, ev)
+		}
+		// series which went away are forgotten once their alert is over
+		if key.name != "" && st.stale(now, e.Interval) && st.alert.State != graphx.AlertFiring {
+			delete(e.alerts, key)
+		}
+	}
+	e.mu.Unlock()
+
+	graphx.SortAlerts(events)
+	e.notify(events)
+}
+
+// failed postpones the absence of a chart metric whose query failed. its missing samples
+// say nothing about the series
+func (e *Evaluator) failed(chart string, err error, now time.Time) {
+	qe, ok := err.(*graphx.QueryError)
+	if !ok {
+		log.Printf("evaluator: %v", err)
+		return
+	}
+	log.Printf("evaluator: %v", qe)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, st := range e.alerts {
+		if key.chart == chart && key.metric == qe.Metric {
+			st.seen = now
+		}
+	}
+}
+
+// notify calls every watcher with a copy of each event
+func (e *Evaluator) notify(events []*graphx.Alert) {
+	if len(events) == 0 {
+		return
+	}
+	e.mu.Lock()
+	watchers := make([]func(*graphx.Alert), 0, len(e.watchers))
+	for _, fn := range e.watchers {
+		watchers = append(watchers, fn)
+	}
+	e.mu.Unlock()
+
+	for _, ev := range events {
+		log.Printf("evaluator: %v", ev)
+		for _, fn := range watchers {
+			a := *ev
+			fn(&a)
+		}
+	}
+}
+
+func newAlertState(rule graphx.AlertRule, key alertKey, now time.Time) *alertState {
+	return &alertState{
+		rule: rule,
+		alert: graphx.Alert{
+			Rule:      rule.Name,
+			Chart:     key.chart,
+			Metric:    key.metric,
+			Name:      key.name,
+			Condition: rule.Condition,
+			Threshold: rule.Threshold,
+			Labels:    rule.Labels,
+		},
+		seen:  now,
+		value: math.NaN(),
+	}
+}
+
+// stale reports whether the series missed more than a poll
+func (st *alertState) stale(now time.Time, interval time.Duration) bool {
+	return now.Sub(st.seen) > 2*interval
+}
+
+// holds reports whether the rule's condition holds. once active a threshold holds until the
+// value crossed back past it by the rule's hysteresis
+func (st *alertState) holds(now time.Time, interval time.Duration) bool {
+	if st.rule.Condition == graphx.AlertAbsent {
+		return st.stale(now, interval)
+	}
+	if st.stale(now, interval) || math.IsNaN(st.value) {
+		return false
+	}
+
+	var margin float64
+	if st.alert.State == graphx.AlertPending || st.alert.State == graphx.AlertFiring {
+		margin = st.rule.Hysteresis
+	}
+	if st.rule.Condition == graphx.AlertBelow {
+		return st.value < st.rule.Threshold+margin
+	}
+	return st.value > st.rule.Threshold-margin
+}
+
+// evaluate advances the alert's state and returns an event when it fired or resolved
+func (st *alertState) evaluate(now time.Time, interval time.Duration) *graphx.Alert {
+	if !st.holds(now, interval) {
+		st.since = time.Time{}
+		switch st.alert.State {
+		case graphx.AlertFiring:
+			st.alert.State = graphx.AlertResolved
+			st.alert.ResolvedAt = now.Unix()
+			return st.event()
+		case graphx.AlertPending:
+			st.alert.State = ""
+		}
+		return nil
+	}
+
+	if st.since.IsZero() {
+		st.since = now
+		// a chart metric has been absent since it was last received
+		if st.rule.Condition == graphx.AlertAbsent {
+			st.since = st.seen
+		}
+		st.alert.State = graphx.AlertPending
+		st.alert.ActiveAt = st.since.Unix()
+		st.alert.FiredAt = 0
+		st.alert.ResolvedAt = 0
+	}
+	if st.alert.State == graphx.AlertPending && now.Sub(st.since) >= time.Duration(st.rule.For) {
+		st.alert.State = graphx.AlertFiring
+		st.alert.FiredAt = now.Unix()
+		return st.event()
+	}
+	return nil
+}
+
+// event returns a copy of the alert
+func (st *alertState) event() *graphx.Alert {
+	a := st.alert
+	return &a
+}
+
+func containsRule(rules []graphx.AlertRule, rule graphx.AlertRule) bool {
+	for _, r := range rules {
+		if reflect.DeepEqual(r, rule) {
+			return true
+		}
+	}
+	return false
+}
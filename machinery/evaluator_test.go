@@ -0,0 +1,176 @@
+package machinery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/inmem"
+	"github.com/cloudscaleorg/graphx/prometheus"
+)
+
+// step is a value received the provided time after the previous step and the state the
+// alert is expected to be in after it was evaluated
+type step struct {
+	after time.Duration
+	value float64
+	state graphx.AlertState
+}
+
+var AlertStateTT = []struct {
+	name  string
+	rule  graphx.AlertRule
+	steps []step
+}{
+	{
+		name: "fires once the condition held for the duration",
+		rule: graphx.AlertRule{Name: "hot", Condition: graphx.AlertAbove, Threshold: 10, For: graphx.Duration(20 * time.Second)},
+		steps: []step{
+			{0, 5, ""},
+			{10 * time.Second, 11, graphx.AlertPending},
+			{10 * time.Second, 12, graphx.AlertPending},
+			{10 * time.Second, 12, graphx.AlertFiring},
+			{10 * time.Second, 9, graphx.AlertResolved},
+		},
+	},
+	{
+		name: "pending alert does not fire when the condition stops holding",
+		rule: graphx.AlertRule{Name: "hot", Condition: graphx.AlertAbove, Threshold: 10, For: graphx.Duration(20 * time.Second)},
+		steps: []step{
+			{0, 11, graphx.AlertPending},
+			{10 * time.Second, 9, ""},
+			{10 * time.Second, 11, graphx.AlertPending},
+		},
+	},
+	{
+		name: "hysteresis keeps a hovering value firing",
+		rule: graphx.AlertRule{Name: "cold", Condition: graphx.AlertBelow, Threshold: 10, Hysteresis: 2},
+		steps: []step{
+			{0, 9, graphx.AlertFiring},
+			{10 * time.Second, 11, graphx.AlertFiring},
+			{10 * time.Second, 12.5, graphx.AlertResolved},
+			{10 * time.Second, 11, graphx.AlertResolved},
+		},
+	},
+}
+
+func TestAlertState(t *testing.T) {
+	interval := 10 * time.Second
+	for _, tt := range AlertStateTT {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1548785535, 0)
+			st := newAlertState(tt.rule, alertKey{chart: "cpu", metric: "usage", rule: tt.rule.Name, name: "web_1"}, now)
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				st.seen, st.value = now, s.value
+				st.evaluate(now, interval)
+				if st.alert.State != s.state {
+					t.Fatalf("step %d: expected state %q got %q", i, s.state, st.alert.State)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertStateAbsent(t *testing.T) {
+	interval := 10 * time.Second
+	now := time.Unix(1548785535, 0)
+	rule := graphx.AlertRule{Name: "gone", Condition: graphx.AlertAbsent, For: graphx.Duration(time.Minute)}
+	st := newAlertState(rule, alertKey{chart: "cpu", metric: "usage", rule: rule.Name}, now)
+
+	if st.evaluate(now.Add(30*time.Second), interval); st.alert.State != graphx.AlertPending {
+		t.Fatalf("expected a chart metric missing two polls to be pending got %q", st.alert.State)
+	}
+	ev := st.evaluate(now.Add(time.Minute), interval)
+	if ev == nil || ev.State != graphx.AlertFiring || ev.ActiveAt != now.Unix() {
+		t.Fatalf("expected a chart metric absent for a minute to fire since it was last seen got %v", ev)
+	}
+}
+
+func TestEvaluator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cs := inmem.NewChartStore()
+	cs.Store([]*graphx.Chart{{
+		Name: "cpu",
+		ChartMetrics: []graphx.ChartMetric{{
+			Name: "usage", Query: "cpu", Datasource: prometheus.Datasource,
+			Alerts: []graphx.AlertRule{{Name: "busy", Condition: graphx.AlertAbove, Threshold: 0.5, Labels: map[string]string{"severity": "page"}}},
+		}},
+	}})
+
+	e := NewEvaluator(NewHub(newFakeAPI(), HubOpts{}), cs, EvaluatorOpts{Interval: 20 * time.Millisecond})
+	fired := make(chan *graphx.Alert, 16)
+	stop := e.Watch(func(a *graphx.Alert) { fired <- a })
+	defer stop()
+	go e.Run(ctx)
+
+	select {
+	case a := <-fired:
+		if a.State != graphx.AlertFiring || a.Chart != "cpu" || a.Metric != "usage" || a.Name != "web_1" || a.Value != "1" || a.Labels["severity"] != "page" {
+			t.Fatalf("unexpected alert: %+v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("alert did not fire")
+	}
+
+	alerts := e.Alerts()
+	if len(alerts) != 1 || alerts[0].State != graphx.AlertFiring {
+		t.Fatalf("expected a single firing alert got %v", alerts)
+	}
+}
+
+func TestEvaluatorChartsSharingMetricName(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// both charts name their chart metric usage, only the rule of web holds
+	cs := inmem.NewChartStore()
+	cs.Store([]*graphx.Chart{
+		{
+			Name: "web",
+			ChartMetrics: []graphx.ChartMetric{{
+				Name: "usage", Query: "cpu", Datasource: prometheus.Datasource,
+				Alerts: []graphx.AlertRule{{Name: "busy", Condition: graphx.AlertAbove, Threshold: 0.5}},
+			}},
+		},
+		{
+			Name: "db",
+			ChartMetrics: []graphx.ChartMetric{{
+				Name: "usage", Query: "cpu", Datasource: prometheus.Datasource,
+				Alerts: []graphx.AlertRule{{Name: "busy", Condition: graphx.AlertAbove, Threshold: 5}},
+			}},
+		},
+	})
+
+	interval := 20 * time.Millisecond
+	e := NewEvaluator(NewHub(newFakeAPI(), HubOpts{}), cs, EvaluatorOpts{Interval: interval})
+	fired := make(chan *graphx.Alert, 16)
+	stop := e.Watch(func(a *graphx.Alert) { fired <- a })
+	defer stop()
+	go e.Run(ctx)
+
+	select {
+	case a := <-fired:
+		if a.Chart != "web" || a.State != graphx.AlertFiring {
+			t.Fatalf("unexpected alert: %+v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("alert did not fire")
+	}
+
+	// a few more evaluations must not fire the rule of db
+	time.Sleep(5 * interval)
+	alerts := e.Alerts()
+	if len(alerts) != 1 || alerts[0].Chart != "web" {
+		t.Fatalf("expected only the alert of web got %v", alerts)
+	}
+	e.mu.Lock()
+	rules := e.rules[metricKey{chart: "db", metric: "usage"}]
+	e.mu.Unlock()
+	if len(rules) != 1 || rules[0].Threshold != 5 {
+		t.Fatalf("expected db to keep its own rules got %v", rules)
+	}
+}
@@ -0,0 +1,350 @@
+package machinery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/prometheus"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// Hub shares polling across sessions. a single querier and poller runs for each unique
+// datasource, query and poll interval and its results are fanned out to every subscribed
+// aggregator. the poller is stopped once its last subscriber leaves.
+type Hub struct {
+	// incremented whenever an adaptive poller changes its interval. accessed atomically,
+	// first in the struct to guarantee 64 bit alignment
+	changes uint64
+
+	mu sync.Mutex
+	// prometheus client
+	pc   promapi.API
+	opts HubOpts
+	// running pollers keyed by the query they poll
+	pollers map[hubKey]*sharedPoller
+	// numbers the pollers started, keeping their ids unique
+	started int
+}
+
+// HubOpts are the options for a Hub
+type HubOpts struct {
+	// the query timeouts of each datasource
+	Timeouts Timeouts
+	// the upper bound of a random offset added to each poller's aligned ticks to spread load
+	Jitter time.Duration
+}
+
+// Timeouts are the query timeouts of each datasource keyed by datasource name. a datasource
+// without a timeout derives it from the poll interval. a ChartMetric's timeout takes precedence.
+type Timeouts map[string]time.Duration
+
+// hubKey identifies queries which may share a poller
+type hubKey struct {
+	datasource string
+	query      string
+	interval   time.Duration
+	// the upper bound of an adaptive interval. zero when the interval is fixed
+	maxInterval time.Duration
+	timeout     graphx.Duration
+}
+
+// sharedPoller is a poller and the subscribers its results are fanned out to
+type sharedPoller struct {
+	// how long the latest poll took. accessed atomically, first in the struct to
+	// guarantee 64 bit alignment
+	took   int64
+	p      *Poller
+	cancel context.CancelFunc
+	// protects subs, last and polled
+	mu   sync.RWMutex
+	subs map[*hubSub]struct{}
+	// the latest metric of each name returned by the latest poll, delivered to subscribers when they join
+	last map[string]*graphx.Metric
+	// the names returned by the running poll
+	polled map[string]bool
+	// the number of polls issued, rotating the session polls are attributed to
+	polls int
+}
+
+// hubSub is a single subscriber of a sharedPoller
+type hubSub struct {
+	// the subscriber's context. a blocked push gives up once it is done so the
+	// subscriber can be removed
+	ctx context.Context
+	// the session of the subscriber, taken from its context
+	session string
+	// the chart metric fanned out metrics and errors are attributed to
+	chartMetric graphx.ChartMetric
+	q           *Queue
+	eChan       chan error
+}
+
+// NewHub is a constructor for a Hub.
+func NewHub(promClient promapi.API, opts HubOpts) *Hub {
+	return &Hub{
+		pc:      promClient,
+		opts:    opts,
+		pollers: make(map[hubKey]*sharedPoller),
+	}
+}
+
+// Subscription is a subscriber of a Hub
+type Subscription struct {
+	// closed once the subscriber has been removed and nothing further will be delivered to it
+	Done <-chan struct{}
+	p    *Poller
+}
+
+// Interval returns the interval the subscription is currently polled at.
+func (s *Subscription) Interval() time.Duration {
+	return s.p.Interval()
+}
+
+// Subscribe delivers the results of polling a chart metric at the provided interval to q and eChan
+// until ctx is done. when maxInterval is larger then interval polling adapts between the two.
+// subscribers of an identical query and intervals share a single poller, which waits on any
+// subscriber whose queue blocks.
+func (h *Hub) Subscribe(ctx context.Context, chartMetric graphx.ChartMetric, interval time.Duration, maxInterval time.Duration, q *Queue, eChan chan error) (*Subscription, error) {
+	if maxInterval <= interval {
+		maxInterval = 0
+	}
+	key := hubKey{
+		datasource:  chartMetric.Datasource,
+		query:       chartMetric.Query,
+		interval:    interval,
+		maxInterval: maxInterval,
+		timeout:     chartMetric.Timeout,
+	}
+	session, _ := graphx.SessionFromContext(ctx)
+	sub := &hubSub{
+		ctx:         ctx,
+		session:     session,
+		chartMetric: chartMetric,
+		q:           q,
+		eChan:       eChan,
+	}
+
+	h.mu.Lock()
+	sp, ok := h.pollers[key]
+	if !ok {
+		var err error
+		sp, err = h.start(key)
+		if err != nil {
+			h.mu.Unlock()
+			return nil, err
+		}
+		h.pollers[key] = sp
+	}
+	sp.mu.Lock()
+	sp.subs[sub] = struct{}{}
+	last := make([]*graphx.Metric, 0, len(sp.last))
+	for _, m := range sp.last {
+		mm := *m
+		mm.Chart = chartMetric.Name
+		last = append(last, &mm)
+	}
+	sp.mu.Unlock()
+	h.mu.Unlock()
+
+	// a subscriber joining a running poller sees its latest results rather then waiting for the next
+	// poll. they are pushed without holding locks since a blocking queue may wait on its consumer
+	for _, m := range last {
+		q.Push(ctx, chartMetric.Chart, m)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		h.unsubscribe(key, sub)
+		close(done)
+	}()
+	return &Subscription{Done: done, p: sp.p}, nil
+}
+
+// Changes returns a count which increases whenever the interval of an adaptive poller changes.
+func (h *Hub) Changes() uint64 {
+	return atomic.LoadUint64(&h.changes)
+}
+
+// unsubscribe removes a subscriber and stops the poller if it was the last
+func (h *Hub) unsubscribe(key hubKey, sub *hubSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sp, ok := h.pollers[key]
+	if !ok {
+		return
+	}
+	sp.mu.Lock()
+	delete(sp.subs, sub)
+	empty := len(sp.subs) == 0
+	sp.mu.Unlock()
+
+	if empty {
+		sp.cancel()
+		delete(h.pollers, key)
+	}
+}
+
+// start launches the querier, poller and fan out for a query. callers must hold mu.
+func (h *Hub) start(key hubKey) (*sharedPoller, error) {
+	h.started++
+	id := fmt.Sprintf("shared.%s.%v.%d", key.datasource, key.interval, h.started)
+	ctx, cancel := context.WithCancel(context.Background())
+	sp := &sharedPoller{
+		cancel: cancel,
+		subs:   make(map[*hubSub]struct{}),
+		last:   make(map[string]*graphx.Metric),
+		polled: make(map[string]bool),
+	}
+
+	// TODO: determine best size for buffered channel.
+	mChan := make(chan *graphx.Metric, 1024)
+	eChan := make(chan error, 1024)
+
+	chartMetric := graphx.ChartMetric{
+		Query:      key.query,
+		Datasource: key.datasource,
+		Timeout:    key.timeout,
+	}
+
+	var q graphx.Querier
+	switch key.datasource {
+	case prometheus.Datasource:
+		q = prometheus.NewQuerier(prometheus.QuerierOpts{
+			ID:           id,
+			Client:       h.pc,
+			ChartMetrics: []graphx.ChartMetric{chartMetric},
+			MChan:        mChan,
+			EChan:        eChan,
+			Timeout:      h.opts.Timeouts[key.datasource],
+		})
+	default:
+		cancel()
+		return nil, fmt.Errorf("unsupported datasource %q", key.datasource)
+	}
+
+	log.Printf("hub: starting shared poller for %s query %q every %v", key.datasource, key.query, key.interval)
+	p := NewAdaptivePoller(id, q, key.interval, key.maxInterval)
+	p.Jitter = h.opts.Jitter
+	p.OnInterval = func(time.Duration) {
+		atomic.AddUint64(&h.changes, 1)
+	}
+	// polls are attributed to the sessions of the subscribers in turn, so a limiter weighs a
+	// session subscribed to many queries against the others
+	p.Session = func() string {
+		return sp.session(id)
+	}
+	// a nil metric follows the results of every poll, telling subscribers the poll is complete
+	// and the poller to adapt its interval to the results fanout observed
+	p.OnPolled = func(took time.Duration) {
+		atomic.StoreInt64(&sp.took, int64(took))
+		select {
+		case mChan <- nil:
+		case <-ctx.Done():
+		}
+	}
+	// skips are attributed to each subscriber's chart metric by fanout
+	p.OnSkip = func(running time.Duration) {
+		err := fmt.Errorf("poll skipped, previous query still running after %v", running)
+		select {
+		case eChan <- graphx.NewQueryError(graphx.QueryErrorSkipped, chartMetric, err):
+		default:
+		}
+	}
+	sp.p = p
+	go p.Poll(ctx)
+	go sp.fanout(ctx, id, mChan, eChan)
+	return sp, nil
+}
+
+// fanout delivers the poller's results to every subscriber until ctx is done
+func (sp *sharedPoller) fanout(ctx context.Context, id string, mChan chan *graphx.Metric, eChan chan error) {
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("hub id %s: last subscriber left. shared poller stopped", id)
+			return
+		case m := <-mChan:
+			if m == nil {
+				sp.mu.Lock()
+				// series missing from the poll are not replayed to joining subscribers
+				for name := range sp.last {
+					if !sp.polled[name] {
+						delete(sp.last, name)
+					}
+				}
+				sp.polled = make(map[string]bool)
+				for sub := range sp.subs {
+					sub.q.MarkPolled(sub.chartMetric.Chart, sub.chartMetric.Name)
+				}
+				sp.mu.Unlock()
+				sp.p.Polled(time.Duration(atomic.LoadInt64(&sp.took)))
+				continue
+			}
+			sp.p.Observe(m)
+			sp.mu.Lock()
+			sp.last[m.Name] = m
+			sp.polled[m.Name] = true
+			subs := sp.subscribers()
+			sp.mu.Unlock()
+			// a blocking queue may wait on its consumer, which must be able to subscribe meanwhile
+			for _, sub := range subs {
+				// each subscriber receives its own copy labeled for its chart
+				mm := *m
+				mm.Chart = sub.chartMetric.Name
+				sub.q.Push(sub.ctx, sub.chartMetric.Chart, &mm)
+			}
+		case e := <-eChan:
+			sp.mu.RLock()
+			for sub := range sp.subs {
+				if qe, ok := e.(*graphx.QueryError); ok {
+					e = qe.For(sub.chartMetric)
+				}
+				select {
+				case sub.eChan <- e:
+				default:
+					log.Printf("hub id %s: unable to deliver error to subscriber", id)
+				}
+			}
+			sp.mu.RUnlock()
+		}
+	}
+}
+
+// session returns the session the next poll is attributed to, rotating through the sessions
+// of the subscribers. id when no subscriber has a session
+func (sp *sharedPoller) session(id string) string {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sessions := make([]string, 0, len(sp.subs))
+	seen := map[string]bool{}
+	for sub := range sp.subs {
+		if sub.session != "" && !seen[sub.session] {
+			seen[sub.session] = true
+			sessions = append(sessions, sub.session)
+		}
+	}
+	if len(sessions) == 0 {
+		return id
+	}
+	sort.Strings(sessions)
+	sp.polls++
+	return sessions[sp.polls%len(sessions)]
+}
+
+// subscribers returns the current subscribers. callers must hold mu.
+func (sp *sharedPoller) subscribers() []*hubSub {
+	subs := make([]*hubSub, 0, len(sp.subs))
+	for sub := range sp.subs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
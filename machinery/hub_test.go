@@ -0,0 +1,255 @@
+package machinery
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/prometheus"
+	"github.com/prometheus/client_golang/api"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodels "github.com/prometheus/common/model"
+)
+
+// fakeAPI answers every instant query with a sample for each name and counts queries
+type fakeAPI struct {
+	promapi.API
+	mu      sync.Mutex
+	queries map[string]int
+	// the names returned by successive queries, the last repeating. web_1 when empty
+	names [][]string
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{
+		queries: make(map[string]int),
+	}
+}
+
+func (f *fakeAPI) Query(ctx context.Context, query string, ts time.Time) (prommodels.Value, api.Warnings, error) {
+	f.mu.Lock()
+	n := f.queries[query]
+	f.queries[query]++
+	names := []string{"web_1"}
+	if len(f.names) > 0 {
+		if n >= len(f.names) {
+			n = len(f.names) - 1
+		}
+		names = f.names[n]
+	}
+	f.mu.Unlock()
+
+	vector := prommodels.Vector{}
+	for _, name := range names {
+		vector = append(vector, &prommodels.Sample{
+			Metric:    prommodels.Metric{prometheus.NameTag: prommodels.LabelValue(name)},
+			Value:     1,
+			Timestamp: prommodels.TimeFromUnix(ts.Unix()),
+		})
+	}
+	return vector, nil, nil
+}
+
+func (f *fakeAPI) count(query string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries[query]
+}
+
+func TestHubSharesPollers(t *testing.T) {
+	fake := newFakeAPI()
+	hub := NewHub(fake, HubOpts{})
+	interval := 20 * time.Millisecond
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	cpu := graphx.ChartMetric{Name: "usage", Query: "cpu", Datasource: prometheus.Datasource}
+	cpuAgain := graphx.ChartMetric{Name: "total", Query: "cpu", Datasource: prometheus.Datasource}
+	q1 := NewQueue(graphx.BackpressureDropNewest, 1024)
+	q2 := NewQueue(graphx.BackpressureDropNewest, 1024)
+
+	sub1, err := hub.Subscribe(ctx1, cpu, interval, 0, q1, make(chan error, 1))
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if _, err := hub.Subscribe(ctx2, cpuAgain, interval, 0, q2, make(chan error, 1)); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	hub.mu.Lock()
+	n := len(hub.pollers)
+	hub.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected a single shared poller got: %d", n)
+	}
+
+	// each subscriber receives metrics labeled for its own chart metric
+	select {
+	case <-q1.Ready():
+		m, _ := q1.TryPop()
+		if m.Chart != "usage" || m.Name != "web_1" {
+			t.Fatalf("unexpected metric for first subscriber: %v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("first subscriber received no metrics")
+	}
+	select {
+	case <-q2.Ready():
+		m, _ := q2.TryPop()
+		if m.Chart != "total" || m.Name != "web_1" {
+			t.Fatalf("unexpected metric for second subscriber: %v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("second subscriber received no metrics")
+	}
+
+	// the poller keeps running for the remaining subscriber
+	cancel1()
+	select {
+	case <-sub1.Done:
+	case <-time.After(time.Second):
+		t.Fatalf("first subscriber was not released")
+	}
+	hub.mu.Lock()
+	n = len(hub.pollers)
+	hub.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected poller to remain for second subscriber got: %d pollers", n)
+	}
+
+	// and stops once the last subscriber leaves
+	cancel2()
+	time.Sleep(interval)
+	hub.mu.Lock()
+	n = len(hub.pollers)
+	hub.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected poller to stop after last subscriber left got: %d pollers", n)
+	}
+
+	stopped := fake.count("cpu")
+	time.Sleep(5 * interval)
+	if fake.count("cpu") != stopped {
+		t.Fatalf("expected no queries after last subscriber left")
+	}
+}
+
+func TestHubPrunesReplay(t *testing.T) {
+	fake := newFakeAPI()
+	fake.names = [][]string{{"web_1", "web_2"}, {"web_2"}}
+	hub := NewHub(fake, HubOpts{})
+	interval := 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cpu := graphx.ChartMetric{Name: "usage", Query: "cpu", Datasource: prometheus.Datasource}
+	if _, err := hub.Subscribe(ctx, cpu, interval, 0, NewQueue(graphx.BackpressureDropOldest, 1024), make(chan error, 16)); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	// wait for the second poll to complete
+	deadline := time.Now().Add(time.Second)
+	for {
+		hub.mu.Lock()
+		pruned := false
+		for _, sp := range hub.pollers {
+			sp.mu.RLock()
+			_, ok := sp.last["web_2"]
+			pruned = ok && len(sp.last) == 1
+			sp.mu.RUnlock()
+		}
+		hub.mu.Unlock()
+		if pruned {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the second poll to complete")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// web_1 went away after the first poll and is not replayed to a joining subscriber
+	q := NewQueue(graphx.BackpressureDropOldest, 1024)
+	if _, err := hub.Subscribe(ctx, cpu, interval, 0, q, make(chan error, 16)); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	m, ok := q.TryPop()
+	if !ok || m.Name != "web_2" {
+		t.Fatalf("expected web_2 to be replayed got %v", m)
+	}
+	for {
+		m, ok := q.TryPop()
+		if !ok {
+			break
+		}
+		if m.Name == "web_1" {
+			t.Fatalf("expected web_1 to not be replayed")
+		}
+	}
+}
+
+func TestHubSubscribeBlockedQueue(t *testing.T) {
+	hub := NewHub(newFakeAPI(), HubOpts{})
+	interval := 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cpu := graphx.ChartMetric{Name: "usage", Query: "cpu", Datasource: prometheus.Datasource}
+	first := NewQueue(graphx.BackpressureDropOldest, 1024)
+	if _, err := hub.Subscribe(ctx, cpu, interval, 0, first, make(chan error, 16)); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	<-first.Ready()
+
+	// a full blocking queue waits for its consumer while its latest results are replayed
+	full := NewQueue(graphx.BackpressureBlock, 1)
+	full.Push(ctx, "cpu", metric("a", "1"))
+	go hub.Subscribe(ctx, cpu, interval, 0, full, make(chan error, 16))
+	time.Sleep(interval)
+
+	subscribed := make(chan struct{})
+	go func() {
+		hub.Subscribe(ctx, cpu, interval, 0, NewQueue(graphx.BackpressureDropOldest, 1024), make(chan error, 16))
+		close(subscribed)
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected a subscriber to join while another waits on its queue")
+	}
+}
+
+func TestHubPollSessions(t *testing.T) {
+	hub := NewHub(newFakeAPI(), HubOpts{})
+	interval := time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a session subscribing twice counts once
+	cpu := graphx.ChartMetric{Name: "usage", Query: "cpu", Datasource: prometheus.Datasource}
+	for _, session := range []string{"a", "b", "b"} {
+		q := NewQueue(graphx.BackpressureDropOldest, 1024)
+		if _, err := hub.Subscribe(graphx.WithSession(ctx, session), cpu, interval, 0, q, make(chan error, 16)); err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+	}
+
+	hub.mu.Lock()
+	var sp *sharedPoller
+	for _, p := range hub.pollers {
+		sp = p
+	}
+	hub.mu.Unlock()
+
+	// polls are attributed to the subscribing sessions in turn rather than to the poller
+	got := map[string]int{}
+	for i := 0; i < 4; i++ {
+		got[sp.p.Session()]++
+	}
+	if got["a"] != 2 || got["b"] != 2 {
+		t.Fatalf("expected polls to alternate between sessions got %v", got)
+	}
+}
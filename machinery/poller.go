@@ -3,6 +3,8 @@ package machinery
 import (
 	"context"
 	"log"
+	"math/rand"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudscaleorg/graphx"
@@ -10,40 +12,181 @@ import (
 
 // Poller is reusable machinery which calls a Querier's query method at a specific interval.
 // this is useful for backend that do not provide a native streaming api such as prometheus.
+//
+// the first query is issued immediately. following queries are aligned to multiples of the
+// interval since the zero time, which for intervals dividing an hour are wall clock aligned,
+// so pollers of the same interval query together regardless of when they started.
 type Poller struct {
+	// the number of ticks skipped and the current interval. accessed atomically,
+	// first in the struct to guarantee 64 bit alignment
+	skipped  uint64
+	interval int64
 	// ID representing the unique session with a client
 	ID string
 	// the instance of a querier implementation used to query the database
 	Q graphx.Querier
 	// the interval in which we call Query() on the querier
 	PollInterval time.Duration
+	// an optional upper bound of a random offset added to every aligned tick to spread load.
+	// the offset is chosen once so the poller's ticks remain evenly spaced
+	Jitter time.Duration
+	// an optional callback invoked when a tick is skipped, provided how long the
+	// previous query has been running for
+	OnSkip func(running time.Duration)
+	// an optional callback invoked when an adaptive poller changes its interval
+	OnInterval func(interval time.Duration)
+	// an optional callback invoked once a poll's query returned, before the next poll may start.
+	// an adaptive poller is told the poll completed by calling Polled once its results are observed
+	OnPolled func(took time.Duration)
+	// optionally returns the session each poll is issued for, letting a limiter queue the polls
+	// of a poller shared by sessions fairly between them. defaults to the session of the
+	// context provided to Poll or else ID
+	Session func() string
+	// adapts the interval to the polled data, nil when the interval is fixed
+	adapter *adapter
 }
 
 // NewPoller is a contructor for a poller.
 func NewPoller(id string, q graphx.Querier, pollInterval time.Duration) *Poller {
 	return &Poller{
+		interval:     int64(pollInterval),
 		ID:           id,
 		Q:            q,
 		PollInterval: pollInterval,
 	}
 }
 
+// NewAdaptivePoller is a constructor for a poller whose interval adapts to the data it polls
+// between pollInterval and maxInterval. results must be provided to Observe and the completion
+// of each poll to Polled once its results were observed.
+func NewAdaptivePoller(id string, q graphx.Querier, pollInterval time.Duration, maxInterval time.Duration) *Poller {
+	p := NewPoller(id, q, pollInterval)
+	if maxInterval > pollInterval {
+		p.adapter = newAdapter(pollInterval, maxInterval)
+	}
+	return p
+}
+
+// Observe provides an adaptive poller with a metric returned by its querier.
+func (p *Poller) Observe(m *graphx.Metric) {
+	if p.adapter != nil {
+		p.adapter.observe(m)
+	}
+}
+
+// Polled adapts an adaptive poller's interval after a poll which took d, once the poll's
+// results were provided to Observe.
+func (p *Poller) Polled(d time.Duration) {
+	if p.adapter != nil {
+		p.adapt(d)
+	}
+}
+
+// Interval returns the interval the poller currently polls at.
+func (p *Poller) Interval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.interval))
+}
+
 // Poll is intended to be ran as a go routine and will call it's Querier query method.
+// queries never overlap, a tick arriving while the previous query is still running is skipped.
+// Poll returns once ctx is done and the running query has returned.
 func (p *Poller) Poll(ctx context.Context) {
-	t := time.NewTicker(p.PollInterval)
-	defer t.Stop()
+	// let the datasource know the interval it is polled at and who is polling
+	ctx = graphx.WithPollInterval(ctx, p.PollInterval)
+	if _, ok := graphx.SessionFromContext(ctx); !ok {
+		ctx = graphx.WithSession(ctx, p.ID)
+	}
+
+	var offset time.Duration
+	if jitter := p.Jitter; jitter > 0 {
+		if jitter > p.PollInterval {
+			jitter = p.PollInterval
+		}
+		offset = time.Duration(rand.Int63n(int64(jitter)))
+	}
+
+	// closed once the running query returns, nil while idle
+	var done chan struct{}
+	var startTS time.Time
+	poll := func() {
+		done = make(chan struct{})
+		startTS = time.Now()
+		pctx := ctx
+		if p.Session != nil {
+			pctx = graphx.WithSession(ctx, p.Session())
+		}
+		go func(done chan struct{}, startTS time.Time) {
+			defer close(done)
+			p.Q.Query(pctx)
+			took := time.Since(startTS)
+			log.Printf("poller id %s: all queries to datastore took %v", p.ID, took)
+			if ctx.Err() != nil {
+				return
+			}
+			if p.OnPolled != nil {
+				p.OnPolled(took)
+			}
+		}(done, startTS)
+	}
 
 	log.Printf("poller id %s: beginning polling at %v", p.ID, p.PollInterval)
+	poll()
+
+	t := time.NewTimer(time.Until(next(time.Now(), p.Interval(), offset)))
+	defer t.Stop()
 	for {
 		select {
 		case <-ctx.Done():
+			if done != nil {
+				<-done
+			}
 			log.Printf("poller id %s: context cancled. polling stopped", p.ID)
 			return
 		case <-t.C:
-			startTS := time.Now()
-			p.Q.Query(ctx)
-			endTS := time.Now().Sub(startTS)
-			log.Printf("poller id %s: all queries to datastore took %v", p.ID, endTS)
+			t.Reset(time.Until(next(time.Now(), p.Interval(), offset)))
+
+			select {
+			case <-done:
+				poll()
+			default:
+				p.skip(time.Since(startTS))
+			}
 		}
 	}
 }
+
+// next returns the first tick after now aligned to a multiple of interval plus offset
+func next(now time.Time, interval time.Duration, offset time.Duration) time.Time {
+	t := now.Truncate(interval).Add(offset)
+	for !t.After(now) {
+		t = t.Add(interval)
+	}
+	return t
+}
+
+// adapt updates the interval after a poll which took d
+func (p *Poller) adapt(d time.Duration) {
+	interval := p.adapter.polled(d)
+	prev := time.Duration(atomic.SwapInt64(&p.interval, int64(interval)))
+	if interval == prev {
+		return
+	}
+	log.Printf("poller id %s: adapted poll interval from %v to %v", p.ID, prev, interval)
+	if p.OnInterval != nil {
+		p.OnInterval(interval)
+	}
+}
+
+// skip reports a tick which was skipped because the previous query is still running
+func (p *Poller) skip(running time.Duration) {
+	n := atomic.AddUint64(&p.skipped, 1)
+	log.Printf("poller id %s: previous query still running after %v. skipped poll (%d skipped)", p.ID, running, n)
+	if p.OnSkip != nil {
+		p.OnSkip(running)
+	}
+}
+
+// Skipped returns the number of ticks skipped because the previous query was still running.
+func (p *Poller) Skipped() uint64 {
+	return atomic.LoadUint64(&p.skipped)
+}
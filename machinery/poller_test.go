@@ -0,0 +1,172 @@
+package machinery
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// slowQuerier takes longer then the poll interval and records how many queries overlap
+type slowQuerier struct {
+	d       time.Duration
+	calls   int32
+	running int32
+	overlap int32
+}
+
+func (s *slowQuerier) Query(ctx context.Context) {
+	atomic.AddInt32(&s.calls, 1)
+	if atomic.AddInt32(&s.running, 1) > 1 {
+		atomic.StoreInt32(&s.overlap, 1)
+	}
+	defer atomic.AddInt32(&s.running, -1)
+
+	select {
+	case <-time.After(s.d):
+	case <-ctx.Done():
+	}
+}
+
+func TestPollerSkipsOverlappingTicks(t *testing.T) {
+	interval := 10 * time.Millisecond
+	q := &slowQuerier{d: 35 * time.Millisecond}
+	p := NewPoller("test", q, interval)
+
+	var reported int32
+	p.OnSkip = func(running time.Duration) {
+		atomic.AddInt32(&reported, 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Poll(ctx)
+		close(done)
+	}()
+	time.Sleep(20 * interval)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("poller did not stop")
+	}
+	if atomic.LoadInt32(&q.running) != 0 {
+		t.Fatalf("poller returned while a query was running")
+	}
+	if atomic.LoadInt32(&q.overlap) != 0 {
+		t.Fatalf("queries overlapped")
+	}
+	if p.Skipped() == 0 {
+		t.Fatalf("expected ticks to be skipped")
+	}
+	if uint64(atomic.LoadInt32(&reported)) != p.Skipped() {
+		t.Fatalf("expected every skip to be reported got: %d reported %d skipped", reported, p.Skipped())
+	}
+}
+
+var NextTT = []struct {
+	name     string
+	now      time.Time
+	interval time.Duration
+	offset   time.Duration
+	expected time.Time
+}{
+	{
+		name:     "aligned to interval",
+		now:      time.Date(2019, 1, 1, 12, 0, 7, 0, time.UTC),
+		interval: 5 * time.Second,
+		expected: time.Date(2019, 1, 1, 12, 0, 10, 0, time.UTC),
+	},
+	{
+		name:     "on a tick waits for the next",
+		now:      time.Date(2019, 1, 1, 12, 0, 10, 0, time.UTC),
+		interval: 5 * time.Second,
+		expected: time.Date(2019, 1, 1, 12, 0, 15, 0, time.UTC),
+	},
+	{
+		name:     "offset within current interval",
+		now:      time.Date(2019, 1, 1, 12, 0, 7, 0, time.UTC),
+		interval: 5 * time.Second,
+		offset:   4 * time.Second,
+		expected: time.Date(2019, 1, 1, 12, 0, 9, 0, time.UTC),
+	},
+	{
+		name:     "offset already passed",
+		now:      time.Date(2019, 1, 1, 12, 0, 7, 0, time.UTC),
+		interval: 5 * time.Second,
+		offset:   1 * time.Second,
+		expected: time.Date(2019, 1, 1, 12, 0, 11, 0, time.UTC),
+	},
+	{
+		name:     "minute interval aligned to wall clock",
+		now:      time.Date(2019, 1, 1, 12, 3, 30, 0, time.UTC),
+		interval: time.Minute,
+		expected: time.Date(2019, 1, 1, 12, 4, 0, 0, time.UTC),
+	},
+}
+
+func TestNext(t *testing.T) {
+	for _, tt := range NextTT {
+		t.Run(tt.name, func(t *testing.T) {
+			got := next(tt.now, tt.interval, tt.offset)
+			if !got.Equal(tt.expected) {
+				t.Fatalf("got: %v want: %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPollerPollsImmediately(t *testing.T) {
+	q := &slowQuerier{}
+	p := NewPoller("test", q, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go p.Poll(ctx)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&q.calls) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("poller did not query before the first tick")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPollerAdaptsOnceObserved(t *testing.T) {
+	q := &slowQuerier{}
+	p := NewAdaptivePoller("test", q, time.Second, 8*time.Second)
+	polled := make(chan struct{}, 1)
+	p.OnPolled = func(time.Duration) {
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go p.Poll(ctx)
+	select {
+	case <-polled:
+	case <-time.After(time.Second):
+		t.Fatalf("poller did not complete a poll")
+	}
+	// the poll's results have not been observed yet
+	if got := p.Interval(); got != time.Second {
+		t.Fatalf("expected the interval to wait for the poll's results got %v", got)
+	}
+
+	p.Observe(&graphx.Metric{Name: "web_1", TimeStamp: 1, Value: "1"})
+	p.Polled(0)
+	if got := p.Interval(); got != time.Second {
+		t.Fatalf("expected a moving series to keep the interval got %v", got)
+	}
+	p.Polled(0)
+	if got := p.Interval(); got != 2*time.Second {
+		t.Fatalf("expected an unchanged poll to back off got %v", got)
+	}
+}
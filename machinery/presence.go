@@ -0,0 +1,157 @@
+package machinery
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// presence tracks the series appearing in query results. a series is added when its first
+// sample is received and removed once no sample was received for the grace period.
+type presence struct {
+	mu     sync.Mutex
+	series map[seriesKey]*sighting
+	// the grace period sweepAt was computed with
+	grace time.Duration
+	// no series can be removed before sweepAt. zero forces the next sweep
+	sweepAt time.Time
+}
+
+// sighting is when a series was last received and the timestamp of its latest sample
+type sighting struct {
+	at time.Time
+	ts int64
+}
+
+func newPresence() *presence {
+	return &presence{
+		series: make(map[seriesKey]*sighting),
+	}
+}
+
+// expired is a removed event and the chart of its series
+type expired struct {
+	chart string
+	ev    *graphx.SeriesEvent
+}
+
+// observe records a received metric of chart and returns an added event if its series is new
+func (p *presence) observe(chart string, m *graphx.Metric, now time.Time) *graphx.SeriesEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := seriesKey{chart: chart, metric: m.Chart, name: m.Name}
+	s, ok := p.series[key]
+	if ok {
+		s.at = now
+		if m.TimeStamp > s.ts {
+			s.ts = m.TimeStamp
+		}
+		return nil
+	}
+
+	p.series[key] = &sighting{at: now, ts: m.TimeStamp}
+	return &graphx.SeriesEvent{
+		State:    graphx.SeriesAdded,
+		Name:     m.Name,
+		Chart:    m.Chart,
+		LastSeen: m.TimeStamp,
+	}
+}
+
+// known records a series the client learned about outside of the stream, such as from a
+// backfill, without an added event
+func (p *presence) known(chart string, chartMetric string, name string, ts int64, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := seriesKey{chart: chart, metric: chartMetric, name: name}
+	if _, ok := p.series[key]; ok {
+		return
+	}
+	p.series[key] = &sighting{at: now, ts: ts}
+}
+
+// hold postpones removing the series of a chart metric whose query failed. their absence
+// from the failed poll says nothing about the series
+func (p *presence) hold(chart string, chartMetric string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, s := range p.series {
+		if key.chart == chart && key.metric == chartMetric {
+			s.at = now
+		}
+	}
+}
+
+// expire forgets and returns removed events for every series not received for grace
+func (p *presence) expire(now time.Time, grace time.Duration) []expired {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if grace != p.grace {
+		p.grace = grace
+		p.sweepAt = time.Time{}
+	}
+	if now.Before(p.sweepAt) {
+		return nil
+	}
+
+	var removed []expired
+	p.sweepAt = time.Time{}
+	for key, s := range p.series {
+		deadline := s.at.Add(grace)
+		if !now.Before(deadline) {
+			removed = append(removed, expired{chart: key.chart, ev: &graphx.SeriesEvent{
+				State:    graphx.SeriesRemoved,
+				Name:     key.name,
+				Chart:    key.metric,
+				LastSeen: s.ts,
+			}})
+			delete(p.series, key)
+			continue
+		}
+		if p.sweepAt.IsZero() || deadline.Before(p.sweepAt) {
+			p.sweepAt = deadline
+		}
+	}
+
+	sort.Slice(removed, func(i, j int) bool {
+		a, b := removed[i], removed[j]
+		switch {
+		case a.chart != b.chart:
+			return a.chart < b.chart
+		case a.ev.Chart != b.ev.Chart:
+			return a.ev.Chart < b.ev.Chart
+		}
+		return a.ev.Name < b.ev.Name
+	})
+	return removed
+}
+
+// next returns how long until a series may be removed. false when no series is present
+func (p *presence) next(now time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.series) == 0 {
+		return 0, false
+	}
+	return p.sweepAt.Sub(now), true
+}
+
+// retain forgets the series keep rejects without reporting them removed. used once the
+// client stopped streaming them
+func (p *presence) retain(keep func(key seriesKey) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key := range p.series {
+		if !keep(key) {
+			delete(p.series, key)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package machinery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+func TestPresence(t *testing.T) {
+	p := newPresence()
+	grace := 10 * time.Second
+	now := time.Unix(1000, 0)
+
+	web1 := &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 1000}
+	web2 := &graphx.Metric{Name: "web_2", Chart: "usage", TimeStamp: 1000}
+	if ev := p.observe("cpu", web1, now); ev == nil || ev.State != graphx.SeriesAdded || ev.Name != "web_1" {
+		t.Fatalf("expected web_1 to be added got: %+v", ev)
+	}
+	if ev := p.observe("cpu", web2, now); ev == nil || ev.State != graphx.SeriesAdded {
+		t.Fatalf("expected web_2 to be added got: %+v", ev)
+	}
+	if ev := p.observe("cpu", web1, now); ev != nil {
+		t.Fatalf("expected no event for a present series got: %+v", ev)
+	}
+	if removed := p.expire(now, grace); len(removed) != 0 {
+		t.Fatalf("expected no series to be removed got: %v", removed)
+	}
+
+	// web_2 stops appearing while web_1 keeps reporting
+	now = now.Add(5 * time.Second)
+	p.observe("cpu", &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 1005}, now)
+	if d, ok := p.next(now); !ok || d != 5*time.Second {
+		t.Fatalf("expected the next removal in 5s got: %v %v", d, ok)
+	}
+
+	now = now.Add(5 * time.Second)
+	removed := p.expire(now, grace)
+	if len(removed) != 1 || removed[0].chart != "cpu" || removed[0].ev.Name != "web_2" || removed[0].ev.State != graphx.SeriesRemoved || removed[0].ev.LastSeen != 1000 {
+		t.Fatalf("expected web_2 to be removed got: %+v", removed)
+	}
+
+	// a failing query holds its series
+	now = now.Add(9 * time.Second)
+	p.hold("cpu", "usage", now)
+	now = now.Add(9 * time.Second)
+	if removed := p.expire(now, grace); len(removed) != 0 {
+		t.Fatalf("expected held series to be kept got: %+v", removed)
+	}
+
+	// a series the client stopped streaming is forgotten without being removed
+	p.retain(func(key seriesKey) bool { return false })
+	if _, ok := p.next(now); ok {
+		t.Fatalf("expected no series to be present")
+	}
+
+	// a returning series is added again
+	if ev := p.observe("cpu", web2, now); ev == nil || ev.State != graphx.SeriesAdded {
+		t.Fatalf("expected web_2 to be added again got: %+v", ev)
+	}
+}
+
+func TestPresenceCharts(t *testing.T) {
+	p := newPresence()
+	grace := 10 * time.Second
+	now := time.Unix(1000, 0)
+
+	// a chart metric name shared by two charts are separate series
+	m := &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 1000}
+	for _, chart := range []string{"cpu", "memory"} {
+		if ev := p.observe(chart, m, now); ev == nil || ev.State != graphx.SeriesAdded {
+			t.Fatalf("expected the series of %s to be added got: %+v", chart, ev)
+		}
+	}
+
+	// only memory keeps reporting
+	now = now.Add(grace)
+	p.observe("memory", m, now)
+	removed := p.expire(now, grace)
+	if len(removed) != 1 || removed[0].chart != "cpu" || removed[0].ev.Name != "web_1" {
+		t.Fatalf("expected only the series of cpu to be removed got: %+v", removed)
+	}
+}
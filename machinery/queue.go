@@ -0,0 +1,207 @@
+package machinery
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// Queue is a bounded buffer of metrics between queriers and a client which applies
+// a graphx.Backpressure policy once full.
+type Queue struct {
+	// accessed atomically, first in the struct to guarantee 64 bit alignment
+	dropped uint64
+
+	policy graphx.Backpressure
+	size   int
+
+	mu    sync.Mutex
+	items *list.List
+	// the buffered element of each series, only maintained when coalescing
+	series map[seriesKey]*list.Element
+	// the buffered poll mark of each chart metric
+	marks map[metricKey]*list.Element
+	// signaled when a metric is pushed or popped
+	ready chan struct{}
+	space chan struct{}
+}
+
+// metricKey identifies a chart metric. chart metric names are only unique within a chart
+type metricKey struct {
+	chart  string
+	metric string
+}
+
+// seriesKey identifies the series of a name of a chart metric
+type seriesKey struct {
+	chart  string
+	metric string
+	name   string
+}
+
+// Item is a metric or a poll mark buffered by a Queue
+type Item struct {
+	// the chart the metric was polled for
+	Chart string
+	// the buffered metric, nil when the item marks a completed poll
+	Metric *graphx.Metric
+	// the chart metric whose poll completed, set when Metric is nil
+	Polled string
+}
+
+// NewQueue is a constructor for a Queue. an empty policy or non positive size selects the defaults.
+func NewQueue(policy graphx.Backpressure, size int) *Queue {
+	if policy == "" {
+		policy = graphx.BackpressureDropNewest
+	}
+	if size <= 0 {
+		size = graphx.DefaultBufferSize
+	}
+	return &Queue{
+		policy: policy,
+		size:   size,
+		items:  list.New(),
+		series: make(map[seriesKey]*list.Element),
+		marks:  make(map[metricKey]*list.Element),
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+	}
+}
+
+// Push buffers a metric polled for chart. with the block policy Push waits for room until
+// ctx is done, every other policy returns immediately.
+func (q *Queue) Push(ctx context.Context, chart string, m *graphx.Metric) {
+	for {
+		q.mu.Lock()
+		ok := q.push(Item{Chart: chart, Metric: m})
+		q.mu.Unlock()
+		if ok {
+			signal(q.ready)
+			return
+		}
+
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// push applies the policy. returns false only when the block policy must wait. callers must hold mu.
+func (q *Queue) push(it Item) bool {
+	key := seriesKey{chart: it.Chart, metric: it.Metric.Chart, name: it.Metric.Name}
+
+	if q.policy == graphx.BackpressureCoalesce {
+		if el, ok := q.series[key]; ok {
+			el.Value = it
+			atomic.AddUint64(&q.dropped, 1)
+			return true
+		}
+	}
+
+	if q.items.Len()-len(q.marks) >= q.size {
+		switch q.policy {
+		case graphx.BackpressureBlock:
+			return false
+		case graphx.BackpressureDropOldest:
+			q.remove(q.oldest())
+		default:
+			atomic.AddUint64(&q.dropped, 1)
+			return true
+		}
+		atomic.AddUint64(&q.dropped, 1)
+	}
+
+	el := q.items.PushBack(it)
+	if q.policy == graphx.BackpressureCoalesce {
+		q.series[key] = el
+	}
+	return true
+}
+
+// MarkPolled buffers a mark following the metrics of a completed poll of a chart metric of chart.
+// marks are never dropped. a chart metric's mark which is still buffered moves behind the
+// metrics of the newer poll
+func (q *Queue) MarkPolled(chart string, chartMetric string) {
+	key := metricKey{chart: chart, metric: chartMetric}
+	q.mu.Lock()
+	if el, ok := q.marks[key]; ok {
+		q.items.Remove(el)
+	}
+	q.marks[key] = q.items.PushBack(Item{Chart: chart, Polled: chartMetric})
+	q.mu.Unlock()
+	signal(q.ready)
+}
+
+// TryPop returns the oldest buffered metric if there is one, discarding poll marks
+func (q *Queue) TryPop() (*graphx.Metric, bool) {
+	for {
+		it, ok := q.TryNext()
+		if !ok || it.Metric != nil {
+			return it.Metric, ok
+		}
+	}
+}
+
+// TryNext returns the oldest buffered metric or poll mark if there is either
+func (q *Queue) TryNext() (Item, bool) {
+	q.mu.Lock()
+	el := q.items.Front()
+	if el == nil {
+		q.mu.Unlock()
+		return Item{}, false
+	}
+	q.remove(el)
+	q.mu.Unlock()
+
+	it := el.Value.(Item)
+	if it.Metric != nil {
+		signal(q.space)
+	}
+	return it, true
+}
+
+// Ready is signaled after a metric is pushed
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Dropped returns the number of metrics discarded or coalesced
+func (q *Queue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// oldest returns the element of the oldest buffered metric. callers must hold mu.
+func (q *Queue) oldest() *list.Element {
+	el := q.items.Front()
+	for {
+		if el.Value.(Item).Metric != nil {
+			return el
+		}
+		el = el.Next()
+	}
+}
+
+// remove removes an element. callers must hold mu.
+func (q *Queue) remove(el *list.Element) {
+	q.items.Remove(el)
+	it := el.Value.(Item)
+	switch {
+	case it.Metric == nil:
+		delete(q.marks, metricKey{chart: it.Chart, metric: it.Polled})
+	case q.policy == graphx.BackpressureCoalesce:
+		delete(q.series, seriesKey{chart: it.Chart, metric: it.Metric.Chart, name: it.Metric.Name})
+	}
+}
+
+// signal notifies a waiter without blocking
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,178 @@
+package machinery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+func metric(name string, value string) *graphx.Metric {
+	return &graphx.Metric{Name: name, Chart: "usage", Value: value}
+}
+
+var QueueTT = []struct {
+	name   string
+	policy graphx.Backpressure
+	// metrics pushed into a queue of size 2
+	pushed []*graphx.Metric
+	// the values expected to be popped in order
+	expected []string
+	dropped  uint64
+}{
+	{
+		name:     "drop newest",
+		policy:   graphx.BackpressureDropNewest,
+		pushed:   []*graphx.Metric{metric("a", "1"), metric("a", "2"), metric("a", "3")},
+		expected: []string{"1", "2"},
+		dropped:  1,
+	},
+	{
+		name:     "drop oldest",
+		policy:   graphx.BackpressureDropOldest,
+		pushed:   []*graphx.Metric{metric("a", "1"), metric("a", "2"), metric("a", "3")},
+		expected: []string{"2", "3"},
+		dropped:  1,
+	},
+	{
+		name:     "coalesce keeps latest per series",
+		policy:   graphx.BackpressureCoalesce,
+		pushed:   []*graphx.Metric{metric("a", "1"), metric("b", "2"), metric("a", "3"), metric("c", "4")},
+		expected: []string{"3", "2"},
+		dropped:  2,
+	},
+	{
+		name:     "default policy",
+		policy:   "",
+		pushed:   []*graphx.Metric{metric("a", "1"), metric("a", "2"), metric("a", "3")},
+		expected: []string{"1", "2"},
+		dropped:  1,
+	},
+}
+
+func TestQueuePolicies(t *testing.T) {
+	for _, tt := range QueueTT {
+
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(tt.policy, 2)
+			for _, m := range tt.pushed {
+				q.Push(context.Background(), "cpu", m)
+			}
+
+			for _, value := range tt.expected {
+				m, ok := q.TryPop()
+				if !ok {
+					t.Fatalf("expected value %v but queue was empty", value)
+				}
+				if m.Value != value {
+					t.Fatalf("expected value: %v got value: %v", value, m.Value)
+				}
+			}
+			if m, ok := q.TryPop(); ok {
+				t.Fatalf("expected queue to be empty got: %v", m)
+			}
+			if q.Dropped() != tt.dropped {
+				t.Fatalf("expected %d dropped got: %d", tt.dropped, q.Dropped())
+			}
+		})
+
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	q := NewQueue(graphx.BackpressureBlock, 1)
+	q.Push(context.Background(), "cpu", metric("a", "1"))
+
+	pushed := make(chan struct{})
+	go func() {
+		q.Push(context.Background(), "cpu", metric("a", "2"))
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatalf("expected push to block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if m, _ := q.TryPop(); m.Value != "1" {
+		t.Fatalf("expected value: 1 got value: %v", m.Value)
+	}
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected push to complete once room was made")
+	}
+	if q.Dropped() != 0 {
+		t.Fatalf("expected nothing dropped got: %d", q.Dropped())
+	}
+
+	// a blocked push gives up once its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	q.Push(ctx, "cpu", metric("a", "3"))
+}
+
+func TestQueuePollMarks(t *testing.T) {
+	q := NewQueue(graphx.BackpressureDropOldest, 2)
+	q.Push(context.Background(), "cpu", metric("a", "1"))
+	q.MarkPolled("cpu", "usage")
+	q.Push(context.Background(), "cpu", metric("a", "2"))
+	// a mark is never dropped and moves behind the metrics of the newer poll
+	q.Push(context.Background(), "cpu", metric("a", "3"))
+	q.MarkPolled("cpu", "usage")
+
+	var got []string
+	for {
+		it, ok := q.TryNext()
+		if !ok {
+			break
+		}
+		if it.Metric == nil {
+			got = append(got, "polled "+it.Chart+" "+it.Polled)
+			continue
+		}
+		got = append(got, it.Metric.Value)
+	}
+	expected := []string{"2", "3", "polled cpu usage"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v got %v", expected, got)
+		}
+	}
+
+	// TryPop discards marks
+	q.MarkPolled("cpu", "usage")
+	q.Push(context.Background(), "cpu", metric("a", "4"))
+	if m, ok := q.TryPop(); !ok || m.Value != "4" {
+		t.Fatalf("expected the metric after the mark got %v", m)
+	}
+}
+
+func TestQueueCoalesceCharts(t *testing.T) {
+	q := NewQueue(graphx.BackpressureCoalesce, 4)
+	q.Push(context.Background(), "cpu", metric("a", "1"))
+	q.Push(context.Background(), "memory", metric("a", "2"))
+	q.Push(context.Background(), "cpu", metric("a", "3"))
+
+	// a chart metric name shared by two charts are separate series
+	var got []string
+	for {
+		it, ok := q.TryNext()
+		if !ok {
+			break
+		}
+		got = append(got, it.Chart+" "+it.Metric.Value)
+	}
+	expected := []string{"cpu 3", "memory 2"}
+	if len(got) != len(expected) || got[0] != expected[0] || got[1] != expected[1] {
+		t.Fatalf("expected %v got %v", expected, got)
+	}
+}
@@ -0,0 +1,198 @@
+package machinery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/prometheus"
+	"github.com/google/uuid"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// runner implements the QueryRunner interface with the same datasource queriers
+// live streams poll.
+type runner struct {
+	// prometheus client
+	pc promapi.API
+	// query timeouts of each datasource
+	timeouts Timeouts
+}
+
+// NewQueryRunner is a constructor for a graphx.QueryRunner. timeouts may be nil.
+func NewQueryRunner(promClient promapi.API, timeouts Timeouts) graphx.QueryRunner {
+	return &runner{
+		pc:       promClient,
+		timeouts: timeouts,
+	}
+}
+
+// Run queries every chart metric concurrently. each chart metric is given its own querier so
+// a single failing query only removes its own series from the result. derived chart metrics
+// are evaluated from the results once every query of their chart completed, followed by the
+// transforms of each chart metric and the chart's aggregation.
+func (r *runner) Run(ctx context.Context, charts []*graphx.Chart, qd graphx.QueryDescriptor) (*graphx.QueryResult, error) {
+	// every one-shot query queues fairly against sessions and other queries as its own session
+	if _, ok := graphx.SessionFromContext(ctx); !ok {
+		ctx = graphx.WithSession(ctx, "query."+uuid.New().String())
+	}
+
+	names := nameSet(qd.Names)
+	res := &graphx.QueryResult{
+		Charts: make([]*graphx.ChartResult, len(charts)),
+	}
+
+	var wg sync.WaitGroup
+	for i, chart := range charts {
+		cr := &graphx.ChartResult{
+			Name:   chart.Name,
+			Series: []*graphx.Series{},
+		}
+		res.Charts[i] = cr
+
+		var mu sync.Mutex
+		for _, chartMetrics := range graphx.DatasourceTranspose([]*graphx.Chart{chart}) {
+			for _, chartMetric := range chartMetrics {
+				if chartMetric.Datasource == graphx.DerivedDatasource {
+					continue
+				}
+				wg.Add(1)
+				go func(cr *graphx.ChartResult, mu *sync.Mutex, chartMetric graphx.ChartMetric) {
+					defer wg.Done()
+					series, err := r.query(ctx, chartMetric, qd)
+
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						cr.Errors = append(cr.Errors, err)
+						return
+					}
+					for _, s := range series {
+						if _, ok := names[s.Name]; ok {
+							cr.Series = append(cr.Series, s)
+						}
+					}
+				}(cr, &mu, chartMetric)
+			}
+		}
+	}
+	wg.Wait()
+
+	for i, chart := range charts {
+		cr := res.Charts[i]
+		byDatasource := graphx.DatasourceTranspose([]*graphx.Chart{chart})
+		for _, chartMetric := range byDatasource[graphx.DerivedDatasource] {
+			dv, err := newDerivation(chart, chartMetric)
+			if err != nil {
+				cr.Errors = append(cr.Errors, graphx.NewQueryError(graphx.QueryErrorValidation, chartMetric, err))
+				continue
+			}
+			cr.Series = append(cr.Series, dv.derive(cr.Series)...)
+		}
+
+		// transform the series like a live stream would, dropping those of invalid transforms
+		invalid := map[string]bool{}
+		transforms := map[string]pipeline{}
+		for _, chartMetrics := range byDatasource {
+			ps, errs := pipelines(chartMetrics)
+			for name, p := range ps {
+				transforms[name] = p
+			}
+			for _, qe := range errs {
+				cr.Errors = append(cr.Errors, qe)
+				invalid[qe.Metric] = true
+			}
+		}
+		series := cr.Series[:0]
+		for _, s := range cr.Series {
+			if invalid[s.Chart] {
+				continue
+			}
+			if p, ok := transforms[s.Chart]; ok {
+				p.stages().series(s)
+			}
+			series = append(series, s)
+		}
+		cr.Series = series
+
+		if chart.Aggregation != nil {
+			if err := chart.Aggregation.Validate(); err != nil {
+				cr.Series = []*graphx.Series{}
+				cr.Errors = append(cr.Errors, &graphx.QueryError{Kind: graphx.QueryErrorValidation, Chart: chart.Name, Message: err.Error()})
+				continue
+			}
+			cr.Series = combineChart(*chart.Aggregation, cr.Series)
+		}
+	}
+
+	// results are assembled concurrently, order them for stable responses
+	for _, cr := range res.Charts {
+		sort.Slice(cr.Series, func(i, j int) bool {
+			if cr.Series[i].Chart != cr.Series[j].Chart {
+				return cr.Series[i].Chart < cr.Series[j].Chart
+			}
+			return cr.Series[i].Name < cr.Series[j].Name
+		})
+		sort.Slice(cr.Errors, func(i, j int) bool {
+			return cr.Errors[i].Metric < cr.Errors[j].Metric
+		})
+	}
+
+	return res, nil
+}
+
+// query runs a single chart metric as an instant or range query
+func (r *runner) query(ctx context.Context, chartMetric graphx.ChartMetric, qd graphx.QueryDescriptor) ([]*graphx.Series, *graphx.QueryError) {
+	var q graphx.Querier
+	switch chartMetric.Datasource {
+	case prometheus.Datasource:
+		q = prometheus.NewQuerier(prometheus.QuerierOpts{
+			ID:           "query." + chartMetric.Chart,
+			Client:       r.pc,
+			ChartMetrics: []graphx.ChartMetric{chartMetric},
+			Timeout:      r.timeouts[chartMetric.Datasource],
+		})
+	default:
+		err := fmt.Errorf("unsupported datasource %q", chartMetric.Datasource)
+		return nil, graphx.NewQueryError(graphx.QueryErrorValidation, chartMetric, err)
+	}
+
+	if qd.IsRange() {
+		series, err := q.(graphx.RangeQuerier).QueryRange(ctx, time.Time(qd.From), time.Time(qd.To), time.Duration(qd.Step))
+		if err != nil {
+			return nil, asQueryError(chartMetric, err)
+		}
+		return series, nil
+	}
+
+	metrics, err := q.(graphx.InstantQuerier).QueryInstant(ctx, time.Time(qd.Time))
+	if err != nil {
+		return nil, asQueryError(chartMetric, err)
+	}
+	return pointSeries(metrics), nil
+}
+
+// pointSeries converts the metrics of an instant query to single point series
+func pointSeries(metrics []*graphx.Metric) []*graphx.Series {
+	series := make([]*graphx.Series, 0, len(metrics))
+	for _, m := range metrics {
+		s := &graphx.Series{
+			Name:  m.Name,
+			Chart: m.Chart,
+		}
+		s.Append(m.TimeStamp, m.Value)
+		series = append(series, s)
+	}
+	return series
+}
+
+// asQueryError attributes an error which is not already a QueryError to the chart metric
+func asQueryError(chartMetric graphx.ChartMetric, err error) *graphx.QueryError {
+	if qe, ok := err.(*graphx.QueryError); ok {
+		return qe
+	}
+	return graphx.NewQueryError(graphx.QueryErrorClient, chartMetric, err)
+}
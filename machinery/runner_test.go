@@ -0,0 +1,92 @@
+package machinery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/prometheus"
+)
+
+func TestRunnerInstant(t *testing.T) {
+	qr := NewQueryRunner(newFakeAPI(), nil)
+	charts := []*graphx.Chart{
+		{
+			Name: "cpu",
+			ChartMetrics: []graphx.ChartMetric{
+				{Name: "usage", Query: "cpu", Datasource: prometheus.Datasource},
+				{Name: "broken", Query: "cpu", Datasource: "unsupported"},
+			},
+		},
+		{
+			Name: "mem",
+			ChartMetrics: []graphx.ChartMetric{
+				{Name: "rss", Query: "mem", Datasource: prometheus.Datasource},
+			},
+		},
+	}
+	ts := time.Unix(1000, 0)
+
+	res, err := qr.Run(context.Background(), charts, graphx.QueryDescriptor{
+		ChartNames: []string{"cpu", "mem"},
+		Names:      []string{"web_1"},
+		Time:       graphx.TimeStamp(ts),
+	})
+	if err != nil {
+		t.Fatalf("failed to run query: %v", err)
+	}
+
+	if len(res.Charts) != 2 || res.Charts[0].Name != "cpu" || res.Charts[1].Name != "mem" {
+		t.Fatalf("expected a result for each chart in order got: %+v", res.Charts)
+	}
+	for _, cr := range res.Charts {
+		if len(cr.Series) != 1 {
+			t.Fatalf("chart %s: expected a single series got: %d", cr.Name, len(cr.Series))
+		}
+		s := cr.Series[0]
+		if s.Name != "web_1" || len(s.TimeStamps) != 1 || s.TimeStamps[0] != ts.Unix() {
+			t.Fatalf("chart %s: unexpected series: %+v", cr.Name, s)
+		}
+	}
+
+	// the failing chart metric is reported without failing its chart
+	errs := res.Charts[0].Errors
+	if len(errs) != 1 || errs[0].Metric != "broken" || errs[0].Kind != graphx.QueryErrorValidation {
+		t.Fatalf("expected a validation error for the broken chart metric got: %v", errs)
+	}
+	if len(res.Charts[1].Errors) != 0 {
+		t.Fatalf("expected no errors for mem chart got: %v", res.Charts[1].Errors)
+	}
+}
+
+func TestRunnerDerived(t *testing.T) {
+	qr := NewQueryRunner(newFakeAPI(), nil)
+	charts := []*graphx.Chart{
+		{
+			Name: "cpu",
+			ChartMetrics: []graphx.ChartMetric{
+				{Name: "usage", Query: "cpu", Datasource: prometheus.Datasource},
+				{Name: "quarter", Expr: "usage / 4"},
+				{Name: "broken", Expr: "usage / missing"},
+			},
+		},
+	}
+
+	res, err := qr.Run(context.Background(), charts, graphx.QueryDescriptor{
+		ChartNames: []string{"cpu"},
+		Names:      []string{"web_1"},
+		Time:       graphx.TimeStamp(time.Unix(1000, 0)),
+	})
+	if err != nil {
+		t.Fatalf("failed to run query: %v", err)
+	}
+
+	cr := res.Charts[0]
+	if len(cr.Series) != 2 || cr.Series[0].Chart != "quarter" || cr.Series[0].Values[0] != "0.25" {
+		t.Fatalf("expected the derived series alongside usage got: %+v", cr.Series)
+	}
+	if len(cr.Errors) != 1 || cr.Errors[0].Metric != "broken" || cr.Errors[0].Kind != graphx.QueryErrorValidation {
+		t.Fatalf("expected a validation error for the broken expression got: %v", cr.Errors)
+	}
+}
@@ -0,0 +1,315 @@
+package machinery
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// stage is a single transform applied to the points of one series in time order. stateful
+// stages carry their state from point to point. ok is false when the point is dropped
+type stage interface {
+	apply(ts int64, v float64) (out float64, ok bool)
+}
+
+// stages are the transforms of a chart metric applied to one series
+type stages []stage
+
+func (st stages) apply(ts int64, v float64) (float64, bool) {
+	for _, s := range st {
+		var ok bool
+		v, ok = s.apply(ts, v)
+		if !ok {
+			return 0, false
+		}
+	}
+	return v, true
+}
+
+// series transforms the points of a series in place. points which are not numeric pass
+// through untransformed like live points do
+func (st stages) series(s *graphx.Series) {
+	ts := make([]int64, 0, len(s.TimeStamps))
+	vs := make([]string, 0, len(s.Values))
+	for i := range s.TimeStamps {
+		f, err := strconv.ParseFloat(s.Values[i], 64)
+		if err != nil {
+			ts = append(ts, s.TimeStamps[i])
+			vs = append(vs, s.Values[i])
+			continue
+		}
+		out, ok := st.apply(s.TimeStamps[i], f)
+		if !ok {
+			continue
+		}
+		ts = append(ts, s.TimeStamps[i])
+		vs = append(vs, format(out))
+	}
+	s.TimeStamps = ts
+	s.Values = vs
+}
+
+// pipeline is the validated transforms of a chart metric
+type pipeline []graphx.Transform
+
+func newPipeline(transforms []graphx.Transform) (pipeline, error) {
+	for i, t := range transforms {
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("transform %d: %v", i, err)
+		}
+	}
+	return pipeline(transforms), nil
+}
+
+// pipelines validates the transforms of chart metrics. the pipelines of chart metrics with
+// transforms are returned keyed by chart metric name along with an error for each invalid one
+func pipelines(chartMetrics []graphx.ChartMetric) (map[string]pipeline, []*graphx.QueryError) {
+	ps := map[string]pipeline{}
+	var errs []*graphx.QueryError
+	for _, chartMetric := range chartMetrics {
+		if len(chartMetric.Transforms) == 0 {
+			continue
+		}
+		p, err := newPipeline(chartMetric.Transforms)
+		if err != nil {
+			errs = append(errs, graphx.NewQueryError(graphx.QueryErrorValidation, chartMetric, err))
+			continue
+		}
+		ps[chartMetric.Name] = p
+	}
+	return ps, errs
+}
+
+// stages returns the stages of a new series
+func (p pipeline) stages() stages {
+	st := make(stages, 0, len(p))
+	for _, t := range p {
+		switch t.Type {
+		case graphx.TransformScale:
+			st = append(st, scale(t.Value))
+		case graphx.TransformOffset:
+			st = append(st, offset(t.Value))
+		case graphx.TransformMovingAverage:
+			st = append(st, &movingAverage{window: make([]float64, 0, t.Window), size: t.Window})
+		case graphx.TransformEWMA:
+			st = append(st, &ewma{alpha: t.Alpha})
+		case graphx.TransformRate:
+			st = append(st, &rate{counter: true})
+		case graphx.TransformDerivative:
+			st = append(st, &rate{})
+		case graphx.TransformCumulativeSum:
+			st = append(st, &cumulativeSum{})
+		case graphx.TransformClamp:
+			st = append(st, clamp{min: t.Min, max: t.Max})
+		case graphx.TransformRound:
+			st = append(st, round(math.Pow(10, float64(t.Precision))))
+		}
+	}
+	return st
+}
+
+type scale float64
+
+func (s scale) apply(ts int64, v float64) (float64, bool) { return v * float64(s), true }
+
+type offset float64
+
+func (o offset) apply(ts int64, v float64) (float64, bool) { return v + float64(o), true }
+
+type movingAverage struct {
+	window []float64
+	size   int
+	next   int
+	sum    float64
+}
+
+func (m *movingAverage) apply(ts int64, v float64) (float64, bool) {
+	if len(m.window) < m.size {
+		m.window = append(m.window, v)
+	} else {
+		m.sum -= m.window[m.next]
+		m.window[m.next] = v
+		m.next = (m.next + 1) % m.size
+	}
+	m.sum += v
+	return m.sum / float64(len(m.window)), true
+}
+
+type ewma struct {
+	alpha   float64
+	value   float64
+	started bool
+}
+
+func (e *ewma) apply(ts int64, v float64) (float64, bool) {
+	if !e.started {
+		e.started = true
+		e.value = v
+		return v, true
+	}
+	e.value = e.alpha*v + (1-e.alpha)*e.value
+	return e.value, true
+}
+
+// rate is the per second change between consecutive points. a counter's decrease is a reset
+// and the value after it is the increase since the reset
+type rate struct {
+	counter bool
+	ts      int64
+	value   float64
+	started bool
+}
+
+func (r *rate) apply(ts int64, v float64) (float64, bool) {
+	prevTS, prev, started := r.ts, r.value, r.started
+	r.ts, r.value, r.started = ts, v, true
+	if !started || ts <= prevTS {
+		return 0, false
+	}
+
+	delta := v - prev
+	if r.counter && delta < 0 {
+		delta = v
+	}
+	return delta / float64(ts-prevTS), true
+}
+
+type cumulativeSum struct {
+	sum float64
+}
+
+func (c *cumulativeSum) apply(ts int64, v float64) (float64, bool) {
+	c.sum += v
+	return c.sum, true
+}
+
+type clamp struct {
+	min *float64
+	max *float64
+}
+
+func (c clamp) apply(ts int64, v float64) (float64, bool) {
+	if c.min != nil && v < *c.min {
+		v = *c.min
+	}
+	if c.max != nil && v > *c.max {
+		v = *c.max
+	}
+	return v, true
+}
+
+// round rounds to the precision given as a power of ten
+type round float64
+
+func (r round) apply(ts int64, v float64) (float64, bool) {
+	scaled := v * float64(r)
+	if math.IsInf(scaled, 0) {
+		// a value this large has no fractional digits left to round
+		return v, true
+	}
+	return math.Round(scaled) / float64(r), true
+}
+
+// transformer applies the transforms of a session's chart metrics, keeping the state of each
+// series so live points continue where the series' backfill ended.
+type transformer struct {
+	mu sync.Mutex
+	// the pipelines of each chart keyed by chart metric name
+	charts map[string]map[string]pipeline
+	// the stages of each series of each chart being transformed
+	series map[seriesKey]stages
+}
+
+func newTransformer() *transformer {
+	return &transformer{
+		charts: make(map[string]map[string]pipeline),
+		series: make(map[seriesKey]stages),
+	}
+}
+
+// start transforms the chart metrics of a chart, discarding the state of their series
+func (t *transformer) start(chart string, pipelines map[string]pipeline) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reset(chart)
+	if len(pipelines) == 0 {
+		return
+	}
+	t.charts[chart] = pipelines
+}
+
+// stop stops transforming the chart metrics of a chart
+func (t *transformer) stop(chart string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reset(chart)
+}
+
+// reset forgets the pipelines of a chart and the state of their series. callers must hold mu.
+func (t *transformer) reset(chart string) {
+	for key := range t.series {
+		if key.chart == chart {
+			delete(t.series, key)
+		}
+	}
+	delete(t.charts, chart)
+}
+
+// metric returns the transformed copy of a metric of chart. false when the transforms dropped it
+func (t *transformer) metric(chart string, m *graphx.Metric) (*graphx.Metric, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.charts[chart][m.Chart]
+	if !ok {
+		return m, true
+	}
+	f, err := strconv.ParseFloat(m.Value, 64)
+	if err != nil {
+		return m, true
+	}
+
+	key := seriesKey{chart: chart, metric: m.Chart, name: m.Name}
+	st, ok := t.series[key]
+	if !ok {
+		st = p.stages()
+		t.series[key] = st
+	}
+	out, ok := st.apply(m.TimeStamp, f)
+	if !ok {
+		return nil, false
+	}
+
+	tm := *m
+	tm.Value = format(out)
+	return &tm, true
+}
+
+// backfill transforms a backfilled series of chart in place, restarting the state of the series
+func (t *transformer) backfill(chart string, s *graphx.Series) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.charts[chart][s.Chart]
+	if !ok {
+		return
+	}
+	st := p.stages()
+	st.series(s)
+	t.series[seriesKey{chart: chart, metric: s.Chart, name: s.Name}] = st
+}
+
+// retain forgets the state of names which are no longer streamed
+func (t *transformer) retain(names map[string]struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.series {
+		if _, ok := names[key.name]; !ok {
+			delete(t.series, key)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package machinery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+var TransformTT = []struct {
+	name       string
+	transforms []graphx.Transform
+	values     []string
+	expected   []string
+}{
+	{
+		name:       "scale and offset",
+		transforms: []graphx.Transform{{Type: graphx.TransformScale, Value: 0.5}, {Type: graphx.TransformOffset, Value: 1}},
+		values:     []string{"2", "4", "6"},
+		expected:   []string{"2", "3", "4"},
+	},
+	{
+		name:       "moving average",
+		transforms: []graphx.Transform{{Type: graphx.TransformMovingAverage, Window: 2}},
+		values:     []string{"2", "4", "8"},
+		expected:   []string{"2", "3", "6"},
+	},
+	{
+		name:       "ewma",
+		transforms: []graphx.Transform{{Type: graphx.TransformEWMA, Alpha: 0.5}},
+		values:     []string{"2", "4", "8"},
+		expected:   []string{"2", "3", "5.5"},
+	},
+	{
+		name:       "rate treats decreases as counter resets",
+		transforms: []graphx.Transform{{Type: graphx.TransformRate}},
+		values:     []string{"10", "30", "50", "20"},
+		expected:   []string{"2", "2", "2"},
+	},
+	{
+		name:       "derivative",
+		transforms: []graphx.Transform{{Type: graphx.TransformDerivative}},
+		values:     []string{"10", "30", "20"},
+		expected:   []string{"2", "-1"},
+	},
+	{
+		name:       "cumulative sum",
+		transforms: []graphx.Transform{{Type: graphx.TransformCumulativeSum}},
+		values:     []string{"1", "2", "3"},
+		expected:   []string{"1", "3", "6"},
+	},
+	{
+		name:       "clamp",
+		transforms: []graphx.Transform{{Type: graphx.TransformClamp, Min: float(0), Max: float(10)}},
+		values:     []string{"-5", "5", "15"},
+		expected:   []string{"0", "5", "10"},
+	},
+	{
+		name:       "round",
+		transforms: []graphx.Transform{{Type: graphx.TransformRound, Precision: 1}},
+		values:     []string{"1.24", "1.25", "-0.06"},
+		expected:   []string{"1.2", "1.3", "-0.1"},
+	},
+	{
+		name:       "round large values",
+		transforms: []graphx.Transform{{Type: graphx.TransformRound, Precision: graphx.MaxRoundPrecision}},
+		values:     []string{"1e300", "0.5"},
+		expected:   []string{"1" + strings.Repeat("0", 300), "0.5"},
+	},
+	{
+		name:       "non numeric points pass through",
+		transforms: []graphx.Transform{{Type: graphx.TransformCumulativeSum}},
+		values:     []string{"1", "unknown", "2"},
+		expected:   []string{"1", "unknown", "3"},
+	},
+}
+
+func TestTransform(t *testing.T) {
+	for _, tt := range TransformTT {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newPipeline(tt.transforms)
+			if err != nil {
+				t.Fatalf("failed to create pipeline: %v", err)
+			}
+
+			// points are ten seconds apart
+			s := &graphx.Series{Name: "web_1", Chart: "usage"}
+			for i, v := range tt.values {
+				s.Append(int64(i*10), v)
+			}
+			p.stages().series(s)
+			if !reflect.DeepEqual(s.Values, tt.expected) {
+				t.Fatalf("got: %v want: %v", s.Values, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTransformerContinuesBackfill(t *testing.T) {
+	p, err := newPipeline([]graphx.Transform{{Type: graphx.TransformCumulativeSum}})
+	if err != nil {
+		t.Fatalf("failed to create pipeline: %v", err)
+	}
+	tr := newTransformer()
+	tr.start("http", map[string]pipeline{"usage": p})
+
+	s := &graphx.Series{Name: "web_1", Chart: "usage", TimeStamps: []int64{10, 20}, Values: []string{"1", "2"}}
+	tr.backfill("http", s)
+	if !reflect.DeepEqual(s.Values, []string{"1", "3"}) {
+		t.Fatalf("unexpected backfill: %v", s.Values)
+	}
+
+	m := &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 30, Value: "3"}
+	got, ok := tr.metric("http", m)
+	if !ok || got.Value != "6" {
+		t.Fatalf("expected the live point to continue the backfill got: %+v", got)
+	}
+	if m.Value != "3" {
+		t.Fatalf("expected the received metric to be left untouched got: %v", m.Value)
+	}
+
+	// non numeric points pass through as they do in a backfill
+	unknown := &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 40, Value: "unknown"}
+	if got, ok := tr.metric("http", unknown); !ok || got.Value != "unknown" {
+		t.Fatalf("expected a non numeric point to pass through got: %+v", got)
+	}
+
+	// other chart metrics pass through
+	other := &graphx.Metric{Name: "web_1", Chart: "rss", TimeStamp: 30, Value: "3"}
+	if got, ok := tr.metric("http", other); !ok || got != other {
+		t.Fatalf("expected an untransformed chart metric to pass through got: %+v", got)
+	}
+
+	// a chart metric of another chart sharing the name is not transformed
+	grpc := &graphx.Metric{Name: "web_1", Chart: "usage", TimeStamp: 30, Value: "3"}
+	if got, ok := tr.metric("grpc", grpc); !ok || got != grpc {
+		t.Fatalf("expected the chart metric of another chart to pass through got: %+v", got)
+	}
+}
+
+func TestTransformInvalid(t *testing.T) {
+	for _, tr := range []graphx.Transform{
+		{Type: "unknown"},
+		{Type: graphx.TransformMovingAverage},
+		{Type: graphx.TransformEWMA, Alpha: 1.5},
+		{Type: graphx.TransformClamp},
+		{Type: graphx.TransformClamp, Min: float(2), Max: float(1)},
+		{Type: graphx.TransformRound, Precision: -1},
+		{Type: graphx.TransformRound, Precision: graphx.MaxRoundPrecision + 1},
+	} {
+		if _, err := newPipeline([]graphx.Transform{tr}); err == nil {
+			t.Fatalf("expected %+v to be invalid", tr)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package graphx
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// MessageType identifies the payload of a Message
+type MessageType string
+
+const (
+	// MessageMetric carries a live or row encoded historical Metric
+	MessageMetric MessageType = "metric"
+	// MessageBackfill carries a columnar Backfill
+	MessageBackfill MessageType = "backfill"
+	// MessageError reports a failure scoped to a subscription. QueryError is set when
+	// the failure is a query of a specific chart metric
+	MessageError MessageType = "error"
+	// MessageAck confirms a Control was applied
+	MessageAck MessageType = "ack"
+	// MessageDropped reports the total number of metrics a subscription discarded under backpressure
+	MessageDropped MessageType = "dropped"
+	// MessageSession identifies the session a connection is attached to. it is not sequenced
+	MessageSession MessageType = "session"
+	// MessageEnd reports a subscription whose stream ended without being cancelled by the client.
+	// the subscription no longer exists
+	MessageEnd MessageType = "end"
+	// MessageIntervals reports the interval each chart of an adaptive subscription is polled at
+	MessageIntervals MessageType = "intervals"
+	// MessageSeries reports a series which was added to or removed from the query results of a subscription
+	MessageSeries MessageType = "series"
+	// MessageAlert reports an alert of one of a subscription's charts which fired or resolved
+	MessageAlert MessageType = "alert"
+)
+
+// Message is the envelope every payload is delivered to a websocket client in.
+type Message struct {
+	Type MessageType `json:"type"`
+	// increases by one with every message of a session. used to resume a session
+	Seq uint64 `json:"seq,omitempty"`
+	// the subscription this message belongs to
+	Subscription string              `json:"subscription"`
+	Metric       *Metric             `json:"metric,omitempty"`
+	Backfill     *Backfill           `json:"backfill,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	QueryError   *QueryError         `json:"query_error,omitempty"`
+	Ack          *Ack                `json:"ack,omitempty"`
+	Session      *Session            `json:"session,omitempty"`
+	Dropped      uint64              `json:"dropped,omitempty"`
+	End          *EndOfStream        `json:"end,omitempty"`
+	Intervals    map[string]Duration `json:"intervals,omitempty"`
+	Series       *SeriesEvent        `json:"series,omitempty"`
+	Alert        *Alert              `json:"alert,omitempty"`
+}
+
+// Session is delivered when a connection attaches to a new or resumed session.
+type Session struct {
+	ID string `json:"id"`
+	// the sequence number of the latest message of the session
+	Seq uint64 `json:"seq"`
+	// true when an existing session was resumed
+	Resumed bool `json:"resumed"`
+	// true when a resumed session redelivered every missed message from its replay buffer.
+	// when false missed metrics are backfilled from the latest metric each subscription delivered
+	Replayed bool `json:"replayed"`
+}
+
+// Ack confirms a Control was applied to a subscription.
+type Ack struct {
+	Op Op `json:"op"`
+	// what an OpModify changed. absent when the subscription was restarted instead of updated
+	Diff *Diff `json:"diff,omitempty"`
+}
+
+// Op is an operation a client performs on a subscription
+type Op string
+
+const (
+	// OpSubscribe starts a new named subscription
+	OpSubscribe Op = "subscribe"
+	// OpModify replaces the descriptor of an existing subscription
+	OpModify Op = "modify"
+	// OpCancel stops an existing subscription
+	OpCancel Op = "cancel"
+	// OpResume attaches a new connection to an existing session. it must be the first message
+	OpResume Op = "resume"
+)
+
+// Control is a client request to manage subscriptions multiplexed on a single connection.
+type Control struct {
+	Op Op `json:"op"`
+	// a client chosen id for the subscription, unique to the connection
+	Subscription string `json:"subscription"`
+	// the descriptor for OpSubscribe and OpModify
+	Descriptor *ChartsDescriptor `json:"descriptor,omitempty"`
+	// the session and the sequence number of the last message received for OpResume
+	Session string `json:"session,omitempty"`
+	LastSeq uint64 `json:"last_seq,omitempty"`
+}
+
+// ParseControl decodes a Control from a client message. a bare ChartsDescriptor is
+// accepted as a subscribe, or a modify if it is already subscribed, of the unnamed
+// subscription so clients which only need a single stream may omit the envelope.
+func ParseControl(b []byte, subscribed func(id string) bool) (*Control, error) {
+	var c Control
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	if c.Op == "" {
+		var cd ChartsDescriptor
+		if err := json.Unmarshal(b, &cd); err != nil {
+			return nil, err
+		}
+		c.Op = OpSubscribe
+		if subscribed(c.Subscription) {
+			c.Op = OpModify
+		}
+		c.Descriptor = &cd
+	}
+
+	switch c.Op {
+	case OpSubscribe, OpModify:
+		if c.Descriptor == nil {
+			return nil, errors.New("descriptor is required to " + string(c.Op))
+		}
+	case OpCancel:
+	case OpResume:
+		if c.Session == "" {
+			return nil, errors.New("session is required to resume")
+		}
+	default:
+		return nil, errors.New("unknown op " + string(c.Op))
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,88 @@
+package graphx
+
+import (
+	"testing"
+)
+
+var ParseControlTT = []struct {
+	name       string
+	msg        string
+	subscribed bool
+	op         Op
+	valid      bool
+}{
+	{
+		name:  "subscribe",
+		msg:   `{"op": "subscribe", "subscription": "a", "descriptor": {"chart_names": ["cpu"]}}`,
+		op:    OpSubscribe,
+		valid: true,
+	},
+	{
+		name: "subscribe without descriptor",
+		msg:  `{"op": "subscribe", "subscription": "a"}`,
+	},
+	{
+		name: "modify without descriptor",
+		msg:  `{"op": "modify", "subscription": "a"}`,
+	},
+	{
+		name:  "cancel",
+		msg:   `{"op": "cancel", "subscription": "a"}`,
+		op:    OpCancel,
+		valid: true,
+	},
+	{
+		name:  "resume",
+		msg:   `{"op": "resume", "session": "s", "last_seq": 4}`,
+		op:    OpResume,
+		valid: true,
+	},
+	{
+		name: "resume without session",
+		msg:  `{"op": "resume", "last_seq": 4}`,
+	},
+	{
+		name: "unknown op",
+		msg:  `{"op": "pause", "subscription": "a"}`,
+	},
+	{
+		name:  "bare descriptor subscribes",
+		msg:   `{"chart_names": ["cpu"], "names": ["web_1"], "poll_interval": "1s"}`,
+		op:    OpSubscribe,
+		valid: true,
+	},
+	{
+		name:       "bare descriptor modifies a subscription",
+		msg:        `{"chart_names": ["cpu"], "names": ["web_1"], "poll_interval": "1s"}`,
+		subscribed: true,
+		op:         OpModify,
+		valid:      true,
+	},
+	{
+		name: "malformed",
+		msg:  `{"op": `,
+	},
+}
+
+func TestParseControl(t *testing.T) {
+	for _, tt := range ParseControlTT {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseControl([]byte(tt.msg), func(string) bool { return tt.subscribed })
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("expected control to be invalid got %+v", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected control to be valid got: %v", err)
+			}
+			if c.Op != tt.op {
+				t.Fatalf("got op: %v want: %v", c.Op, tt.op)
+			}
+			if (c.Op == OpSubscribe || c.Op == OpModify) && c.Descriptor == nil {
+				t.Fatalf("expected a descriptor")
+			}
+		})
+	}
+}
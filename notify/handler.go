@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/ldelossa/jsonerr"
+)
+
+const (
+	DeliveriesErrCode = "graphx.deliveries_handler"
+)
+
+// DeliveriesResult is the response of the DeliveriesHandler
+type DeliveriesResult struct {
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+// DeliveriesHandler returns the notifier's delivery log as JSON, oldest first.
+func DeliveriesHandler(n *Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			log.Printf("methd not allowed")
+			resp := jsonerr.NewResponse("", DeliveriesErrCode, "method not allowed")
+			jsonerr.Error(w, resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(DeliveriesResult{Deliveries: n.Deliveries()})
+		if err != nil {
+			log.Printf("failed to write deliveries: %v", err)
+		}
+	}
+}
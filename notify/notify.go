@@ -0,0 +1,503 @@
+// Package notify delivers the alert events of a graphx.AlertSource to webhooks.
+//
+// events are collected into groups for a grouping window so an incident firing many alerts
+// results in a single notification per webhook. each notification's JSON body is rendered
+// from the webhook's template, delivered with retries and recorded in a delivery log.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// Webhook is an endpoint notifications are POSTed to
+type Webhook struct {
+	// identifies the webhook in the delivery log
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// a text/template rendering the JSON body from a Notification. the json function
+	// marshals its argument. when empty the Notification itself is delivered
+	Template string            `json:"template,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	// only alerts with every one of these labels are delivered to the webhook
+	Match map[string]string `json:"match,omitempty"`
+}
+
+// Opts are the options for a Notifier
+type Opts struct {
+	Webhooks []Webhook
+	// how long events are collected into a group before it is delivered
+	GroupWindow time.Duration
+	// the alert labels events are grouped by. "chart", "metric" and "rule" group by the
+	// alert's fields. defaults to chart and rule
+	GroupBy []string
+	// how long an alert is not delivered again in the state it was last delivered in, such as
+	// when the evaluator restarts. an alert changing state is always delivered
+	DedupWindow time.Duration
+	// the number of times a failed delivery is retried. the delay before the first retry
+	// doubles with every further retry up to MaxBackoff
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// the timeout of each delivery attempt
+	Timeout time.Duration
+	// the number of deliveries the delivery log retains
+	LogSize int
+}
+
+// DefaultOpts are reasonable options for a Notifier without webhooks
+var DefaultOpts = Opts{
+	GroupWindow: 10 * time.Second,
+	GroupBy:     []string{"chart", "rule"},
+	DedupWindow: 5 * time.Minute,
+	MaxRetries:  5,
+	Backoff:     time.Second,
+	MaxBackoff:  time.Minute,
+	Timeout:     10 * time.Second,
+	LogSize:     1000,
+}
+
+// Notification is a group of alerts delivered to a webhook. it is the data webhook templates
+// are executed with.
+type Notification struct {
+	Webhook string `json:"webhook"`
+	// identifies the group, made of the values the alerts were grouped by
+	Group string `json:"group"`
+	// the values the alerts were grouped by
+	Labels map[string]string `json:"labels"`
+	Alerts []*graphx.Alert   `json:"alerts"`
+	// the number of firing and resolved alerts
+	Firing   int `json:"firing"`
+	Resolved int `json:"resolved"`
+}
+
+// Delivery is an entry of the delivery log
+type Delivery struct {
+	Webhook string `json:"webhook"`
+	Group   string `json:"group"`
+	Alerts  int    `json:"alerts"`
+	// the number of attempts made and the status code of the last response
+	Attempts int `json:"attempts"`
+	Status   int `json:"status,omitempty"`
+	// why the last attempt failed
+	Error     string `json:"error,omitempty"`
+	Delivered bool   `json:"delivered"`
+	// the Unix timestamp of the last attempt
+	At int64 `json:"at"`
+}
+
+// Notifier groups alert events and delivers them to webhooks. Notify is the function to
+// watch an AlertSource with.
+type Notifier struct {
+	opts      Opts
+	client    *http.Client
+	templates map[string]*template.Template
+	// cancelled by Close to abandon retries
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the groups collecting events and the running deliveries
+	wg sync.WaitGroup
+
+	mu sync.Mutex
+	// the groups collecting events keyed by group
+	groups map[string]*group
+	// the state each alert was last delivered in
+	delivered map[alertID]delivered
+	// the delivery log, a ring of LogSize entries starting at next once full
+	log    []Delivery
+	next   int
+	closed bool
+}
+
+// group is the events collected for a group during its window
+type group struct {
+	key    string
+	labels map[string]string
+	// the latest event of each alert
+	alerts map[alertID]*graphx.Alert
+	timer  *time.Timer
+}
+
+// alertID identifies the alert of a rule for a series
+type alertID struct {
+	chart  string
+	metric string
+	rule   string
+	name   string
+}
+
+type delivered struct {
+	state graphx.AlertState
+	at    time.Time
+}
+
+// New is a constructor for a Notifier. zero durations, sizes and GroupBy take their value from
+// DefaultOpts. a zero MaxRetries makes a single attempt at each delivery.
+func New(opts Opts) (*Notifier, error) {
+	if opts.GroupWindow <= 0 {
+		opts.GroupWindow = DefaultOpts.GroupWindow
+	}
+	if len(opts.GroupBy) == 0 {
+		opts.GroupBy = DefaultOpts.GroupBy
+	}
+	if opts.DedupWindow <= 0 {
+		opts.DedupWindow = DefaultOpts.DedupWindow
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultOpts.Backoff
+	}
+	if opts.MaxBackoff < opts.Backoff {
+		opts.MaxBackoff = opts.Backoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultOpts.Timeout
+	}
+	if opts.LogSize <= 0 {
+		opts.LogSize = DefaultOpts.LogSize
+	}
+
+	templates := make(map[string]*template.Template, len(opts.Webhooks))
+	for _, wh := range opts.Webhooks {
+		if wh.Name == "" {
+			return nil, errors.New("webhook requires a name")
+		}
+		if _, ok := templates[wh.Name]; ok {
+			return nil, fmt.Errorf("duplicate webhook %s", wh.Name)
+		}
+		u, err := url.Parse(wh.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("webhook %s has invalid url %q", wh.Name, wh.URL)
+		}
+		var t *template.Template
+		if wh.Template != "" {
+			t, err = template.New(wh.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(wh.Template)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s has invalid template: %v", wh.Name, err)
+			}
+		}
+		templates[wh.Name] = t
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		opts:      opts,
+		client:    &http.Client{Timeout: opts.Timeout},
+		templates: templates,
+		ctx:       ctx,
+		cancel:    cancel,
+		groups:    make(map[string]*group),
+		delivered: make(map[alertID]delivered),
+	}, nil
+}
+
+// Notify adds an alert event to its group, starting the group's window if it is the first.
+// an alert last delivered in the same state within the dedup window is discarded. Notify does
+// not block.
+func (n *Notifier) Notify(a *graphx.Alert) {
+	if a.State != graphx.AlertFiring && a.State != graphx.AlertResolved {
+		return
+	}
+	id := alertID{chart: a.Chart, metric: a.Metric, rule: a.Rule, name: a.Name}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	if d, ok := n.delivered[id]; ok && d.state == a.State && time.Since(d.at) < n.opts.DedupWindow {
+		return
+	}
+
+	key, labels := n.groupOf(a)
+	g, ok := n.groups[key]
+	if !ok {
+		g = &group{
+			key:    key,
+			labels: labels,
+			alerts: make(map[alertID]*graphx.Alert),
+		}
+		n.wg.Add(1)
+		g.timer = time.AfterFunc(n.opts.GroupWindow, func() { n.flush(key, false) })
+		n.groups[key] = g
+	}
+	// an alert which fired and resolved within the window is delivered in its latest state
+	g.alerts[id] = a
+}
+
+// Close delivers the groups collecting events with a single attempt each, then abandons
+// running deliveries and their retries and waits for them to return.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	n.closed = true
+	var keys []string
+	for key, g := range n.groups {
+		if g.timer.Stop() {
+			keys = append(keys, key)
+		}
+	}
+	n.mu.Unlock()
+
+	var final sync.WaitGroup
+	for _, key := range keys {
+		final.Add(1)
+		go func(key string) {
+			defer final.Done()
+			n.flush(key, true)
+		}(key)
+	}
+	final.Wait()
+	n.cancel()
+	n.wg.Wait()
+	return nil
+}
+
+// Deliveries returns the delivery log, oldest first.
+func (n *Notifier) Deliveries() []Delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	deliveries := make([]Delivery, 0, len(n.log))
+	deliveries = append(deliveries, n.log[n.next:]...)
+	deliveries = append(deliveries, n.log[:n.next]...)
+	return deliveries
+}
+
+// groupOf returns the key and labels of an alert's group
+func (n *Notifier) groupOf(a *graphx.Alert) (string, map[string]string) {
+	labels := make(map[string]string, len(n.opts.GroupBy))
+	values := make([]string, 0, len(n.opts.GroupBy))
+	for _, label := range n.opts.GroupBy {
+		var v string
+		switch label {
+		case "chart":
+			v = a.Chart
+		case "metric":
+			v = a.Metric
+		case "rule":
+			v = a.Rule
+		default:
+			v = a.Labels[label]
+		}
+		labels[label] = v
+		values = append(values, label+"="+v)
+	}
+	return "{" + strings.Join(values, ",") + "}", labels
+}
+
+// flush ends a group's window and delivers its alerts to every webhook they match. a final
+// flush makes a single attempt at each delivery and waits for them
+func (n *Notifier) flush(key string, final bool) {
+	n.mu.Lock()
+	g, ok := n.groups[key]
+	if !ok {
+		n.mu.Unlock()
+		return
+	}
+	delete(n.groups, key)
+	// the group is accounted for until its deliveries are
+	defer n.wg.Done()
+
+	now := time.Now()
+	alerts := make([]*graphx.Alert, 0, len(g.alerts))
+	for _, a := range g.alerts {
+		alerts = append(alerts, a)
+	}
+	for id, d := range n.delivered {
+		if now.Sub(d.at) >= n.opts.DedupWindow {
+			delete(n.delivered, id)
+		}
+	}
+	n.mu.Unlock()
+
+	graphx.SortAlerts(alerts)
+
+	retries := n.opts.MaxRetries
+	var deliveries sync.WaitGroup
+	if final {
+		retries = 0
+		defer deliveries.Wait()
+	}
+	for _, wh := range n.opts.Webhooks {
+		nt := &Notification{
+			Webhook: wh.Name,
+			Group:   g.key,
+			Labels:  g.labels,
+			Alerts:  []*graphx.Alert{},
+		}
+		for _, a := range alerts {
+			if !matches(wh.Match, a.Labels) {
+				continue
+			}
+			nt.Alerts = append(nt.Alerts, a)
+			if a.State == graphx.AlertFiring {
+				nt.Firing++
+			} else {
+				nt.Resolved++
+			}
+		}
+		if len(nt.Alerts) == 0 {
+			continue
+		}
+
+		n.wg.Add(1)
+		deliveries.Add(1)
+		go func(wh Webhook) {
+			defer n.wg.Done()
+			defer deliveries.Done()
+			d := n.deliver(wh, nt, retries)
+			if d.Delivered {
+				n.markDelivered(nt.Alerts, now)
+			}
+			n.record(d)
+		}(wh)
+	}
+}
+
+// markDelivered records the state alerts of a group flushed at were delivered in. a state
+// delivered from a later group is kept
+func (n *Notifier) markDelivered(alerts []*graphx.Alert, at time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, a := range alerts {
+		id := alertID{chart: a.Chart, metric: a.Metric, rule: a.Rule, name: a.Name}
+		if d, ok := n.delivered[id]; ok && d.at.After(at) {
+			continue
+		}
+		n.delivered[id] = delivered{state: a.State, at: at}
+	}
+}
+
+// deliver renders a notification and POSTs it to a webhook, retrying failed attempts up to retries times
+func (n *Notifier) deliver(wh Webhook, nt *Notification, retries int) Delivery {
+	d := Delivery{
+		Webhook: wh.Name,
+		Group:   nt.Group,
+		Alerts:  len(nt.Alerts),
+	}
+
+	body, err := n.render(wh, nt)
+	if err != nil {
+		d.Error = err.Error()
+		d.At = time.Now().Unix()
+		return d
+	}
+
+	backoff := n.opts.Backoff
+	for {
+		d.Attempts++
+		var retry bool
+		d.Status, retry, err = n.post(wh, body)
+		d.At = time.Now().Unix()
+		if err == nil {
+			d.Delivered = true
+			d.Error = ""
+			return d
+		}
+		d.Error = err.Error()
+		if !retry || d.Attempts > retries {
+			return d
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-n.ctx.Done():
+			d.Error = fmt.Sprintf("notifier closed after: %v", err)
+			return d
+		}
+		backoff *= 2
+		if backoff > n.opts.MaxBackoff {
+			backoff = n.opts.MaxBackoff
+		}
+	}
+}
+
+// render returns the JSON body of a notification
+func (n *Notifier) render(wh Webhook, nt *Notification) ([]byte, error) {
+	t := n.templates[wh.Name]
+	if t == nil {
+		return json.Marshal(nt)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, nt); err != nil {
+		return nil, fmt.Errorf("failed to render template: %v", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("template did not render valid json")
+	}
+	return buf.Bytes(), nil
+}
+
+// post makes a single delivery attempt. retry reports whether a failed attempt may succeed
+// when repeated, which a rejected request will not
+func (n *Notifier) post(wh Webhook, body []byte) (status int, retry bool, err error) {
+	// closing the notifier abandons a running attempt
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range wh.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return resp.StatusCode, true, fmt.Errorf("webhook responded %s", resp.Status)
+	default:
+		return resp.StatusCode, false, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+}
+
+// record appends a delivery to the delivery log, replacing the oldest once it is full
+func (n *Notifier) record(d Delivery) {
+	if !d.Delivered {
+		log.Printf("notify: delivery of %s to %s failed after %d attempts: %s", d.Group, d.Webhook, d.Attempts, d.Error)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.log) < n.opts.LogSize {
+		n.log = append(n.log, d)
+		return
+	}
+	n.log[n.next] = d
+	n.next = (n.next + 1) % len(n.log)
+}
+
+func matches(match map[string]string, labels map[string]string) bool {
+	for k, v := range match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,248 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+// receiver is a stand-in webhook endpoint recording the bodies it receives. it responds
+// with the statuses in fail before accepting requests
+type receiver struct {
+	mu     sync.Mutex
+	fail   []int
+	bodies [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.fail) > 0 {
+		w.WriteHeader(rc.fail[0])
+		rc.fail = rc.fail[1:]
+		return
+	}
+	rc.bodies = append(rc.bodies, b)
+}
+
+func (rc *receiver) received() [][]byte {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([][]byte(nil), rc.bodies...)
+}
+
+// waitDeliveries waits until the delivery log has n entries
+func waitDeliveries(t *testing.T, nt *Notifier, n int) []Delivery {
+	deadline := time.Now().Add(time.Second)
+	for {
+		deliveries := nt.Deliveries()
+		if len(deliveries) >= n {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d deliveries got %v", n, deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func alert(name string, state graphx.AlertState) *graphx.Alert {
+	return &graphx.Alert{
+		Rule:   "busy",
+		Chart:  "cpu",
+		Metric: "usage",
+		Name:   name,
+		State:  state,
+		Labels: map[string]string{"severity": "page"},
+		Value:  "0.9",
+	}
+}
+
+func newNotifier(t *testing.T, opts Opts) *Notifier {
+	if opts.GroupWindow == 0 {
+		opts.GroupWindow = 20 * time.Millisecond
+	}
+	opts.Backoff = 5 * time.Millisecond
+	n, err := New(opts)
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	return n
+}
+
+func TestNotifierGroupsAndRenders(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(t, Opts{Webhooks: []Webhook{{
+		Name:     "chat",
+		URL:      srv.URL,
+		Template: `{"text": {{json (printf "%d firing in %s" .Firing .Group)}}, "names": [{{range $i, $a := .Alerts}}{{if $i}},{{end}}{{json $a.Name}}{{end}}]}`,
+	}}})
+	defer n.Close()
+
+	n.Notify(alert("web_2", graphx.AlertFiring))
+	n.Notify(alert("web_1", graphx.AlertFiring))
+	// pending alerts are not notified
+	n.Notify(alert("web_3", graphx.AlertPending))
+
+	deliveries := waitDeliveries(t, n, 1)
+	if d := deliveries[0]; !d.Delivered || d.Alerts != 2 || d.Attempts != 1 || d.Status != http.StatusOK {
+		t.Fatalf("unexpected delivery: %+v", d)
+	}
+
+	bodies := rc.received()
+	var body struct {
+		Text  string   `json:"text"`
+		Names []string `json:"names"`
+	}
+	if err := json.Unmarshal(bodies[0], &body); err != nil {
+		t.Fatalf("failed to decode body %s: %v", bodies[0], err)
+	}
+	if body.Text != "2 firing in {chart=cpu,rule=busy}" || len(body.Names) != 2 || body.Names[0] != "web_1" {
+		t.Fatalf("unexpected body: %s", bodies[0])
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	rc := &receiver{fail: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(t, Opts{MaxRetries: 3, Webhooks: []Webhook{{Name: "ops", URL: srv.URL}}})
+	defer n.Close()
+
+	n.Notify(alert("web_1", graphx.AlertFiring))
+	d := waitDeliveries(t, n, 1)[0]
+	if !d.Delivered || d.Attempts != 3 || d.Error != "" {
+		t.Fatalf("expected delivery on the third attempt got: %+v", d)
+	}
+
+	var nt Notification
+	if err := json.Unmarshal(rc.received()[0], &nt); err != nil {
+		t.Fatalf("failed to decode notification: %v", err)
+	}
+	if nt.Webhook != "ops" || nt.Firing != 1 || nt.Alerts[0].Name != "web_1" {
+		t.Fatalf("unexpected notification: %+v", nt)
+	}
+}
+
+func TestNotifierDoesNotRetryRejected(t *testing.T) {
+	rc := &receiver{fail: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(t, Opts{MaxRetries: 3, Webhooks: []Webhook{{Name: "ops", URL: srv.URL}}})
+	defer n.Close()
+
+	n.Notify(alert("web_1", graphx.AlertFiring))
+	d := waitDeliveries(t, n, 1)[0]
+	if d.Delivered || d.Attempts != 1 || d.Status != http.StatusBadRequest {
+		t.Fatalf("expected a single rejected attempt got: %+v", d)
+	}
+}
+
+func TestNotifierDedup(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(t, Opts{
+		DedupWindow: time.Minute,
+		Webhooks: []Webhook{
+			{Name: "ops", URL: srv.URL},
+			// alerts without the label are not delivered to the webhook
+			{Name: "tickets", URL: srv.URL, Match: map[string]string{"severity": "ticket"}},
+		},
+	})
+	defer n.Close()
+
+	n.Notify(alert("web_1", graphx.AlertFiring))
+	waitDeliveries(t, n, 1)
+
+	// delivered in the same state again within the window
+	n.Notify(alert("web_1", graphx.AlertFiring))
+	n.Notify(alert("web_1", graphx.AlertResolved))
+	deliveries := waitDeliveries(t, n, 2)
+
+	time.Sleep(50 * time.Millisecond)
+	if len(n.Deliveries()) != 2 || len(rc.received()) != 2 {
+		t.Fatalf("expected the repeated firing alert to be discarded got %v", n.Deliveries())
+	}
+	var nt Notification
+	if err := json.Unmarshal(rc.received()[1], &nt); err != nil {
+		t.Fatalf("failed to decode notification: %v", err)
+	}
+	if deliveries[1].Webhook != "ops" || nt.Resolved != 1 || nt.Firing != 0 {
+		t.Fatalf("expected the resolved alert to be delivered got %+v", nt)
+	}
+}
+
+func TestNotifierDedupsDeliveredOnly(t *testing.T) {
+	rc := &receiver{fail: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(t, Opts{DedupWindow: time.Minute, Webhooks: []Webhook{{Name: "ops", URL: srv.URL}}})
+	defer n.Close()
+
+	n.Notify(alert("web_1", graphx.AlertFiring))
+	if d := waitDeliveries(t, n, 1)[0]; d.Delivered {
+		t.Fatalf("expected the first delivery to be rejected got %+v", d)
+	}
+
+	// the alert was never delivered so it is not discarded
+	n.Notify(alert("web_1", graphx.AlertFiring))
+	if d := waitDeliveries(t, n, 2)[1]; !d.Delivered {
+		t.Fatalf("expected the repeated alert to be delivered got %+v", d)
+	}
+	if len(rc.received()) != 1 {
+		t.Fatalf("expected a single accepted notification got %d", len(rc.received()))
+	}
+}
+
+func TestNotifierCloseDeliversPending(t *testing.T) {
+	rc := &receiver{fail: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := newNotifier(t, Opts{
+		GroupWindow: time.Hour,
+		MaxRetries:  3,
+		Webhooks:    []Webhook{{Name: "ops", URL: srv.URL}, {Name: "chat", URL: srv.URL}},
+	})
+	n.Notify(alert("web_1", graphx.AlertFiring))
+	n.Close()
+
+	// each webhook is attempted once, the failed attempt is not retried
+	deliveries := n.Deliveries()
+	if len(deliveries) != 2 || len(rc.received()) != 1 {
+		t.Fatalf("expected a single attempt per webhook got %+v", deliveries)
+	}
+	for _, d := range deliveries {
+		if d.Attempts != 1 {
+			t.Fatalf("expected a single attempt got %+v", d)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, wh := range []Webhook{
+		{URL: "http://localhost"},
+		{Name: "ops", URL: "localhost"},
+		{Name: "ops", URL: "http://localhost", Template: "{{"},
+	} {
+		if _, err := New(Opts{Webhooks: []Webhook{wh}}); err == nil {
+			t.Fatalf("expected invalid webhook %+v to be rejected", wh)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodels "github.com/prometheus/common/model"
+)
+
+// BreakerOpts are the options for a Breaker
+type BreakerOpts struct {
+	// the number of times a query failing with a transient error is retried
+	MaxRetries int
+	// the delay before the first retry. it doubles with every further retry up to MaxBackoff
+	// and is jittered so sessions retrying together spread out
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// the number of consecutive failed queries which opens the circuit
+	FailureThreshold int
+	// how long the circuit stays open before a single query is let through to probe for recovery
+	OpenTimeout time.Duration
+}
+
+// DefaultBreakerOpts are reasonable options for a Breaker
+var DefaultBreakerOpts = BreakerOpts{
+	MaxRetries:       2,
+	Backoff:          100 * time.Millisecond,
+	MaxBackoff:       2 * time.Second,
+	FailureThreshold: 5,
+	OpenTimeout:      10 * time.Second,
+}
+
+// BreakerState is the state of a Breaker's circuit
+type BreakerState string
+
+const (
+	// BreakerClosed lets every query through
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen fails every query without issuing it
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single probe through, its result closes or reopens the circuit
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// CircuitOpenError is returned instead of issuing a query while the circuit is open
+type CircuitOpenError struct {
+	// when the circuit opened and when the next probe is let through
+	Since time.Time
+	Retry time.Time
+	// the failure which opened the circuit
+	Err error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("prometheus unavailable since %s, retrying at %s: %v",
+		e.Since.Format(time.RFC3339), e.Retry.Format(time.RFC3339), e.Err)
+}
+
+// Breaker is a promapi.API retrying instant and range queries which fail with transient errors
+// and failing them fast once prometheus is considered down. all other methods are passed
+// through to the wrapped client.
+//
+// a single Breaker should wrap the client of a datasource shared by every session so that
+// polling of the datasource pauses for all sessions while its circuit is open.
+type Breaker struct {
+	promapi.API
+	opts BreakerOpts
+
+	mu    sync.Mutex
+	state BreakerState
+	// consecutive failed queries while closed
+	failures int
+	opened   time.Time
+	// the failure which opened the circuit
+	err error
+	// set while the half open probe is in flight
+	probing bool
+	rand    *rand.Rand
+}
+
+// NewBreaker is a constructor for a Breaker.
+func NewBreaker(client promapi.API, opts BreakerOpts) *Breaker {
+	return &Breaker{
+		API:   client,
+		opts:  opts,
+		state: BreakerClosed,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// State returns the current state of the circuit.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) Query(ctx context.Context, query string, ts time.Time) (prommodels.Value, api.Warnings, error) {
+	var value prommodels.Value
+	var warnings api.Warnings
+	err := b.do(ctx, func() error {
+		var err error
+		value, warnings, err = b.API.Query(ctx, query, ts)
+		return err
+	})
+	return value, warnings, err
+}
+
+func (b *Breaker) QueryRange(ctx context.Context, query string, r promapi.Range) (prommodels.Value, api.Warnings, error) {
+	var value prommodels.Value
+	var warnings api.Warnings
+	err := b.do(ctx, func() error {
+		var err error
+		value, warnings, err = b.API.QueryRange(ctx, query, r)
+		return err
+	})
+	return value, warnings, err
+}
+
+// do issues a query through the circuit, retrying transient failures until ctx is done
+func (b *Breaker) do(ctx context.Context, query func() error) error {
+	err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = query()
+		if err == nil || !transient(ctx, err) || attempt >= b.opts.MaxRetries {
+			break
+		}
+
+		t := time.NewTimer(b.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			b.record(ctx, err)
+			return err
+		case <-t.C:
+		}
+	}
+
+	b.record(ctx, err)
+	return err
+}
+
+// allow returns a CircuitOpenError unless a query may be issued
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	retry := b.opened.Add(b.opts.OpenTimeout)
+	switch b.state {
+	case BreakerOpen:
+		if time.Now().Before(retry) {
+			break
+		}
+		log.Printf("prometheus breaker: probing for recovery")
+		b.state = BreakerHalfOpen
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			break
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+
+	return &CircuitOpenError{
+		Since: b.opened,
+		Retry: retry,
+		Err:   b.err,
+	}
+}
+
+// record updates the circuit with the outcome of a query
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == BreakerHalfOpen
+	if probe {
+		b.probing = false
+	}
+
+	switch {
+	case err == nil:
+		if b.state != BreakerClosed {
+			log.Printf("prometheus breaker: recovered after %v. closing circuit", time.Since(b.opened))
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		b.err = nil
+	case !failure(ctx, err):
+		// the query was at fault or abandoned, not prometheus
+	case probe:
+		log.Printf("prometheus breaker: probe failed. reopening circuit: %v", err)
+		b.open(err)
+	default:
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			log.Printf("prometheus breaker: %d consecutive failures. opening circuit for %v: %v", b.failures, b.opts.OpenTimeout, err)
+			b.open(err)
+		}
+	}
+}
+
+// open opens the circuit. callers must hold mu.
+func (b *Breaker) open(err error) {
+	b.state = BreakerOpen
+	b.opened = time.Now()
+	b.err = err
+	b.failures = 0
+}
+
+// backoff returns the jittered delay before the provided retry attempt. callers must not hold mu.
+func (b *Breaker) backoff(attempt int) time.Duration {
+	d := b.opts.Backoff << uint(attempt)
+	if d > b.opts.MaxBackoff || d <= 0 {
+		d = b.opts.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	// equal jitter, wait at least half the delay
+	b.mu.Lock()
+	j := time.Duration(b.rand.Int63n(int64(d)/2 + 1))
+	b.mu.Unlock()
+	return d/2 + j
+}
+
+// failure reports whether an error indicates prometheus is unhealthy rather then the query being invalid
+func failure(ctx context.Context, err error) bool {
+	if ctx.Err() == context.Canceled {
+		return false
+	}
+	if apiErr, ok := err.(*promapi.Error); ok {
+		switch apiErr.Type {
+		case promapi.ErrServer, promapi.ErrTimeout, promapi.ErrBadResponse:
+			return true
+		default:
+			return false
+		}
+	}
+	// transport errors such as refused connections
+	return true
+}
+
+// transient reports whether a failed query is worth retrying
+func transient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if apiErr, ok := err.(*promapi.Error); ok {
+		// prometheus timing out a query will time out again
+		return apiErr.Type == promapi.ErrServer || apiErr.Type == promapi.ErrBadResponse
+	}
+	return true
+}
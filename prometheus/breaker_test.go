@@ -0,0 +1,124 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodels "github.com/prometheus/common/model"
+)
+
+// flakyAPI fails instant queries with err while it is set and counts every query issued
+type flakyAPI struct {
+	promapi.API
+	mu      sync.Mutex
+	err     error
+	queries int
+}
+
+func (f *flakyAPI) Query(ctx context.Context, query string, ts time.Time) (prommodels.Value, api.Warnings, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries++
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	return prommodels.Vector{}, nil, nil
+}
+
+func (f *flakyAPI) set(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
+
+func (f *flakyAPI) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries
+}
+
+var testBreakerOpts = BreakerOpts{
+	MaxRetries:       2,
+	Backoff:          time.Millisecond,
+	MaxBackoff:       4 * time.Millisecond,
+	FailureThreshold: 2,
+	OpenTimeout:      50 * time.Millisecond,
+}
+
+var BreakerRetriesTT = []struct {
+	name    string
+	err     error
+	queries int
+}{
+	{
+		name:    "transport errors are retried",
+		err:     errors.New("connection refused"),
+		queries: 3,
+	},
+	{
+		name:    "server errors are retried",
+		err:     &promapi.Error{Type: promapi.ErrServer},
+		queries: 3,
+	},
+	{
+		name:    "bad queries are not retried",
+		err:     &promapi.Error{Type: promapi.ErrBadData},
+		queries: 1,
+	},
+}
+
+func TestBreakerRetries(t *testing.T) {
+	for _, tt := range BreakerRetriesTT {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &flakyAPI{err: tt.err}
+			b := NewBreaker(fake, testBreakerOpts)
+
+			_, _, err := b.Query(context.Background(), "up", time.Now())
+			if err != tt.err {
+				t.Fatalf("got: %v want: %v", err, tt.err)
+			}
+			if fake.count() != tt.queries {
+				t.Fatalf("got: %d queries want: %d", fake.count(), tt.queries)
+			}
+		})
+	}
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	fake := &flakyAPI{err: errors.New("connection refused")}
+	b := NewBreaker(fake, testBreakerOpts)
+	ctx := context.Background()
+
+	for i := 0; i < testBreakerOpts.FailureThreshold; i++ {
+		b.Query(ctx, "up", time.Now())
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected circuit to open got: %v", b.State())
+	}
+
+	// queries fail fast without reaching prometheus while open
+	issued := fake.count()
+	_, _, err := b.Query(ctx, "up", time.Now())
+	if _, ok := err.(*CircuitOpenError); !ok {
+		t.Fatalf("expected CircuitOpenError got: %v", err)
+	}
+	if fake.count() != issued {
+		t.Fatalf("expected no queries while circuit is open")
+	}
+
+	// a probe after the open timeout closes the circuit once prometheus recovers
+	fake.set(nil)
+	time.Sleep(testBreakerOpts.OpenTimeout)
+	_, _, err = b.Query(ctx, "up", time.Now())
+	if err != nil {
+		t.Fatalf("expected probe to succeed got: %v", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected circuit to close got: %v", b.State())
+	}
+}
@@ -0,0 +1,379 @@
+package prometheus
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/prometheus/client_golang/api"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodels "github.com/prometheus/common/model"
+)
+
+// CacheOpts are the options for a Cache
+type CacheOpts struct {
+	// the fraction of a query's poll interval instant results are cached for
+	InstantFraction float64
+	// how long instant results are cached for when the poll interval is unknown
+	InstantTTL time.Duration
+	// range results newer then this are never cached since prometheus may still be ingesting them
+	RangeSettle time.Duration
+	// the total number of samples retained across all cached results
+	MaxSamples int
+}
+
+// DefaultCacheOpts are reasonable options for a Cache
+var DefaultCacheOpts = CacheOpts{
+	InstantFraction: 0.5,
+	InstantTTL:      time.Second,
+	RangeSettle:     time.Minute,
+	MaxSamples:      1000000,
+}
+
+// CacheStats are the hit and miss statistics of a Cache
+type CacheStats struct {
+	InstantHits   uint64 `json:"instant_hits"`
+	InstantMisses uint64 `json:"instant_misses"`
+	RangeHits     uint64 `json:"range_hits"`
+	// range queries served partially from cache, fetching only the missing head or tail
+	RangePartialHits uint64 `json:"range_partial_hits"`
+	RangeMisses      uint64 `json:"range_misses"`
+	Evictions        uint64 `json:"evictions"`
+	// the number of samples currently cached
+	Samples int `json:"samples"`
+}
+
+// Cache is a promapi.API caching the results of instant and range queries.
+// all other methods are passed through to the wrapped client.
+//
+// range results are cached by query and step on a grid aligned to multiples of the step,
+// so overlapping range queries only fetch the portion of the range not already cached.
+type Cache struct {
+	// accessed atomically, first in the struct to guarantee 64 bit alignment
+	stats CacheStats
+
+	promapi.API
+	opts CacheOpts
+
+	mu sync.Mutex
+	// entries in least recently used order, front is most recent
+	lru     *list.List
+	entries map[cacheKey]*list.Element
+	samples int
+}
+
+type cacheKey struct {
+	query string
+	// zero for instant queries
+	step time.Duration
+}
+
+type cacheEntry struct {
+	key cacheKey
+	// instant results, the time they were evaluated at and when they expire
+	vector  prommodels.Vector
+	ts      time.Time
+	expires time.Time
+	// range results and the aligned range they cover
+	matrix     prommodels.Matrix
+	start, end time.Time
+	samples    int
+}
+
+// NewCache is a constructor for a Cache wrapping client.
+func NewCache(client promapi.API, opts CacheOpts) *Cache {
+	return &Cache{
+		API:     client,
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+}
+
+// Stats returns the cache's hit and miss statistics
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	samples := c.samples
+	c.mu.Unlock()
+
+	return CacheStats{
+		InstantHits:      atomic.LoadUint64(&c.stats.InstantHits),
+		InstantMisses:    atomic.LoadUint64(&c.stats.InstantMisses),
+		RangeHits:        atomic.LoadUint64(&c.stats.RangeHits),
+		RangePartialHits: atomic.LoadUint64(&c.stats.RangePartialHits),
+		RangeMisses:      atomic.LoadUint64(&c.stats.RangeMisses),
+		Evictions:        atomic.LoadUint64(&c.stats.Evictions),
+		Samples:          samples,
+	}
+}
+
+// Query returns a cached vector if one evaluated within the instant ttl of ts was retrieved within
+// the instant ttl. only queries of the current time are cached, historical queries and other
+// result types are passed through.
+func (c *Cache) Query(ctx context.Context, query string, ts time.Time) (prommodels.Value, api.Warnings, error) {
+	key := cacheKey{query: query}
+	ttl := c.opts.InstantTTL
+	if d, ok := graphx.PollIntervalFromContext(ctx); ok {
+		ttl = time.Duration(float64(d) * c.opts.InstantFraction)
+	}
+	now := time.Now()
+	if now.Sub(ts) > ttl || ts.Sub(now) > ttl {
+		return c.API.Query(ctx, query, ts)
+	}
+
+	c.mu.Lock()
+	if e, ok := c.get(key); ok && e.vector != nil && now.Before(e.expires) && absDuration(ts.Sub(e.ts)) <= ttl {
+		vector := e.vector
+		c.mu.Unlock()
+		atomic.AddUint64(&c.stats.InstantHits, 1)
+		return vector, nil, nil
+	}
+	c.mu.Unlock()
+	atomic.AddUint64(&c.stats.InstantMisses, 1)
+
+	value, warnings, err := c.API.Query(ctx, query, ts)
+	if err != nil {
+		return value, warnings, err
+	}
+	vector, ok := value.(prommodels.Vector)
+	if !ok {
+		return value, warnings, err
+	}
+
+	c.mu.Lock()
+	c.put(&cacheEntry{
+		key:     key,
+		vector:  vector,
+		ts:      ts,
+		expires: time.Now().Add(ttl),
+		samples: len(vector),
+	})
+	c.mu.Unlock()
+
+	return value, warnings, err
+}
+
+// QueryRange serves the range from cache, fetching only the head and tail of the range which
+// are not cached. the settled portion of the result is cached for subsequent queries.
+func (c *Cache) QueryRange(ctx context.Context, query string, r promapi.Range) (prommodels.Value, api.Warnings, error) {
+	if r.Step <= 0 {
+		return c.API.QueryRange(ctx, query, r)
+	}
+
+	key := cacheKey{query: query, step: r.Step}
+	start := align(r.Start, r.Step)
+	end := align(r.End, r.Step)
+	settled := align(time.Now().Add(-c.opts.RangeSettle), r.Step)
+
+	c.mu.Lock()
+	var cached *cacheEntry
+	if e, ok := c.get(key); ok && e.matrix != nil {
+		cached = e
+	}
+	c.mu.Unlock()
+
+	// a range entirely outside of the cached range is fetched in full
+	if cached == nil || end.Before(cached.start) || start.After(cached.end.Add(r.Step)) {
+		atomic.AddUint64(&c.stats.RangeMisses, 1)
+		matrix, warnings, err := c.fetch(ctx, query, start, end, r.Step)
+		if err != nil {
+			return nil, warnings, err
+		}
+		c.store(key, matrix, start, minTime(end, settled), r.Step)
+		return clip(matrix, r.Start, r.End), warnings, nil
+	}
+
+	matrix := cached.matrix
+	var warnings api.Warnings
+	partial := false
+
+	if start.Before(cached.start) {
+		partial = true
+		head, w, err := c.fetch(ctx, query, start, cached.start.Add(-r.Step), r.Step)
+		if err != nil {
+			return nil, w, err
+		}
+		warnings = append(warnings, w...)
+		matrix = merge(head, matrix)
+	}
+	if end.After(cached.end) {
+		partial = true
+		tail, w, err := c.fetch(ctx, query, cached.end.Add(r.Step), end, r.Step)
+		if err != nil {
+			return nil, w, err
+		}
+		warnings = append(warnings, w...)
+		matrix = merge(matrix, tail)
+	}
+
+	if partial {
+		atomic.AddUint64(&c.stats.RangePartialHits, 1)
+		c.store(key, matrix, minTime(start, cached.start), minTime(maxTime(end, cached.end), settled), r.Step)
+	} else {
+		atomic.AddUint64(&c.stats.RangeHits, 1)
+	}
+
+	return clip(matrix, r.Start, r.End), warnings, nil
+}
+
+// fetch issues a range query which must return a matrix
+func (c *Cache) fetch(ctx context.Context, query string, start, end time.Time, step time.Duration) (prommodels.Matrix, api.Warnings, error) {
+	value, warnings, err := c.API.QueryRange(ctx, query, promapi.Range{Start: start, End: end, Step: step})
+	if err != nil {
+		return nil, warnings, err
+	}
+	matrix, ok := value.(prommodels.Matrix)
+	if !ok {
+		return nil, warnings, &UnexpectedTypeError{Type: value.Type()}
+	}
+	return matrix, warnings, nil
+}
+
+// store caches the portion of matrix up to end
+func (c *Cache) store(key cacheKey, matrix prommodels.Matrix, start, end time.Time, step time.Duration) {
+	if end.Before(start) {
+		return
+	}
+	matrix = clip(matrix, start, end)
+
+	samples := 0
+	for _, ss := range matrix {
+		samples += len(ss.Values)
+	}
+
+	c.mu.Lock()
+	c.put(&cacheEntry{
+		key:     key,
+		matrix:  matrix,
+		start:   start,
+		end:     end,
+		samples: samples,
+	})
+	c.mu.Unlock()
+}
+
+// get returns an entry and marks it recently used. callers must hold mu.
+func (c *Cache) get(key cacheKey) (*cacheEntry, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+// put replaces an entry and evicts the least recently used entries until the
+// cache is within its sample limit. callers must hold mu.
+func (c *Cache) put(e *cacheEntry) {
+	if el, ok := c.entries[e.key]; ok {
+		c.samples -= el.Value.(*cacheEntry).samples
+		c.lru.Remove(el)
+	}
+	if e.samples > c.opts.MaxSamples {
+		delete(c.entries, e.key)
+		return
+	}
+
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.samples += e.samples
+
+	for c.samples > c.opts.MaxSamples {
+		el := c.lru.Back()
+		old := el.Value.(*cacheEntry)
+		c.lru.Remove(el)
+		delete(c.entries, old.key)
+		c.samples -= old.samples
+		atomic.AddUint64(&c.stats.Evictions, 1)
+	}
+}
+
+// UnexpectedTypeError is returned when prometheus responds with a value of the wrong type
+type UnexpectedTypeError struct {
+	Type prommodels.ValueType
+}
+
+func (e *UnexpectedTypeError) Error() string {
+	return "received unexpected value type " + e.Type.String()
+}
+
+// align truncates t to a multiple of step since the Unix epoch
+func align(t time.Time, step time.Duration) time.Time {
+	ns := t.UnixNano()
+	return time.Unix(0, ns-ns%int64(step))
+}
+
+// clip returns the samples of matrix between start and end inclusive.
+func clip(matrix prommodels.Matrix, start, end time.Time) prommodels.Matrix {
+	from := prommodels.TimeFromUnixNano(start.UnixNano())
+	to := prommodels.TimeFromUnixNano(end.UnixNano())
+
+	res := make(prommodels.Matrix, 0, len(matrix))
+	for _, ss := range matrix {
+		values := make([]prommodels.SamplePair, 0, len(ss.Values))
+		for _, sp := range ss.Values {
+			if sp.Timestamp.Before(from) || sp.Timestamp.After(to) {
+				continue
+			}
+			values = append(values, sp)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		res = append(res, &prommodels.SampleStream{Metric: ss.Metric, Values: values})
+	}
+	return res
+}
+
+// merge joins two matrices covering consecutive ranges, matching series by their labels.
+func merge(earlier, later prommodels.Matrix) prommodels.Matrix {
+	res := make(prommodels.Matrix, 0, len(earlier)+len(later))
+	index := make(map[prommodels.Fingerprint]*prommodels.SampleStream, len(earlier))
+
+	for _, ss := range earlier {
+		cp := &prommodels.SampleStream{
+			Metric: ss.Metric,
+			Values: append([]prommodels.SamplePair(nil), ss.Values...),
+		}
+		index[ss.Metric.Fingerprint()] = cp
+		res = append(res, cp)
+	}
+	for _, ss := range later {
+		cp, ok := index[ss.Metric.Fingerprint()]
+		if !ok {
+			cp = &prommodels.SampleStream{Metric: ss.Metric}
+			index[ss.Metric.Fingerprint()] = cp
+			res = append(res, cp)
+		}
+		for _, sp := range ss.Values {
+			if n := len(cp.Values); n > 0 && !sp.Timestamp.After(cp.Values[n-1].Timestamp) {
+				continue
+			}
+			cp.Values = append(cp.Values, sp)
+		}
+	}
+	return res
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,186 @@
+package prometheus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/prometheus/client_golang/api"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodels "github.com/prometheus/common/model"
+)
+
+// fakeAPI answers queries with a single series whose value is its timestamp
+// and records every range it was asked for
+type fakeAPI struct {
+	promapi.API
+	mu      sync.Mutex
+	instant int
+	ranges  []promapi.Range
+}
+
+func (f *fakeAPI) Query(ctx context.Context, query string, ts time.Time) (prommodels.Value, api.Warnings, error) {
+	f.mu.Lock()
+	f.instant++
+	f.mu.Unlock()
+
+	return prommodels.Vector{
+		&prommodels.Sample{
+			Metric:    prommodels.Metric{NameTag: "web_1"},
+			Value:     prommodels.SampleValue(ts.Unix()),
+			Timestamp: prommodels.TimeFromUnix(ts.Unix()),
+		},
+	}, nil, nil
+}
+
+func (f *fakeAPI) QueryRange(ctx context.Context, query string, r promapi.Range) (prommodels.Value, api.Warnings, error) {
+	f.mu.Lock()
+	f.ranges = append(f.ranges, r)
+	f.mu.Unlock()
+
+	ss := &prommodels.SampleStream{Metric: prommodels.Metric{NameTag: "web_1"}}
+	for t := r.Start; !t.After(r.End); t = t.Add(r.Step) {
+		ss.Values = append(ss.Values, prommodels.SamplePair{
+			Timestamp: prommodels.TimeFromUnix(t.Unix()),
+			Value:     prommodels.SampleValue(t.Unix()),
+		})
+	}
+	return prommodels.Matrix{ss}, nil, nil
+}
+
+func TestCacheInstant(t *testing.T) {
+	fake := &fakeAPI{}
+	c := NewCache(fake, DefaultCacheOpts)
+
+	ctx := graphx.WithPollInterval(context.Background(), 200*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, _, err := c.Query(ctx, "cpu", time.Now()); err != nil {
+			t.Fatalf("failed to query: %v", err)
+		}
+	}
+	if fake.instant != 1 {
+		t.Fatalf("expected 1 query to reach prometheus got: %d", fake.instant)
+	}
+
+	// results expire after half of the poll interval
+	time.Sleep(150 * time.Millisecond)
+	if _, _, err := c.Query(ctx, "cpu", time.Now()); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if fake.instant != 2 {
+		t.Fatalf("expected expired result to be queried again got: %d queries", fake.instant)
+	}
+
+	stats := c.Stats()
+	if stats.InstantHits != 2 || stats.InstantMisses != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheInstantHistorical(t *testing.T) {
+	fake := &fakeAPI{}
+	c := NewCache(fake, DefaultCacheOpts)
+	ctx := graphx.WithPollInterval(context.Background(), time.Minute)
+
+	if _, _, err := c.Query(ctx, "cpu", time.Now()); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	value, _, err := c.Query(ctx, "cpu", past)
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if v := value.(prommodels.Vector); v[0].Timestamp.Unix() != past.Unix() {
+		t.Fatalf("expected the historical vector got one evaluated at %v", v[0].Timestamp)
+	}
+
+	// the historical result does not replace the cached current vector
+	value, _, err = c.Query(ctx, "cpu", time.Now())
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if v := value.(prommodels.Vector); v[0].Timestamp.Unix() == past.Unix() {
+		t.Fatalf("expected the current vector got the historical one")
+	}
+	if fake.instant != 2 {
+		t.Fatalf("expected only the historical query to bypass the cache got: %d queries", fake.instant)
+	}
+}
+
+func TestCacheRangeTail(t *testing.T) {
+	fake := &fakeAPI{}
+	c := NewCache(fake, DefaultCacheOpts)
+	ctx := context.Background()
+
+	step := 10 * time.Second
+	end := align(time.Now().Add(-time.Hour), step)
+	start := end.Add(-time.Hour)
+
+	if _, _, err := c.QueryRange(ctx, "cpu", promapi.Range{Start: start, End: end, Step: step}); err != nil {
+		t.Fatalf("failed to query range: %v", err)
+	}
+
+	// an overlapping range only fetches the missing tail
+	value, _, err := c.QueryRange(ctx, "cpu", promapi.Range{Start: start.Add(30 * time.Minute), End: end.Add(10 * time.Minute), Step: step})
+	if err != nil {
+		t.Fatalf("failed to query range: %v", err)
+	}
+	if len(fake.ranges) != 2 {
+		t.Fatalf("expected 2 range queries got: %v", fake.ranges)
+	}
+	if tail := fake.ranges[1]; !tail.Start.Equal(end.Add(step)) || !tail.End.Equal(end.Add(10*time.Minute)) {
+		t.Fatalf("expected tail fetch from %v to %v got: %+v", end.Add(step), end.Add(10*time.Minute), tail)
+	}
+
+	// the served result is contiguous and exactly covers the requested range
+	matrix := value.(prommodels.Matrix)
+	if len(matrix) != 1 {
+		t.Fatalf("expected a single series got: %d", len(matrix))
+	}
+	values := matrix[0].Values
+	if n := len(values); n != 241 {
+		t.Fatalf("expected 241 points got: %d", n)
+	}
+	for i := 1; i < len(values); i++ {
+		if values[i].Timestamp.Sub(values[i-1].Timestamp) != step {
+			t.Fatalf("gap between %v and %v", values[i-1].Timestamp, values[i].Timestamp)
+		}
+	}
+
+	// a range within the cached range is served entirely from cache
+	if _, _, err := c.QueryRange(ctx, "cpu", promapi.Range{Start: start, End: end, Step: step}); err != nil {
+		t.Fatalf("failed to query range: %v", err)
+	}
+	if len(fake.ranges) != 2 {
+		t.Fatalf("expected cached range to be served without querying got: %v", fake.ranges)
+	}
+
+	stats := c.Stats()
+	if stats.RangeMisses != 1 || stats.RangePartialHits != 1 || stats.RangeHits != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	fake := &fakeAPI{}
+	opts := DefaultCacheOpts
+	opts.MaxSamples = 500
+	c := NewCache(fake, opts)
+	ctx := context.Background()
+
+	step := 10 * time.Second
+	end := align(time.Now().Add(-time.Hour), step)
+	for _, q := range []string{"cpu", "mem"} {
+		// 361 samples each, the second evicts the first
+		if _, _, err := c.QueryRange(ctx, q, promapi.Range{Start: end.Add(-time.Hour), End: end, Step: step}); err != nil {
+			t.Fatalf("failed to query range: %v", err)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 1 || stats.Samples != 361 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/prometheus/client_golang/api"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodels "github.com/prometheus/common/model"
+)
+
+// Limited is a promapi.API bounding the number of concurrent instant and range queries.
+// all other methods are passed through to the wrapped client.
+//
+// each query acquires a slot from every limiter in order, typically a limiter owned by the
+// datasource followed by a global limiter shared with other datasources. a Limited client
+// should wrap a Breaker, not the reverse, so time spent queued is not mistaken for prometheus failing.
+type Limited struct {
+	promapi.API
+	limiters []*graphx.Limiter
+}
+
+// NewLimited is a constructor for a Limited client.
+func NewLimited(client promapi.API, limiters ...*graphx.Limiter) *Limited {
+	return &Limited{
+		API:      client,
+		limiters: limiters,
+	}
+}
+
+func (l *Limited) Query(ctx context.Context, query string, ts time.Time) (prommodels.Value, api.Warnings, error) {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	return l.API.Query(ctx, query, ts)
+}
+
+func (l *Limited) QueryRange(ctx context.Context, query string, r promapi.Range) (prommodels.Value, api.Warnings, error) {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	return l.API.QueryRange(ctx, query, r)
+}
+
+// acquire takes a slot from each limiter, releasing those already held if ctx is done
+func (l *Limited) acquire(ctx context.Context) (func(), error) {
+	releases := make([]func(), 0, len(l.limiters))
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	for _, limiter := range l.limiters {
+		r, err := limiter.Acquire(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
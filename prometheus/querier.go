@@ -2,6 +2,7 @@ package prometheus
 
 import (
 	"context"
+	"errors"
 	"log"
 	"sync"
 	"time"
@@ -11,12 +12,25 @@ import (
 	prommodels "github.com/prometheus/common/model"
 )
 
+const (
+	// DefaultTimeout is the timeout of instant queries when neither a timeout nor the poll interval is known
+	DefaultTimeout = 5 * time.Second
+	// TimeoutFraction is the share of the poll interval an instant query may run for when no timeout
+	// is configured, leaving time to deliver its results before the next poll
+	TimeoutFraction = 0.8
+	// RangeTimeout is the timeout of range queries
+	RangeTimeout = 30 * time.Second
+)
+
 type QuerierOpts struct {
 	ID           string
 	Client       promapi.API
 	ChartMetrics []graphx.ChartMetric
 	MChan        chan *graphx.Metric
 	EChan        chan error
+	// the timeout of instant queries whose chart metric does not set one.
+	// zero derives the timeout from the poll interval
+	Timeout time.Duration
 }
 
 type querier struct {
@@ -45,21 +59,32 @@ func (q *querier) Query(ctx context.Context) {
 	default:
 	}
 
-	// derive context with timeout
-	ctxTO, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
 	for _, chartMetric := range q.ChartMetrics {
 		wg.Add(1)
-		go q.query(ctxTO, chartMetric.Name, chartMetric.Query, &wg)
+		go q.query(ctx, chartMetric, &wg)
 	}
 
 	wg.Wait()
 }
 
+// timeout returns how long an instant query of the chart metric may run for. a timeout set on the
+// chart metric takes precedence over the querier's, otherwise it is relative to the poll interval.
+func (q *querier) timeout(ctx context.Context, chartMetric graphx.ChartMetric) time.Duration {
+	switch {
+	case chartMetric.Timeout > 0:
+		return time.Duration(chartMetric.Timeout)
+	case q.Timeout > 0:
+		return q.Timeout
+	}
+	if d, ok := graphx.PollIntervalFromContext(ctx); ok && d > 0 {
+		return time.Duration(float64(d) * TimeoutFraction)
+	}
+	return DefaultTimeout
+}
+
 // query is a private method meant to be ran as a go routine. handles the logic for querying prometheus given
-// a chart and a query and streams the results to the internal metrics channel
-func (q *querier) query(ctx context.Context, chart string, query string, wg *sync.WaitGroup) {
+// a chart metric and streams the results to the internal metrics channel. failures are delivered to the error channel
+func (q *querier) query(ctx context.Context, chartMetric graphx.ChartMetric, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	// check context
@@ -70,32 +95,176 @@ func (q *querier) query(ctx context.Context, chart string, query string, wg *syn
 	default:
 	}
 
-	// issue query
-	value, _, err := q.Client.Query(ctx, string(query), time.Now())
+	// derive context with timeout. the timeout bounds the query only, results are streamed
+	// until the poll is cancelled so a consumer applying backpressure loses none of them
+	qctx, cancel := context.WithTimeout(ctx, q.timeout(ctx, chartMetric))
+	metrics, err := q.queryInstant(qctx, chartMetric, time.Now())
+	cancel()
 	if err != nil {
-		log.Printf("session id %s: failed to query prometheus. ERROR: %v QUERY: %v", q.ID, err, string(query))
+		q.sendErr(err)
 		return
 	}
 
+	// stream metrics to channel
+	for _, m := range metrics {
+		// backpressure is applied by the consumer of MChan, wait for it
+		select {
+		case <-ctx.Done():
+			log.Printf("session id %s: context closed while streaming results", q.ID)
+			return
+		case q.MChan <- m:
+		}
+	}
+}
+
+// queryInstant issues a single instant query to prometheus evaluated at ts and converts the resulting vector to metrics
+func (q *querier) queryInstant(ctx context.Context, chartMetric graphx.ChartMetric, ts time.Time) ([]*graphx.Metric, *graphx.QueryError) {
+	if chartMetric.Query == "" {
+		return nil, graphx.NewQueryError(graphx.QueryErrorValidation, chartMetric, errors.New("query is empty"))
+	}
+
+	// issue query
+	value, _, err := q.Client.Query(ctx, chartMetric.Query, ts)
+	if err != nil {
+		// an open circuit is logged once by the breaker rather then on every poll
+		if _, ok := err.(*CircuitOpenError); !ok {
+			log.Printf("session id %s: failed to query prometheus. ERROR: %v QUERY: %v", q.ID, err, chartMetric.Query)
+		}
+		return nil, classify(ctx, chartMetric, err)
+	}
+
 	// type assert return value to vector
 	var vector prommodels.Vector
 	var ok bool
 	if vector, ok = value.(prommodels.Vector); !ok {
 		log.Printf("received unknown type from vector request")
-		return
+		return nil, graphx.NewQueryError(graphx.QueryErrorBadType, chartMetric, &UnexpectedTypeError{Type: value.Type()})
 	}
 
-	// stream metrics to channel
+	metrics := make([]*graphx.Metric, 0, len(vector))
 	for _, sample := range vector {
-		m := sampleToMetric(chart, sample)
-		select {
-		case <-ctx.Done():
-			log.Printf("session id %s: context closed while streaming results", q.ID)
-			return
-		case q.MChan <- m:
-		default:
-			log.Printf("session id %s: unable to deliver metrics to channel", q.ID)
+		metrics = append(metrics, sampleToMetric(chartMetric.Name, sample))
+	}
+	return metrics, nil
+}
+
+// QueryInstant is the public method implementing the graphx.InstantQuerier interface. this method blocks
+// until all concurrent queries evaluated at ts are completed and returns their results.
+func (q *querier) QueryInstant(ctx context.Context, ts time.Time) ([]*graphx.Metric, error) {
+	var wg sync.WaitGroup
+
+	results := make([][]*graphx.Metric, len(q.ChartMetrics))
+	errs := make([]*graphx.QueryError, len(q.ChartMetrics))
+	for i, chartMetric := range q.ChartMetrics {
+		wg.Add(1)
+		go func(i int, chartMetric graphx.ChartMetric) {
+			defer wg.Done()
+			// derive context with timeout
+			ctxTO, cancel := context.WithTimeout(ctx, q.timeout(ctx, chartMetric))
+			defer cancel()
+			results[i], errs[i] = q.queryInstant(ctxTO, chartMetric, ts)
+		}(i, chartMetric)
+	}
+	wg.Wait()
+
+	metrics := []*graphx.Metric{}
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		metrics = append(metrics, results[i]...)
+	}
+
+	return metrics, nil
+}
+
+// sendErr delivers an error without blocking the poller when nobody is receiving errors
+func (q *querier) sendErr(err *graphx.QueryError) {
+	select {
+	case q.EChan <- err:
+	default:
+		log.Printf("session id %s: unable to deliver error to channel: %v", q.ID, err)
+	}
+}
+
+// classify converts an error returned by the prometheus client to a QueryError
+func classify(ctx context.Context, chartMetric graphx.ChartMetric, err error) *graphx.QueryError {
+	if _, ok := err.(*CircuitOpenError); ok {
+		return graphx.NewQueryError(graphx.QueryErrorUnavailable, chartMetric, err)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return graphx.NewQueryError(graphx.QueryErrorTimeout, chartMetric, err)
+	}
+	if apiErr, ok := err.(*promapi.Error); ok {
+		switch apiErr.Type {
+		case promapi.ErrTimeout:
+			return graphx.NewQueryError(graphx.QueryErrorTimeout, chartMetric, err)
+		case promapi.ErrBadData:
+			return graphx.NewQueryError(graphx.QueryErrorValidation, chartMetric, err)
 		}
 	}
+	if _, ok := err.(*UnexpectedTypeError); ok {
+		return graphx.NewQueryError(graphx.QueryErrorBadType, chartMetric, err)
+	}
+	return graphx.NewQueryError(graphx.QueryErrorClient, chartMetric, err)
+}
+
+// QueryRange is the public method implementing the graphx.RangeQuerier interface. this method blocks
+// until all concurrent range queries are completed and returns their results as series.
+func (q *querier) QueryRange(ctx context.Context, start time.Time, end time.Time, step time.Duration) ([]*graphx.Series, error) {
+	var wg sync.WaitGroup
+
+	// derive context with timeout. range queries are considerably heavier then instant queries
+	ctxTO, cancel := context.WithTimeout(ctx, RangeTimeout)
+	defer cancel()
+
+	r := promapi.Range{
+		Start: start,
+		End:   end,
+		Step:  step,
+	}
+
+	results := make([][]*graphx.Series, len(q.ChartMetrics))
+	errs := make([]error, len(q.ChartMetrics))
+	for i, chartMetric := range q.ChartMetrics {
+		wg.Add(1)
+		go func(i int, chartMetric graphx.ChartMetric) {
+			defer wg.Done()
+			results[i], errs[i] = q.queryRange(ctxTO, chartMetric, r)
+		}(i, chartMetric)
+	}
+	wg.Wait()
+
+	series := []*graphx.Series{}
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		series = append(series, results[i]...)
+	}
+
+	return series, nil
+}
+
+// queryRange issues a single range query to prometheus and converts the resulting matrix to series
+func (q *querier) queryRange(ctx context.Context, chartMetric graphx.ChartMetric, r promapi.Range) ([]*graphx.Series, error) {
+	value, _, err := q.Client.QueryRange(ctx, chartMetric.Query, r)
+	if err != nil {
+		log.Printf("session id %s: failed to range query prometheus. ERROR: %v QUERY: %v", q.ID, err, chartMetric.Query)
+		return nil, classify(ctx, chartMetric, err)
+	}
+
+	// type assert return value to matrix
+	var matrix prommodels.Matrix
+	var ok bool
+	if matrix, ok = value.(prommodels.Matrix); !ok {
+		return nil, graphx.NewQueryError(graphx.QueryErrorBadType, chartMetric, &UnexpectedTypeError{Type: value.Type()})
+	}
+
+	series := make([]*graphx.Series, 0, len(matrix))
+	for _, stream := range matrix {
+		series = append(series, sampleStreamToSeries(chartMetric.Name, stream))
+	}
 
+	return series, nil
 }
@@ -0,0 +1,92 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+)
+
+var TimeoutTT = []struct {
+	name         string
+	chartMetric  time.Duration
+	datasource   time.Duration
+	pollInterval time.Duration
+	expected     time.Duration
+}{
+	{
+		name:     "default without poll interval",
+		expected: DefaultTimeout,
+	},
+	{
+		name:         "relative to poll interval",
+		pollInterval: 1 * time.Second,
+		expected:     800 * time.Millisecond,
+	},
+	{
+		name:         "relative to long poll interval",
+		pollInterval: 5 * time.Minute,
+		expected:     4 * time.Minute,
+	},
+	{
+		name:         "datasource overrides poll interval",
+		datasource:   10 * time.Second,
+		pollInterval: 1 * time.Second,
+		expected:     10 * time.Second,
+	},
+	{
+		name:         "chart metric overrides datasource",
+		chartMetric:  2 * time.Second,
+		datasource:   10 * time.Second,
+		pollInterval: 1 * time.Second,
+		expected:     2 * time.Second,
+	},
+}
+
+func TestTimeout(t *testing.T) {
+	for _, tt := range TimeoutTT {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &querier{QuerierOpts{Timeout: tt.datasource}}
+			ctx := context.Background()
+			if tt.pollInterval > 0 {
+				ctx = graphx.WithPollInterval(ctx, tt.pollInterval)
+			}
+
+			got := q.timeout(ctx, graphx.ChartMetric{Timeout: graphx.Duration(tt.chartMetric)})
+			if got != tt.expected {
+				t.Fatalf("got: %v want: %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQueryWaitsPastTimeout(t *testing.T) {
+	mChan := make(chan *graphx.Metric)
+	q := NewQuerier(QuerierOpts{
+		ID:           "test",
+		Client:       &fakeAPI{},
+		ChartMetrics: []graphx.ChartMetric{{Name: "usage", Query: "cpu", Datasource: Datasource}},
+		MChan:        mChan,
+		EChan:        make(chan error, 1),
+		Timeout:      10 * time.Millisecond,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		q.Query(context.Background())
+		close(done)
+	}()
+
+	// the consumer falls behind by more than the query timeout
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case m := <-mChan:
+		if m.Name != "web_1" {
+			t.Fatalf("expected web_1 got %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the result to be delivered once the consumer caught up")
+	}
+	<-done
+}
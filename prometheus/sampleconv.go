@@ -23,14 +23,19 @@ func samplePairToMetric(chart string, metric promModels.Metric, sp promModels.Sa
 	return m
 }
 
-// // samplePairToMetric converts a prometheus SamplePair to a graphx.Metric
-// func samplePairToRangeMetric(sp promModels.SamplePair) *graphx.RangeMetric {
-// 	m := &graphx.RangeMetric{
-// 		TimeStamp: sp.Timestamp.Unix(),
-// 		Value:     sp.Value.String(),
-// 	}
-// 	return m
-// }
+// sampleStreamToSeries converts a prometheus SampleStream to a graphx.Series
+func sampleStreamToSeries(chart string, stream *promModels.SampleStream) *graphx.Series {
+	s := &graphx.Series{
+		Chart:      chart,
+		Name:       string(stream.Metric[NameTag]),
+		TimeStamps: make([]int64, 0, len(stream.Values)),
+		Values:     make([]string, 0, len(stream.Values)),
+	}
+	for _, sp := range stream.Values {
+		s.Append(sp.Timestamp.Unix(), sp.Value.String())
+	}
+	return s
+}
 
 // sampleToMetric converts a prometheus Sample to our domain Metric object
 func sampleToMetric(chart string, sample *promModels.Sample) *graphx.Metric {
@@ -2,6 +2,7 @@ package graphx
 
 import (
 	"context"
+	"time"
 )
 
 // Querier is an interface to abstract the data backend we retrieve metrics from.
@@ -10,3 +11,15 @@ type Querier interface {
 	// Query the results of a query to the provided channel
 	Query(ctx context.Context)
 }
+
+// RangeQuerier is implemented by Queriers which can retrieve historical metrics.
+type RangeQuerier interface {
+	// QueryRange returns a Series for each name and chart with points between start and end at the provided step
+	QueryRange(ctx context.Context, start time.Time, end time.Time, step time.Duration) ([]*Series, error)
+}
+
+// InstantQuerier is implemented by Queriers which can evaluate their queries a single time on request.
+type InstantQuerier interface {
+	// QueryInstant returns the metrics of every query evaluated at ts
+	QueryInstant(ctx context.Context, ts time.Time) ([]*Metric, error)
+}
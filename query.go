@@ -0,0 +1,92 @@
+package graphx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	// DefaultStep is the resolution of a range query which does not request one
+	DefaultStep = time.Minute
+)
+
+// QueryDescriptor is a client request to query the configured chart names a single time.
+// an instant query is evaluated at Time while setting From requests a range query.
+type QueryDescriptor struct {
+	// the named charts a user has configured graphx with.
+	ChartNames []string `json:"chart_names" validate:"required,min=1"`
+	// list of names to return the above chart metrics for
+	Names []string `json:"names" validate:"required,min=1"`
+	// the time an instant query is evaluated at. defaults to now
+	Time TimeStamp `json:"time"`
+	// the start of a range query
+	From TimeStamp `json:"from"`
+	// the end of a range query. defaults to now
+	To TimeStamp `json:"to"`
+	// the resolution of a range query. defaults to DefaultStep
+	Step Duration `json:"step"`
+}
+
+// IsRange reports whether the descriptor requests a range query.
+func (qd QueryDescriptor) IsRange() bool {
+	return !time.Time(qd.From).IsZero()
+}
+
+// QueryResult is the response to a QueryDescriptor.
+type QueryResult struct {
+	Charts []*ChartResult `json:"charts"`
+}
+
+// ChartResult holds a series for each name and chart metric of a chart. an instant query
+// produces series of a single point.
+type ChartResult struct {
+	Name   string    `json:"name"`
+	Series []*Series `json:"series"`
+	// the queries of this chart which failed. their series are missing
+	Errors []*QueryError `json:"errors,omitempty"`
+}
+
+// QueryRunner runs the queries of charts a single time rather then polling them.
+type QueryRunner interface {
+	// Run returns the results of each chart in the order the charts were provided.
+	// a failed query is reported in its chart's result and does not fail the others.
+	Run(ctx context.Context, charts []*Chart, qd QueryDescriptor) (*QueryResult, error)
+}
+
+// Query validates a query descriptor, retrieves the charts it names and runs their queries once.
+// charts are retrieved the way OpenStream retrieves them.
+func Query(ctx context.Context, v *validator.Validate, cs ChartStore, qr QueryRunner, qd QueryDescriptor) (*QueryResult, error) {
+	err := v.StructCtx(ctx, qd)
+	if err != nil {
+		return nil, fmt.Errorf("struct validation error: %v", err)
+	}
+
+	now := time.Now()
+	if qd.IsRange() {
+		if time.Time(qd.To).IsZero() {
+			qd.To = TimeStamp(now)
+		}
+		if qd.Step == 0 {
+			qd.Step = Duration(DefaultStep)
+		}
+		if !time.Time(qd.To).After(time.Time(qd.From)) {
+			return nil, errors.New("to must be after from")
+		}
+		if time.Duration(qd.Step) < 1*time.Second {
+			return nil, errors.New("requested step of less then 1 second")
+		}
+	} else if time.Time(qd.Time).IsZero() {
+		qd.Time = TimeStamp(now)
+	}
+
+	charts, err := getCharts(cs, qd.ChartNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return qr.Run(ctx, charts, qd)
+}
@@ -0,0 +1,95 @@
+package graphx
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ldelossa/jsonerr"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	QueryErrCode = "graphx.query_handler"
+)
+
+// QueryHandler returns a single snapshot or historical range of the requested charts as JSON
+// for clients such as reports and scripts which do not want a stream. the QueryDescriptor is
+// provided either as query parameters on a GET or as a JSON body on a POST.
+func QueryHandler(v *validator.Validate, cs ChartStore, qr QueryRunner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var qd QueryDescriptor
+		switch r.Method {
+		case http.MethodGet:
+			var err error
+			qd, err = queryDescriptorFromQuery(r.URL.Query())
+			if err != nil {
+				log.Printf("failed to parse query descriptor from query parameters: %v", err)
+				resp := jsonerr.NewResponse("", QueryErrCode, err.Error())
+				jsonerr.Error(w, resp, http.StatusBadRequest)
+				return
+			}
+		case http.MethodPost:
+			err := json.NewDecoder(r.Body).Decode(&qd)
+			if err != nil {
+				log.Printf("failed to decode query descriptor: %v", err)
+				resp := jsonerr.NewResponse("", QueryErrCode, "failed to decode query descriptor")
+				jsonerr.Error(w, resp, http.StatusBadRequest)
+				return
+			}
+		default:
+			log.Printf("methd not allowed")
+			resp := jsonerr.NewResponse("", QueryErrCode, "method not allowed")
+			jsonerr.Error(w, resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		res, err := Query(r.Context(), v, cs, qr, qd)
+		if err != nil {
+			log.Printf("failed to query charts: %v", err)
+			resp := jsonerr.NewResponse("", QueryErrCode, err.Error())
+			jsonerr.Error(w, resp, errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(res)
+		if err != nil {
+			log.Printf("failed to write query result: %v", err)
+		}
+	}
+}
+
+// queryDescriptorFromQuery builds a QueryDescriptor from query parameters. list parameters
+// may be repeated or comma separated.
+func queryDescriptorFromQuery(q url.Values) (QueryDescriptor, error) {
+	qd := QueryDescriptor{
+		ChartNames: splitParam(q["chart_names"]),
+		Names:      splitParam(q["names"]),
+	}
+
+	for param, ts := range map[string]*TimeStamp{"time": &qd.Time, "from": &qd.From, "to": &qd.To} {
+		s := q.Get(param)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return qd, fmt.Errorf("failed to parse %s: %v", param, err)
+		}
+		*ts = TimeStamp(t)
+	}
+
+	if s := q.Get("step"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return qd, fmt.Errorf("failed to parse step: %v", err)
+		}
+		qd.Step = Duration(d)
+	}
+
+	return qd, nil
+}
@@ -0,0 +1,54 @@
+package graphx
+
+// replayBuffer retains the most recent sequenced messages of a session
+// so they may be redelivered to a client which resumes it.
+type replayBuffer struct {
+	msgs []*Message
+	// index of the oldest message once the buffer has wrapped
+	head int
+	full bool
+	// the sequence number of the latest message pushed, retained or not
+	last uint64
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	return &replayBuffer{
+		msgs: make([]*Message, 0, size),
+	}
+}
+
+// push appends a message, evicting the oldest message when the buffer is full
+func (r *replayBuffer) push(msg *Message) {
+	r.last = msg.Seq
+	if cap(r.msgs) == 0 {
+		return
+	}
+	if !r.full {
+		r.msgs = append(r.msgs, msg)
+		r.full = len(r.msgs) == cap(r.msgs)
+		return
+	}
+	r.msgs[r.head] = msg
+	r.head = (r.head + 1) % len(r.msgs)
+}
+
+// since returns the messages with a sequence number of at least seq in order. false is
+// returned unless every one of those messages is still buffered.
+func (r *replayBuffer) since(seq uint64) ([]*Message, bool) {
+	a := []*Message{}
+	if seq > r.last {
+		return a, true
+	}
+	n := len(r.msgs)
+	if n == 0 || r.msgs[r.head].Seq > seq {
+		return nil, false
+	}
+
+	for i := 0; i < n; i++ {
+		msg := r.msgs[(r.head+i)%n]
+		if msg.Seq >= seq {
+			a = append(a, msg)
+		}
+	}
+	return a, true
+}
@@ -0,0 +1,103 @@
+package graphx
+
+import (
+	"testing"
+	"time"
+)
+
+var ReplayTT = []struct {
+	name string
+	size int
+	// the sequence numbers pushed
+	pushed []uint64
+	since  uint64
+	ok     bool
+	expect []uint64
+}{
+	{
+		name:   "empty",
+		size:   4,
+		since:  1,
+		ok:     true,
+		expect: []uint64{},
+	},
+	{
+		name:   "disabled",
+		size:   0,
+		pushed: []uint64{1, 2},
+		since:  2,
+	},
+	{
+		name:   "disabled up to date",
+		size:   0,
+		pushed: []uint64{1, 2},
+		since:  3,
+		ok:     true,
+		expect: []uint64{},
+	},
+	{
+		name:   "partial",
+		size:   4,
+		pushed: []uint64{1, 2, 3},
+		since:  2,
+		ok:     true,
+		expect: []uint64{2, 3},
+	},
+	{
+		name:   "wrapped",
+		size:   3,
+		pushed: []uint64{1, 2, 3, 4, 5},
+		since:  3,
+		ok:     true,
+		expect: []uint64{3, 4, 5},
+	},
+	{
+		name:   "wrapped past seq",
+		size:   3,
+		pushed: []uint64{1, 2, 3, 4, 5},
+		since:  2,
+	},
+	{
+		name:   "up to date",
+		size:   3,
+		pushed: []uint64{1, 2, 3, 4, 5},
+		since:  6,
+		ok:     true,
+		expect: []uint64{},
+	},
+}
+
+func TestReplay(t *testing.T) {
+	for _, tt := range ReplayTT {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReplayBuffer(tt.size)
+			for _, seq := range tt.pushed {
+				r.push(&Message{Seq: seq})
+			}
+			msgs, ok := r.since(tt.since)
+			if ok != tt.ok {
+				t.Fatalf("expected ok %v got %v", tt.ok, ok)
+			}
+			if len(msgs) != len(tt.expect) {
+				t.Fatalf("expected %d messages got %d", len(tt.expect), len(msgs))
+			}
+			for i, msg := range msgs {
+				if msg.Seq != tt.expect[i] {
+					t.Fatalf("expected seq %d at %d got %d", tt.expect[i], i, msg.Seq)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSessions(t *testing.T) {
+	if _, err := NewSessions(time.Second, -1); err == nil {
+		t.Fatalf("expected a negative replay size to be rejected")
+	}
+	if _, err := NewSessions(-time.Second, 0); err == nil {
+		t.Fatalf("expected a negative linger to be rejected")
+	}
+	if _, err := NewSessions(time.Second, 0); err != nil {
+		t.Fatalf("expected a zero replay size to be accepted got: %v", err)
+	}
+}
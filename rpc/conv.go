@@ -0,0 +1,228 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// descriptor converts a SubscribeRequest to the ChartsDescriptor shared with the http transports
+func (m *SubscribeRequest) descriptor() graphx.ChartsDescriptor {
+	cd := graphx.ChartsDescriptor{
+		ChartNames:      m.ChartNames,
+		Names:           m.Names,
+		PollInterval:    graphx.Duration(time.Duration(m.PollIntervalMs) * time.Millisecond),
+		MaxPollInterval: graphx.Duration(time.Duration(m.MaxPollIntervalMs) * time.Millisecond),
+		Keepalive:       graphx.Duration(time.Duration(m.KeepaliveMs) * time.Millisecond),
+		SeriesGrace:     graphx.Duration(time.Duration(m.SeriesGraceMs) * time.Millisecond),
+		Backpressure:    graphx.Backpressure(m.Backpressure),
+		BufferSize:      int(m.BufferSize),
+		MaxPoints:       int(m.MaxPoints),
+		Downsample:      graphx.Downsample(m.Downsample),
+	}
+	if m.Fill != 0 {
+		cd.Fill = graphx.TimeStamp(time.Unix(m.Fill, 0))
+	}
+	return cd
+}
+
+func fromMetric(m *graphx.Metric) *Metric {
+	return &Metric{
+		Name:      m.Name,
+		ChartName: m.Chart,
+		TimeStamp: m.TimeStamp,
+		Value:     m.Value,
+	}
+}
+
+func fromIntervals(intervals map[string]graphx.Duration) map[string]int64 {
+	ms := make(map[string]int64, len(intervals))
+	for chart, d := range intervals {
+		ms[chart] = int64(time.Duration(d) / time.Millisecond)
+	}
+	return ms
+}
+
+func fromQueryError(qe *graphx.QueryError) *QueryError {
+	return &QueryError{
+		Kind:       string(qe.Kind),
+		Chart:      qe.Chart,
+		Metric:     qe.Metric,
+		Query:      qe.Query,
+		Datasource: qe.Datasource,
+		Message:    qe.Message,
+	}
+}
+
+func fromSeriesEvent(se *graphx.SeriesEvent) *SeriesEvent {
+	return &SeriesEvent{
+		State:     string(se.State),
+		Name:      se.Name,
+		ChartName: se.Chart,
+		LastSeen:  se.LastSeen,
+	}
+}
+
+func fromChart(c *graphx.Chart) *Chart {
+	chart := &Chart{
+		Name:          c.Name,
+		Metrics:       make([]*ChartMetric, 0, len(c.ChartMetrics)),
+		MinIntervalMs: int64(time.Duration(c.MinInterval) / time.Millisecond),
+	}
+	if ag := c.Aggregation; ag != nil {
+		chart.Aggregation = &Aggregation{
+			Op:       string(ag.Op),
+			K:        int64(ag.K),
+			By:       string(ag.By),
+			Other:    ag.Other,
+			Quantile: ag.Quantile,
+		}
+	}
+	for _, cm := range c.ChartMetrics {
+		chart.Metrics = append(chart.Metrics, &ChartMetric{
+			Name:       cm.Name,
+			Chart:      cm.Chart,
+			Query:      cm.Query,
+			Datasource: cm.Datasource,
+			TimeoutMs:  int64(time.Duration(cm.Timeout) / time.Millisecond),
+			Expr:       cm.Expr,
+			Transforms: fromTransforms(cm.Transforms),
+			Alerts:     fromAlertRules(cm.Alerts),
+		})
+	}
+	return chart
+}
+
+func toChart(c *Chart) *graphx.Chart {
+	chart := &graphx.Chart{
+		Name:         c.Name,
+		ChartMetrics: make([]graphx.ChartMetric, 0, len(c.Metrics)),
+		MinInterval:  graphx.Duration(time.Duration(c.MinIntervalMs) * time.Millisecond),
+	}
+	if ag := c.Aggregation; ag != nil {
+		chart.Aggregation = &graphx.Aggregation{
+			Op:       graphx.AggregationOp(ag.Op),
+			K:        int(ag.K),
+			By:       graphx.AggregationRank(ag.By),
+			Other:    ag.Other,
+			Quantile: ag.Quantile,
+		}
+	}
+	for _, cm := range c.Metrics {
+		chart.ChartMetrics = append(chart.ChartMetrics, graphx.ChartMetric{
+			Name:       cm.Name,
+			Chart:      cm.Chart,
+			Query:      cm.Query,
+			Datasource: cm.Datasource,
+			Timeout:    graphx.Duration(time.Duration(cm.TimeoutMs) * time.Millisecond),
+			Expr:       cm.Expr,
+			Transforms: toTransforms(cm.Transforms),
+			Alerts:     toAlertRules(cm.Alerts),
+		})
+	}
+	return chart
+}
+
+func fromTransforms(transforms []graphx.Transform) []*Transform {
+	if len(transforms) == 0 {
+		return nil
+	}
+	a := make([]*Transform, 0, len(transforms))
+	for _, t := range transforms {
+		rt := &Transform{
+			Type:      string(t.Type),
+			Value:     t.Value,
+			Window:    int64(t.Window),
+			Alpha:     t.Alpha,
+			Precision: int64(t.Precision),
+		}
+		if t.Min != nil {
+			rt.Min = &wrappers.DoubleValue{Value: *t.Min}
+		}
+		if t.Max != nil {
+			rt.Max = &wrappers.DoubleValue{Value: *t.Max}
+		}
+		a = append(a, rt)
+	}
+	return a
+}
+
+func toTransforms(transforms []*Transform) []graphx.Transform {
+	if len(transforms) == 0 {
+		return nil
+	}
+	a := make([]graphx.Transform, 0, len(transforms))
+	for _, rt := range transforms {
+		t := graphx.Transform{
+			Type:      graphx.TransformType(rt.Type),
+			Value:     rt.Value,
+			Window:    int(rt.Window),
+			Alpha:     rt.Alpha,
+			Precision: int(rt.Precision),
+		}
+		if rt.Min != nil {
+			min := rt.Min.Value
+			t.Min = &min
+		}
+		if rt.Max != nil {
+			max := rt.Max.Value
+			t.Max = &max
+		}
+		a = append(a, t)
+	}
+	return a
+}
+
+func fromAlertRules(rules []graphx.AlertRule) []*AlertRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	a := make([]*AlertRule, 0, len(rules))
+	for _, r := range rules {
+		a = append(a, &AlertRule{
+			Name:       r.Name,
+			Condition:  string(r.Condition),
+			Threshold:  r.Threshold,
+			ForMs:      int64(time.Duration(r.For) / time.Millisecond),
+			Hysteresis: r.Hysteresis,
+			Labels:     r.Labels,
+		})
+	}
+	return a
+}
+
+func toAlertRules(rules []*AlertRule) []graphx.AlertRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	a := make([]graphx.AlertRule, 0, len(rules))
+	for _, r := range rules {
+		a = append(a, graphx.AlertRule{
+			Name:       r.Name,
+			Condition:  graphx.AlertCondition(r.Condition),
+			Threshold:  r.Threshold,
+			For:        graphx.Duration(time.Duration(r.ForMs) * time.Millisecond),
+			Hysteresis: r.Hysteresis,
+			Labels:     r.Labels,
+		})
+	}
+	return a
+}
+
+func fromAlert(a *graphx.Alert) *Alert {
+	return &Alert{
+		Rule:       a.Rule,
+		Chart:      a.Chart,
+		Metric:     a.Metric,
+		Name:       a.Name,
+		State:      string(a.State),
+		Condition:  string(a.Condition),
+		Threshold:  a.Threshold,
+		Labels:     a.Labels,
+		Value:      a.Value,
+		ActiveAt:   a.ActiveAt,
+		FiredAt:    a.FiredAt,
+		ResolvedAt: a.ResolvedAt,
+	}
+}
@@ -0,0 +1,1561 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: graphx.proto
+
+package rpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// SubscribeRequest is the equivalent of a ChartsDescriptor.
+type SubscribeRequest struct {
+	ChartNames []string `protobuf:"bytes,1,rep,name=chart_names,json=chartNames,proto3" json:"chart_names,omitempty"`
+	Names      []string `protobuf:"bytes,2,rep,name=names,proto3" json:"names,omitempty"`
+	// the poll interval in milliseconds. must be at least one second
+	PollIntervalMs int64 `protobuf:"varint,3,opt,name=poll_interval_ms,json=pollIntervalMs,proto3" json:"poll_interval_ms,omitempty"`
+	// an optional Unix timestamp to backfill historical metrics from
+	Fill int64 `protobuf:"varint,4,opt,name=fill,proto3" json:"fill,omitempty"`
+	// block, drop_oldest, drop_newest or coalesce. defaults to drop_newest
+	Backpressure string `protobuf:"bytes,5,opt,name=backpressure,proto3" json:"backpressure,omitempty"`
+	// the number of metrics buffered for the client
+	BufferSize int64 `protobuf:"varint,6,opt,name=buffer_size,json=bufferSize,proto3" json:"buffer_size,omitempty"`
+	// an optional upper bound in milliseconds the poll interval may adapt to
+	MaxPollIntervalMs int64 `protobuf:"varint,7,opt,name=max_poll_interval_ms,json=maxPollIntervalMs,proto3" json:"max_poll_interval_ms,omitempty"`
+	// an optional interval in milliseconds the latest sample of a series whose
+	// value has not changed is re-sent at
+	KeepaliveMs int64 `protobuf:"varint,8,opt,name=keepalive_ms,json=keepaliveMs,proto3" json:"keepalive_ms,omitempty"`
+	// an optional period in milliseconds a series may be missing from query
+	// results before it is removed
+	SeriesGraceMs int64 `protobuf:"varint,9,opt,name=series_grace_ms,json=seriesGraceMs,proto3" json:"series_grace_ms,omitempty"`
+	// an optional upper bound on the number of points backfilled per series
+	MaxPoints int64 `protobuf:"varint,10,opt,name=max_points,json=maxPoints,proto3" json:"max_points,omitempty"`
+	// lttb, minmax or avg. defaults to lttb
+	Downsample           string   `protobuf:"bytes,11,opt,name=downsample,proto3" json:"downsample,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{0}
+}
+
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(m, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetChartNames() []string {
+	if m != nil {
+		return m.ChartNames
+	}
+	return nil
+}
+
+func (m *SubscribeRequest) GetNames() []string {
+	if m != nil {
+		return m.Names
+	}
+	return nil
+}
+
+func (m *SubscribeRequest) GetPollIntervalMs() int64 {
+	if m != nil {
+		return m.PollIntervalMs
+	}
+	return 0
+}
+
+func (m *SubscribeRequest) GetFill() int64 {
+	if m != nil {
+		return m.Fill
+	}
+	return 0
+}
+
+func (m *SubscribeRequest) GetBackpressure() string {
+	if m != nil {
+		return m.Backpressure
+	}
+	return ""
+}
+
+func (m *SubscribeRequest) GetBufferSize() int64 {
+	if m != nil {
+		return m.BufferSize
+	}
+	return 0
+}
+
+func (m *SubscribeRequest) GetMaxPollIntervalMs() int64 {
+	if m != nil {
+		return m.MaxPollIntervalMs
+	}
+	return 0
+}
+
+func (m *SubscribeRequest) GetKeepaliveMs() int64 {
+	if m != nil {
+		return m.KeepaliveMs
+	}
+	return 0
+}
+
+func (m *SubscribeRequest) GetSeriesGraceMs() int64 {
+	if m != nil {
+		return m.SeriesGraceMs
+	}
+	return 0
+}
+
+func (m *SubscribeRequest) GetMaxPoints() int64 {
+	if m != nil {
+		return m.MaxPoints
+	}
+	return 0
+}
+
+func (m *SubscribeRequest) GetDownsample() string {
+	if m != nil {
+		return m.Downsample
+	}
+	return ""
+}
+
+type Metric struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	ChartName            string   `protobuf:"bytes,2,opt,name=chart_name,json=chartName,proto3" json:"chart_name,omitempty"`
+	TimeStamp            int64    `protobuf:"varint,3,opt,name=time_stamp,json=timeStamp,proto3" json:"time_stamp,omitempty"`
+	Value                string   `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Metric) Reset()         { *m = Metric{} }
+func (m *Metric) String() string { return proto.CompactTextString(m) }
+func (*Metric) ProtoMessage()    {}
+func (*Metric) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{1}
+}
+
+func (m *Metric) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Metric.Unmarshal(m, b)
+}
+func (m *Metric) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Metric.Marshal(b, m, deterministic)
+}
+func (m *Metric) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Metric.Merge(m, src)
+}
+func (m *Metric) XXX_Size() int {
+	return xxx_messageInfo_Metric.Size(m)
+}
+func (m *Metric) XXX_DiscardUnknown() {
+	xxx_messageInfo_Metric.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Metric proto.InternalMessageInfo
+
+func (m *Metric) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Metric) GetChartName() string {
+	if m != nil {
+		return m.ChartName
+	}
+	return ""
+}
+
+func (m *Metric) GetTimeStamp() int64 {
+	if m != nil {
+		return m.TimeStamp
+	}
+	return 0
+}
+
+func (m *Metric) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+type MetricBatch struct {
+	Metrics []*Metric `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	// the total number of metrics discarded under backpressure, set when it increases
+	Dropped uint64 `protobuf:"varint,2,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	// queries which failed since the previous batch
+	Errors []*QueryError `protobuf:"bytes,3,rep,name=errors,proto3" json:"errors,omitempty"`
+	// the interval in milliseconds each chart is polled at keyed by chart name.
+	// set when the interval of an adaptive subscription changes
+	IntervalsMs map[string]int64 `protobuf:"bytes,4,rep,name=intervals_ms,json=intervalsMs,proto3" json:"intervals_ms,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+	// series which were added or removed since the previous batch
+	Series []*SeriesEvent `protobuf:"bytes,5,rep,name=series,proto3" json:"series,omitempty"`
+	// alerts of the streamed charts which fired or resolved since the previous batch
+	Alerts               []*Alert `protobuf:"bytes,6,rep,name=alerts,proto3" json:"alerts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MetricBatch) Reset()         { *m = MetricBatch{} }
+func (m *MetricBatch) String() string { return proto.CompactTextString(m) }
+func (*MetricBatch) ProtoMessage()    {}
+func (*MetricBatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{2}
+}
+
+func (m *MetricBatch) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetricBatch.Unmarshal(m, b)
+}
+func (m *MetricBatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetricBatch.Marshal(b, m, deterministic)
+}
+func (m *MetricBatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetricBatch.Merge(m, src)
+}
+func (m *MetricBatch) XXX_Size() int {
+	return xxx_messageInfo_MetricBatch.Size(m)
+}
+func (m *MetricBatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetricBatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetricBatch proto.InternalMessageInfo
+
+func (m *MetricBatch) GetMetrics() []*Metric {
+	if m != nil {
+		return m.Metrics
+	}
+	return nil
+}
+
+func (m *MetricBatch) GetDropped() uint64 {
+	if m != nil {
+		return m.Dropped
+	}
+	return 0
+}
+
+func (m *MetricBatch) GetErrors() []*QueryError {
+	if m != nil {
+		return m.Errors
+	}
+	return nil
+}
+
+func (m *MetricBatch) GetIntervalsMs() map[string]int64 {
+	if m != nil {
+		return m.IntervalsMs
+	}
+	return nil
+}
+
+func (m *MetricBatch) GetSeries() []*SeriesEvent {
+	if m != nil {
+		return m.Series
+	}
+	return nil
+}
+
+func (m *MetricBatch) GetAlerts() []*Alert {
+	if m != nil {
+		return m.Alerts
+	}
+	return nil
+}
+
+// QueryError describes a failed query of a chart metric.
+type QueryError struct {
+	// client, timeout, bad_type, validation, skipped or unavailable
+	Kind                 string   `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	Chart                string   `protobuf:"bytes,2,opt,name=chart,proto3" json:"chart,omitempty"`
+	Metric               string   `protobuf:"bytes,3,opt,name=metric,proto3" json:"metric,omitempty"`
+	Query                string   `protobuf:"bytes,4,opt,name=query,proto3" json:"query,omitempty"`
+	Datasource           string   `protobuf:"bytes,5,opt,name=datasource,proto3" json:"datasource,omitempty"`
+	Message              string   `protobuf:"bytes,6,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QueryError) Reset()         { *m = QueryError{} }
+func (m *QueryError) String() string { return proto.CompactTextString(m) }
+func (*QueryError) ProtoMessage()    {}
+func (*QueryError) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{3}
+}
+
+func (m *QueryError) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueryError.Unmarshal(m, b)
+}
+func (m *QueryError) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueryError.Marshal(b, m, deterministic)
+}
+func (m *QueryError) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryError.Merge(m, src)
+}
+func (m *QueryError) XXX_Size() int {
+	return xxx_messageInfo_QueryError.Size(m)
+}
+func (m *QueryError) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryError.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryError proto.InternalMessageInfo
+
+func (m *QueryError) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *QueryError) GetChart() string {
+	if m != nil {
+		return m.Chart
+	}
+	return ""
+}
+
+func (m *QueryError) GetMetric() string {
+	if m != nil {
+		return m.Metric
+	}
+	return ""
+}
+
+func (m *QueryError) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+func (m *QueryError) GetDatasource() string {
+	if m != nil {
+		return m.Datasource
+	}
+	return ""
+}
+
+func (m *QueryError) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+// SeriesEvent reports a series which was added to or removed from query results.
+type SeriesEvent struct {
+	// added or removed
+	State     string `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	Name      string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	ChartName string `protobuf:"bytes,3,opt,name=chart_name,json=chartName,proto3" json:"chart_name,omitempty"`
+	// the Unix timestamp of the latest sample of the series
+	LastSeen             int64    `protobuf:"varint,4,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SeriesEvent) Reset()         { *m = SeriesEvent{} }
+func (m *SeriesEvent) String() string { return proto.CompactTextString(m) }
+func (*SeriesEvent) ProtoMessage()    {}
+func (*SeriesEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{4}
+}
+
+func (m *SeriesEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SeriesEvent.Unmarshal(m, b)
+}
+func (m *SeriesEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SeriesEvent.Marshal(b, m, deterministic)
+}
+func (m *SeriesEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SeriesEvent.Merge(m, src)
+}
+func (m *SeriesEvent) XXX_Size() int {
+	return xxx_messageInfo_SeriesEvent.Size(m)
+}
+func (m *SeriesEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_SeriesEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SeriesEvent proto.InternalMessageInfo
+
+func (m *SeriesEvent) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *SeriesEvent) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *SeriesEvent) GetChartName() string {
+	if m != nil {
+		return m.ChartName
+	}
+	return ""
+}
+
+func (m *SeriesEvent) GetLastSeen() int64 {
+	if m != nil {
+		return m.LastSeen
+	}
+	return 0
+}
+
+// Alert is the state of an alert rule for a single series.
+type Alert struct {
+	Rule   string `protobuf:"bytes,1,opt,name=rule,proto3" json:"rule,omitempty"`
+	Chart  string `protobuf:"bytes,2,opt,name=chart,proto3" json:"chart,omitempty"`
+	Metric string `protobuf:"bytes,3,opt,name=metric,proto3" json:"metric,omitempty"`
+	// the name of the series. empty for absent rules
+	Name string `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	// pending, firing or resolved
+	State     string            `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	Condition string            `protobuf:"bytes,6,opt,name=condition,proto3" json:"condition,omitempty"`
+	Threshold float64           `protobuf:"fixed64,7,opt,name=threshold,proto3" json:"threshold,omitempty"`
+	Labels    map[string]string `protobuf:"bytes,8,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// the latest value of the series
+	Value string `protobuf:"bytes,9,opt,name=value,proto3" json:"value,omitempty"`
+	// the Unix timestamps the condition started holding at, the alert fired at and resolved at
+	ActiveAt             int64    `protobuf:"varint,10,opt,name=active_at,json=activeAt,proto3" json:"active_at,omitempty"`
+	FiredAt              int64    `protobuf:"varint,11,opt,name=fired_at,json=firedAt,proto3" json:"fired_at,omitempty"`
+	ResolvedAt           int64    `protobuf:"varint,12,opt,name=resolved_at,json=resolvedAt,proto3" json:"resolved_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Alert) Reset()         { *m = Alert{} }
+func (m *Alert) String() string { return proto.CompactTextString(m) }
+func (*Alert) ProtoMessage()    {}
+func (*Alert) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{5}
+}
+
+func (m *Alert) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Alert.Unmarshal(m, b)
+}
+func (m *Alert) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Alert.Marshal(b, m, deterministic)
+}
+func (m *Alert) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Alert.Merge(m, src)
+}
+func (m *Alert) XXX_Size() int {
+	return xxx_messageInfo_Alert.Size(m)
+}
+func (m *Alert) XXX_DiscardUnknown() {
+	xxx_messageInfo_Alert.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Alert proto.InternalMessageInfo
+
+func (m *Alert) GetRule() string {
+	if m != nil {
+		return m.Rule
+	}
+	return ""
+}
+
+func (m *Alert) GetChart() string {
+	if m != nil {
+		return m.Chart
+	}
+	return ""
+}
+
+func (m *Alert) GetMetric() string {
+	if m != nil {
+		return m.Metric
+	}
+	return ""
+}
+
+func (m *Alert) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Alert) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *Alert) GetCondition() string {
+	if m != nil {
+		return m.Condition
+	}
+	return ""
+}
+
+func (m *Alert) GetThreshold() float64 {
+	if m != nil {
+		return m.Threshold
+	}
+	return 0
+}
+
+func (m *Alert) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *Alert) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *Alert) GetActiveAt() int64 {
+	if m != nil {
+		return m.ActiveAt
+	}
+	return 0
+}
+
+func (m *Alert) GetFiredAt() int64 {
+	if m != nil {
+		return m.FiredAt
+	}
+	return 0
+}
+
+func (m *Alert) GetResolvedAt() int64 {
+	if m != nil {
+		return m.ResolvedAt
+	}
+	return 0
+}
+
+type ChartMetric struct {
+	Name       string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Chart      string `protobuf:"bytes,2,opt,name=chart,proto3" json:"chart,omitempty"`
+	Query      string `protobuf:"bytes,3,opt,name=query,proto3" json:"query,omitempty"`
+	Datasource string `protobuf:"bytes,4,opt,name=datasource,proto3" json:"datasource,omitempty"`
+	// an optional timeout for each live query in milliseconds
+	TimeoutMs int64 `protobuf:"varint,5,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	// an optional arithmetic expression over other chart metrics of the chart.
+	// a chart metric with an expression is derived rather than queried
+	Expr string `protobuf:"bytes,6,opt,name=expr,proto3" json:"expr,omitempty"`
+	// transforms applied in order to the chart metric's values before delivery
+	Transforms []*Transform `protobuf:"bytes,7,rep,name=transforms,proto3" json:"transforms,omitempty"`
+	// alert rules evaluated on the chart metric's transformed values
+	Alerts               []*AlertRule `protobuf:"bytes,8,rep,name=alerts,proto3" json:"alerts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *ChartMetric) Reset()         { *m = ChartMetric{} }
+func (m *ChartMetric) String() string { return proto.CompactTextString(m) }
+func (*ChartMetric) ProtoMessage()    {}
+func (*ChartMetric) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{6}
+}
+
+func (m *ChartMetric) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChartMetric.Unmarshal(m, b)
+}
+func (m *ChartMetric) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChartMetric.Marshal(b, m, deterministic)
+}
+func (m *ChartMetric) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChartMetric.Merge(m, src)
+}
+func (m *ChartMetric) XXX_Size() int {
+	return xxx_messageInfo_ChartMetric.Size(m)
+}
+func (m *ChartMetric) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChartMetric.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChartMetric proto.InternalMessageInfo
+
+func (m *ChartMetric) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ChartMetric) GetChart() string {
+	if m != nil {
+		return m.Chart
+	}
+	return ""
+}
+
+func (m *ChartMetric) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+func (m *ChartMetric) GetDatasource() string {
+	if m != nil {
+		return m.Datasource
+	}
+	return ""
+}
+
+func (m *ChartMetric) GetTimeoutMs() int64 {
+	if m != nil {
+		return m.TimeoutMs
+	}
+	return 0
+}
+
+func (m *ChartMetric) GetExpr() string {
+	if m != nil {
+		return m.Expr
+	}
+	return ""
+}
+
+func (m *ChartMetric) GetTransforms() []*Transform {
+	if m != nil {
+		return m.Transforms
+	}
+	return nil
+}
+
+func (m *ChartMetric) GetAlerts() []*AlertRule {
+	if m != nil {
+		return m.Alerts
+	}
+	return nil
+}
+
+// AlertRule is a threshold watched on every series of a chart metric.
+type AlertRule struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// above, below or absent
+	Condition string  `protobuf:"bytes,2,opt,name=condition,proto3" json:"condition,omitempty"`
+	Threshold float64 `protobuf:"fixed64,3,opt,name=threshold,proto3" json:"threshold,omitempty"`
+	// how long the condition must hold in milliseconds before the alert fires
+	ForMs int64 `protobuf:"varint,4,opt,name=for_ms,json=forMs,proto3" json:"for_ms,omitempty"`
+	// how far a firing series' value must cross back past the threshold before the alert resolves
+	Hysteresis           float64           `protobuf:"fixed64,5,opt,name=hysteresis,proto3" json:"hysteresis,omitempty"`
+	Labels               map[string]string `protobuf:"bytes,6,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *AlertRule) Reset()         { *m = AlertRule{} }
+func (m *AlertRule) String() string { return proto.CompactTextString(m) }
+func (*AlertRule) ProtoMessage()    {}
+func (*AlertRule) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{7}
+}
+
+func (m *AlertRule) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AlertRule.Unmarshal(m, b)
+}
+func (m *AlertRule) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AlertRule.Marshal(b, m, deterministic)
+}
+func (m *AlertRule) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AlertRule.Merge(m, src)
+}
+func (m *AlertRule) XXX_Size() int {
+	return xxx_messageInfo_AlertRule.Size(m)
+}
+func (m *AlertRule) XXX_DiscardUnknown() {
+	xxx_messageInfo_AlertRule.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AlertRule proto.InternalMessageInfo
+
+func (m *AlertRule) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *AlertRule) GetCondition() string {
+	if m != nil {
+		return m.Condition
+	}
+	return ""
+}
+
+func (m *AlertRule) GetThreshold() float64 {
+	if m != nil {
+		return m.Threshold
+	}
+	return 0
+}
+
+func (m *AlertRule) GetForMs() int64 {
+	if m != nil {
+		return m.ForMs
+	}
+	return 0
+}
+
+func (m *AlertRule) GetHysteresis() float64 {
+	if m != nil {
+		return m.Hysteresis
+	}
+	return 0
+}
+
+func (m *AlertRule) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+// Transform is a single step of a chart metric's transforms.
+type Transform struct {
+	// scale, offset, moving_average, ewma, rate, derivative, cumulative_sum, clamp or round
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// the factor of scale and the addend of offset
+	Value float64 `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	// the number of points averaged by moving_average
+	Window int64 `protobuf:"varint,3,opt,name=window,proto3" json:"window,omitempty"`
+	// the smoothing factor of ewma
+	Alpha float64 `protobuf:"fixed64,4,opt,name=alpha,proto3" json:"alpha,omitempty"`
+	// the bounds of clamp. either may be omitted
+	Min *wrappers.DoubleValue `protobuf:"bytes,5,opt,name=min,proto3" json:"min,omitempty"`
+	Max *wrappers.DoubleValue `protobuf:"bytes,6,opt,name=max,proto3" json:"max,omitempty"`
+	// the number of decimal places round rounds to
+	Precision            int64    `protobuf:"varint,7,opt,name=precision,proto3" json:"precision,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Transform) Reset()         { *m = Transform{} }
+func (m *Transform) String() string { return proto.CompactTextString(m) }
+func (*Transform) ProtoMessage()    {}
+func (*Transform) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{8}
+}
+
+func (m *Transform) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Transform.Unmarshal(m, b)
+}
+func (m *Transform) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Transform.Marshal(b, m, deterministic)
+}
+func (m *Transform) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Transform.Merge(m, src)
+}
+func (m *Transform) XXX_Size() int {
+	return xxx_messageInfo_Transform.Size(m)
+}
+func (m *Transform) XXX_DiscardUnknown() {
+	xxx_messageInfo_Transform.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Transform proto.InternalMessageInfo
+
+func (m *Transform) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *Transform) GetValue() float64 {
+	if m != nil {
+		return m.Value
+	}
+	return 0
+}
+
+func (m *Transform) GetWindow() int64 {
+	if m != nil {
+		return m.Window
+	}
+	return 0
+}
+
+func (m *Transform) GetAlpha() float64 {
+	if m != nil {
+		return m.Alpha
+	}
+	return 0
+}
+
+func (m *Transform) GetMin() *wrappers.DoubleValue {
+	if m != nil {
+		return m.Min
+	}
+	return nil
+}
+
+func (m *Transform) GetMax() *wrappers.DoubleValue {
+	if m != nil {
+		return m.Max
+	}
+	return nil
+}
+
+func (m *Transform) GetPrecision() int64 {
+	if m != nil {
+		return m.Precision
+	}
+	return 0
+}
+
+// Aggregation combines the series of each of a chart's metrics.
+type Aggregation struct {
+	// top_k, bottom_k, sum, avg, min, max or quantile
+	Op string `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	// the number of series top_k and bottom_k keep
+	K int64 `protobuf:"varint,2,opt,name=k,proto3" json:"k,omitempty"`
+	// what top_k and bottom_k rank series by: latest or avg
+	By string `protobuf:"bytes,3,opt,name=by,proto3" json:"by,omitempty"`
+	// the name of the series summing those top_k and bottom_k do not keep
+	Other string `protobuf:"bytes,4,opt,name=other,proto3" json:"other,omitempty"`
+	// the quantile between 0 and 1 computed by quantile
+	Quantile             float64  `protobuf:"fixed64,5,opt,name=quantile,proto3" json:"quantile,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Aggregation) Reset()         { *m = Aggregation{} }
+func (m *Aggregation) String() string { return proto.CompactTextString(m) }
+func (*Aggregation) ProtoMessage()    {}
+func (*Aggregation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{9}
+}
+
+func (m *Aggregation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Aggregation.Unmarshal(m, b)
+}
+func (m *Aggregation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Aggregation.Marshal(b, m, deterministic)
+}
+func (m *Aggregation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Aggregation.Merge(m, src)
+}
+func (m *Aggregation) XXX_Size() int {
+	return xxx_messageInfo_Aggregation.Size(m)
+}
+func (m *Aggregation) XXX_DiscardUnknown() {
+	xxx_messageInfo_Aggregation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Aggregation proto.InternalMessageInfo
+
+func (m *Aggregation) GetOp() string {
+	if m != nil {
+		return m.Op
+	}
+	return ""
+}
+
+func (m *Aggregation) GetK() int64 {
+	if m != nil {
+		return m.K
+	}
+	return 0
+}
+
+func (m *Aggregation) GetBy() string {
+	if m != nil {
+		return m.By
+	}
+	return ""
+}
+
+func (m *Aggregation) GetOther() string {
+	if m != nil {
+		return m.Other
+	}
+	return ""
+}
+
+func (m *Aggregation) GetQuantile() float64 {
+	if m != nil {
+		return m.Quantile
+	}
+	return 0
+}
+
+type Chart struct {
+	Name    string         `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Metrics []*ChartMetric `protobuf:"bytes,2,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	// an optional minimum poll interval in milliseconds
+	MinIntervalMs int64 `protobuf:"varint,3,opt,name=min_interval_ms,json=minIntervalMs,proto3" json:"min_interval_ms,omitempty"`
+	// an optional aggregation across the series of each chart metric
+	Aggregation          *Aggregation `protobuf:"bytes,4,opt,name=aggregation,proto3" json:"aggregation,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *Chart) Reset()         { *m = Chart{} }
+func (m *Chart) String() string { return proto.CompactTextString(m) }
+func (*Chart) ProtoMessage()    {}
+func (*Chart) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{10}
+}
+
+func (m *Chart) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Chart.Unmarshal(m, b)
+}
+func (m *Chart) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Chart.Marshal(b, m, deterministic)
+}
+func (m *Chart) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Chart.Merge(m, src)
+}
+func (m *Chart) XXX_Size() int {
+	return xxx_messageInfo_Chart.Size(m)
+}
+func (m *Chart) XXX_DiscardUnknown() {
+	xxx_messageInfo_Chart.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Chart proto.InternalMessageInfo
+
+func (m *Chart) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Chart) GetMetrics() []*ChartMetric {
+	if m != nil {
+		return m.Metrics
+	}
+	return nil
+}
+
+func (m *Chart) GetMinIntervalMs() int64 {
+	if m != nil {
+		return m.MinIntervalMs
+	}
+	return 0
+}
+
+func (m *Chart) GetAggregation() *Aggregation {
+	if m != nil {
+		return m.Aggregation
+	}
+	return nil
+}
+
+type GetChartsRequest struct {
+	ChartNames           []string `protobuf:"bytes,1,rep,name=chart_names,json=chartNames,proto3" json:"chart_names,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetChartsRequest) Reset()         { *m = GetChartsRequest{} }
+func (m *GetChartsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetChartsRequest) ProtoMessage()    {}
+func (*GetChartsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{11}
+}
+
+func (m *GetChartsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetChartsRequest.Unmarshal(m, b)
+}
+func (m *GetChartsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetChartsRequest.Marshal(b, m, deterministic)
+}
+func (m *GetChartsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetChartsRequest.Merge(m, src)
+}
+func (m *GetChartsRequest) XXX_Size() int {
+	return xxx_messageInfo_GetChartsRequest.Size(m)
+}
+func (m *GetChartsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetChartsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetChartsRequest proto.InternalMessageInfo
+
+func (m *GetChartsRequest) GetChartNames() []string {
+	if m != nil {
+		return m.ChartNames
+	}
+	return nil
+}
+
+type GetChartsResponse struct {
+	Charts               []*Chart `protobuf:"bytes,1,rep,name=charts,proto3" json:"charts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetChartsResponse) Reset()         { *m = GetChartsResponse{} }
+func (m *GetChartsResponse) String() string { return proto.CompactTextString(m) }
+func (*GetChartsResponse) ProtoMessage()    {}
+func (*GetChartsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{12}
+}
+
+func (m *GetChartsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetChartsResponse.Unmarshal(m, b)
+}
+func (m *GetChartsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetChartsResponse.Marshal(b, m, deterministic)
+}
+func (m *GetChartsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetChartsResponse.Merge(m, src)
+}
+func (m *GetChartsResponse) XXX_Size() int {
+	return xxx_messageInfo_GetChartsResponse.Size(m)
+}
+func (m *GetChartsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetChartsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetChartsResponse proto.InternalMessageInfo
+
+func (m *GetChartsResponse) GetCharts() []*Chart {
+	if m != nil {
+		return m.Charts
+	}
+	return nil
+}
+
+type StoreChartsRequest struct {
+	Charts               []*Chart `protobuf:"bytes,1,rep,name=charts,proto3" json:"charts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StoreChartsRequest) Reset()         { *m = StoreChartsRequest{} }
+func (m *StoreChartsRequest) String() string { return proto.CompactTextString(m) }
+func (*StoreChartsRequest) ProtoMessage()    {}
+func (*StoreChartsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{13}
+}
+
+func (m *StoreChartsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StoreChartsRequest.Unmarshal(m, b)
+}
+func (m *StoreChartsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StoreChartsRequest.Marshal(b, m, deterministic)
+}
+func (m *StoreChartsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StoreChartsRequest.Merge(m, src)
+}
+func (m *StoreChartsRequest) XXX_Size() int {
+	return xxx_messageInfo_StoreChartsRequest.Size(m)
+}
+func (m *StoreChartsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StoreChartsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StoreChartsRequest proto.InternalMessageInfo
+
+func (m *StoreChartsRequest) GetCharts() []*Chart {
+	if m != nil {
+		return m.Charts
+	}
+	return nil
+}
+
+type StoreChartsResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StoreChartsResponse) Reset()         { *m = StoreChartsResponse{} }
+func (m *StoreChartsResponse) String() string { return proto.CompactTextString(m) }
+func (*StoreChartsResponse) ProtoMessage()    {}
+func (*StoreChartsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{14}
+}
+
+func (m *StoreChartsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StoreChartsResponse.Unmarshal(m, b)
+}
+func (m *StoreChartsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StoreChartsResponse.Marshal(b, m, deterministic)
+}
+func (m *StoreChartsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StoreChartsResponse.Merge(m, src)
+}
+func (m *StoreChartsResponse) XXX_Size() int {
+	return xxx_messageInfo_StoreChartsResponse.Size(m)
+}
+func (m *StoreChartsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_StoreChartsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StoreChartsResponse proto.InternalMessageInfo
+
+type RemoveChartsRequest struct {
+	ChartNames           []string `protobuf:"bytes,1,rep,name=chart_names,json=chartNames,proto3" json:"chart_names,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RemoveChartsRequest) Reset()         { *m = RemoveChartsRequest{} }
+func (m *RemoveChartsRequest) String() string { return proto.CompactTextString(m) }
+func (*RemoveChartsRequest) ProtoMessage()    {}
+func (*RemoveChartsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{15}
+}
+
+func (m *RemoveChartsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RemoveChartsRequest.Unmarshal(m, b)
+}
+func (m *RemoveChartsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RemoveChartsRequest.Marshal(b, m, deterministic)
+}
+func (m *RemoveChartsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RemoveChartsRequest.Merge(m, src)
+}
+func (m *RemoveChartsRequest) XXX_Size() int {
+	return xxx_messageInfo_RemoveChartsRequest.Size(m)
+}
+func (m *RemoveChartsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RemoveChartsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RemoveChartsRequest proto.InternalMessageInfo
+
+func (m *RemoveChartsRequest) GetChartNames() []string {
+	if m != nil {
+		return m.ChartNames
+	}
+	return nil
+}
+
+type RemoveChartsResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RemoveChartsResponse) Reset()         { *m = RemoveChartsResponse{} }
+func (m *RemoveChartsResponse) String() string { return proto.CompactTextString(m) }
+func (*RemoveChartsResponse) ProtoMessage()    {}
+func (*RemoveChartsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_64252075a4799de0, []int{16}
+}
+
+func (m *RemoveChartsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RemoveChartsResponse.Unmarshal(m, b)
+}
+func (m *RemoveChartsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RemoveChartsResponse.Marshal(b, m, deterministic)
+}
+func (m *RemoveChartsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RemoveChartsResponse.Merge(m, src)
+}
+func (m *RemoveChartsResponse) XXX_Size() int {
+	return xxx_messageInfo_RemoveChartsResponse.Size(m)
+}
+func (m *RemoveChartsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RemoveChartsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RemoveChartsResponse proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterType((*SubscribeRequest)(nil), "graphx.SubscribeRequest")
+	proto.RegisterType((*Metric)(nil), "graphx.Metric")
+	proto.RegisterType((*MetricBatch)(nil), "graphx.MetricBatch")
+	proto.RegisterMapType((map[string]int64)(nil), "graphx.MetricBatch.IntervalsMsEntry")
+	proto.RegisterType((*QueryError)(nil), "graphx.QueryError")
+	proto.RegisterType((*SeriesEvent)(nil), "graphx.SeriesEvent")
+	proto.RegisterType((*Alert)(nil), "graphx.Alert")
+	proto.RegisterMapType((map[string]string)(nil), "graphx.Alert.LabelsEntry")
+	proto.RegisterType((*ChartMetric)(nil), "graphx.ChartMetric")
+	proto.RegisterType((*AlertRule)(nil), "graphx.AlertRule")
+	proto.RegisterMapType((map[string]string)(nil), "graphx.AlertRule.LabelsEntry")
+	proto.RegisterType((*Transform)(nil), "graphx.Transform")
+	proto.RegisterType((*Aggregation)(nil), "graphx.Aggregation")
+	proto.RegisterType((*Chart)(nil), "graphx.Chart")
+	proto.RegisterType((*GetChartsRequest)(nil), "graphx.GetChartsRequest")
+	proto.RegisterType((*GetChartsResponse)(nil), "graphx.GetChartsResponse")
+	proto.RegisterType((*StoreChartsRequest)(nil), "graphx.StoreChartsRequest")
+	proto.RegisterType((*StoreChartsResponse)(nil), "graphx.StoreChartsResponse")
+	proto.RegisterType((*RemoveChartsRequest)(nil), "graphx.RemoveChartsRequest")
+	proto.RegisterType((*RemoveChartsResponse)(nil), "graphx.RemoveChartsResponse")
+}
+
+func init() { proto.RegisterFile("graphx.proto", fileDescriptor_64252075a4799de0) }
+
+var fileDescriptor_64252075a4799de0 = []byte{
+	// 1286 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0xdd, 0x8e, 0xdc, 0xc4,
+	0x12, 0x96, 0x67, 0x76, 0xbc, 0xeb, 0xf2, 0x6c, 0xb2, 0xe9, 0x4d, 0x22, 0x67, 0xf2, 0x73, 0x72,
+	0xac, 0x73, 0x72, 0x36, 0x07, 0x31, 0x4b, 0x12, 0x05, 0x41, 0x82, 0x10, 0x1b, 0x08, 0xab, 0x48,
+	0x2c, 0x02, 0x2f, 0xe2, 0x82, 0x9b, 0x51, 0x8f, 0xa7, 0x66, 0xc6, 0x5a, 0xdb, 0xed, 0x74, 0xb7,
+	0xf7, 0x27, 0xd7, 0x48, 0xdc, 0xf0, 0x06, 0x48, 0xdc, 0xf3, 0x4a, 0xdc, 0xf1, 0x22, 0x08, 0x75,
+	0xb5, 0xed, 0xf1, 0xec, 0x4e, 0x42, 0x22, 0xee, 0xba, 0xbe, 0xaa, 0xfe, 0xa9, 0xfa, 0xbe, 0xae,
+	0x6e, 0xe8, 0xcf, 0x24, 0x2f, 0xe6, 0xa7, 0xc3, 0x42, 0x0a, 0x2d, 0x98, 0x6b, 0xad, 0xc1, 0x9d,
+	0x99, 0x10, 0xb3, 0x14, 0x77, 0x09, 0x1d, 0x97, 0xd3, 0xdd, 0x13, 0xc9, 0x8b, 0x02, 0xa5, 0xb2,
+	0x71, 0xe1, 0x4f, 0x5d, 0xd8, 0x3a, 0x2c, 0xc7, 0x2a, 0x96, 0xc9, 0x18, 0x23, 0x7c, 0x59, 0xa2,
+	0xd2, 0xec, 0x5f, 0xe0, 0xc7, 0x73, 0x2e, 0xf5, 0x28, 0xe7, 0x19, 0xaa, 0xc0, 0xb9, 0xdb, 0xdd,
+	0xf1, 0x22, 0x20, 0xe8, 0x6b, 0x83, 0xb0, 0xab, 0xd0, 0xb3, 0xae, 0x0e, 0xb9, 0xac, 0xc1, 0x76,
+	0x60, 0xab, 0x10, 0x69, 0x3a, 0x4a, 0x72, 0x8d, 0xf2, 0x98, 0xa7, 0xa3, 0x4c, 0x05, 0xdd, 0xbb,
+	0xce, 0x4e, 0x37, 0xba, 0x64, 0xf0, 0x17, 0x15, 0x7c, 0xa0, 0x18, 0x83, 0xb5, 0x69, 0x92, 0xa6,
+	0xc1, 0x1a, 0x79, 0x69, 0xcc, 0x42, 0xe8, 0x8f, 0x79, 0x7c, 0x54, 0x48, 0x54, 0xaa, 0x94, 0x18,
+	0xf4, 0xee, 0x3a, 0x3b, 0x5e, 0xb4, 0x84, 0x99, 0x83, 0x8d, 0xcb, 0xe9, 0x14, 0xe5, 0x48, 0x25,
+	0xaf, 0x30, 0x70, 0x69, 0x3a, 0x58, 0xe8, 0x30, 0x79, 0x85, 0x6c, 0x17, 0xae, 0x66, 0xfc, 0x74,
+	0x74, 0xe1, 0x18, 0xeb, 0x14, 0x79, 0x25, 0xe3, 0xa7, 0xdf, 0x2c, 0x9f, 0xe4, 0xdf, 0xd0, 0x3f,
+	0x42, 0x2c, 0x78, 0x9a, 0x1c, 0xa3, 0x09, 0xdc, 0xa0, 0x40, 0xbf, 0xc1, 0x0e, 0x14, 0xbb, 0x07,
+	0x97, 0x15, 0xca, 0x04, 0xd5, 0x68, 0x26, 0x79, 0x4c, 0x51, 0x1e, 0x45, 0x6d, 0x5a, 0x78, 0xdf,
+	0xa0, 0x07, 0x8a, 0xdd, 0x06, 0xb0, 0x7b, 0x27, 0xb9, 0x56, 0x01, 0x50, 0x88, 0x47, 0x3b, 0x1a,
+	0x80, 0xdd, 0x01, 0x98, 0x88, 0x93, 0x5c, 0xf1, 0xac, 0x48, 0x31, 0xf0, 0x29, 0xbb, 0x16, 0x12,
+	0x16, 0xe0, 0x1e, 0xa0, 0x96, 0x49, 0x6c, 0xaa, 0x63, 0x0a, 0x1a, 0x38, 0x14, 0x43, 0x63, 0xb3,
+	0xf8, 0x82, 0x92, 0xa0, 0x43, 0x1e, 0xaf, 0x61, 0xc4, 0xb8, 0x75, 0x92, 0xe1, 0x48, 0x69, 0x9e,
+	0x15, 0x55, 0xd1, 0x3d, 0x83, 0x1c, 0x1a, 0xc0, 0xf0, 0x75, 0xcc, 0xd3, 0x12, 0xa9, 0xe0, 0x5e,
+	0x64, 0x8d, 0xf0, 0xf7, 0x0e, 0xf8, 0x76, 0xcb, 0x67, 0x5c, 0xc7, 0x73, 0xb6, 0x03, 0xeb, 0x19,
+	0x99, 0x96, 0x72, 0xff, 0xe1, 0xa5, 0x61, 0xa5, 0x29, 0x1b, 0x15, 0xd5, 0x6e, 0x16, 0xc0, 0xfa,
+	0x44, 0x8a, 0xa2, 0xc0, 0x09, 0x1d, 0x65, 0x2d, 0xaa, 0x4d, 0xf6, 0x7f, 0x70, 0x51, 0x4a, 0x21,
+	0x0d, 0xf3, 0x66, 0x09, 0x56, 0x2f, 0xf1, 0x6d, 0x89, 0xf2, 0xec, 0xb9, 0x71, 0x45, 0x55, 0x04,
+	0xdb, 0x87, 0x7e, 0xcd, 0x91, 0x32, 0x55, 0x5d, 0xa3, 0x19, 0xff, 0x59, 0xde, 0x94, 0x8e, 0x36,
+	0xac, 0x19, 0x53, 0x07, 0xea, 0x79, 0xae, 0xe5, 0x59, 0xe4, 0x27, 0x0b, 0x84, 0xbd, 0x07, 0xae,
+	0xa5, 0x22, 0xe8, 0xd1, 0x12, 0xdb, 0xf5, 0x12, 0x87, 0x84, 0x3e, 0x3f, 0xc6, 0x5c, 0x47, 0x55,
+	0x08, 0xfb, 0x2f, 0xb8, 0x3c, 0x45, 0xa9, 0x55, 0xe0, 0x52, 0xf0, 0x66, 0x1d, 0xbc, 0x67, 0xd0,
+	0xa8, 0x72, 0x0e, 0x3e, 0x85, 0xad, 0xf3, 0x9b, 0xb2, 0x2d, 0xe8, 0x1e, 0xe1, 0x59, 0xc5, 0x8b,
+	0x19, 0x2e, 0x0a, 0xdb, 0xa1, 0x92, 0x5b, 0xe3, 0x49, 0xe7, 0x23, 0x27, 0xfc, 0xd5, 0x01, 0x58,
+	0xe4, 0x6c, 0x38, 0x3d, 0x4a, 0xf2, 0x49, 0xcd, 0xa9, 0x19, 0x9b, 0xc9, 0xc4, 0x60, 0x45, 0xa7,
+	0x35, 0xd8, 0x75, 0x70, 0x6d, 0x99, 0x89, 0x46, 0x2f, 0xaa, 0x2c, 0x13, 0xfd, 0xd2, 0xac, 0x57,
+	0x73, 0x48, 0x06, 0xa9, 0x8a, 0x6b, 0xae, 0x44, 0x29, 0xe3, 0xfa, 0xce, 0xb4, 0x10, 0xc3, 0x54,
+	0x86, 0x4a, 0xf1, 0x99, 0xbd, 0x2d, 0x5e, 0x54, 0x9b, 0xa1, 0x02, 0xbf, 0x55, 0x1e, 0xb3, 0xbc,
+	0xd2, 0x5c, 0xd7, 0xaa, 0xb3, 0x46, 0x23, 0xc5, 0xce, 0x6b, 0xa5, 0xd8, 0x3d, 0x2f, 0xc5, 0x9b,
+	0xe0, 0xa5, 0x5c, 0xe9, 0x91, 0x42, 0xcc, 0xab, 0x0b, 0xbe, 0x61, 0x80, 0x43, 0xc4, 0x3c, 0xfc,
+	0xb9, 0x0b, 0x3d, 0xaa, 0xb3, 0x59, 0x59, 0x96, 0x69, 0x23, 0x72, 0x33, 0x7e, 0xc7, 0x82, 0xd4,
+	0x67, 0x5b, 0x6b, 0x9d, 0xad, 0xc9, 0xa2, 0xd7, 0xce, 0xe2, 0x16, 0x78, 0xb1, 0xc8, 0x27, 0x89,
+	0x4e, 0x44, 0x5e, 0x95, 0x61, 0x01, 0x18, 0xaf, 0x9e, 0x4b, 0x54, 0x73, 0x91, 0x4e, 0xa8, 0x51,
+	0x38, 0xd1, 0x02, 0x60, 0x0f, 0xc0, 0x4d, 0xf9, 0x18, 0x53, 0xd3, 0x1a, 0x8c, 0x5c, 0x6e, 0x2c,
+	0xc9, 0x65, 0xf8, 0x15, 0xf9, 0xac, 0x26, 0xab, 0xc0, 0x85, 0x28, 0xbc, 0xd6, 0x6d, 0x33, 0x75,
+	0xe1, 0xb1, 0x36, 0x6d, 0x86, 0xeb, 0xaa, 0x3b, 0x6c, 0x58, 0x60, 0x4f, 0xb3, 0x1b, 0xb0, 0x31,
+	0x4d, 0x24, 0x4e, 0x8c, 0xcf, 0x27, 0xdf, 0x3a, 0xd9, 0x7b, 0xd4, 0x8c, 0x25, 0x2a, 0x91, 0x1e,
+	0x5b, 0x6f, 0x9f, 0xbc, 0x50, 0x43, 0x7b, 0x7a, 0xf0, 0x31, 0xf8, 0xad, 0x53, 0xfc, 0x9d, 0x48,
+	0xbd, 0xb6, 0x48, 0xff, 0x74, 0xc0, 0xff, 0xdc, 0x14, 0xf9, 0x0d, 0x9d, 0x67, 0x35, 0x29, 0x8d,
+	0x1a, 0xbb, 0xaf, 0x57, 0xe3, 0xda, 0x05, 0x35, 0x56, 0x6d, 0x4a, 0x94, 0xda, 0xdc, 0xf7, 0xde,
+	0xa2, 0x4d, 0x89, 0x52, 0xdb, 0x67, 0x01, 0x4f, 0x0b, 0x59, 0x51, 0x44, 0x63, 0xf6, 0x00, 0x40,
+	0x4b, 0x9e, 0xab, 0xa9, 0x90, 0xd4, 0xc7, 0x0d, 0x07, 0x57, 0x6a, 0x0e, 0xbe, 0xab, 0x3d, 0x51,
+	0x2b, 0x88, 0xdd, 0x6f, 0x6e, 0xf8, 0xc6, 0x72, 0xb8, 0xbd, 0xe1, 0x65, 0x8a, 0xf5, 0x2d, 0x0f,
+	0x7f, 0xec, 0x80, 0xd7, 0xa0, 0x2b, 0xd3, 0x5f, 0xd2, 0x4e, 0xe7, 0x8d, 0xda, 0xe9, 0x9e, 0xd7,
+	0xce, 0x35, 0x70, 0xa7, 0x42, 0xda, 0xd6, 0x46, 0xed, 0x61, 0x2a, 0xe4, 0x01, 0xbd, 0x04, 0xf3,
+	0x33, 0xa5, 0x51, 0xa2, 0x4a, 0x6c, 0x15, 0x9c, 0xa8, 0x85, 0xb0, 0xc7, 0x8d, 0xe4, 0x6c, 0x87,
+	0xba, 0x7d, 0xe1, 0xfc, 0xab, 0x64, 0xf7, 0x4f, 0x74, 0xf0, 0x87, 0x03, 0x5e, 0x53, 0x4b, 0x53,
+	0x06, 0x7d, 0x56, 0x34, 0x65, 0x30, 0xe3, 0xe5, 0xb9, 0x4e, 0xad, 0xe9, 0xeb, 0xe0, 0x9e, 0x24,
+	0xf9, 0x44, 0x9c, 0x54, 0x4f, 0x4e, 0x65, 0x99, 0x68, 0x9e, 0x16, 0x73, 0x4e, 0x79, 0x3b, 0x91,
+	0x35, 0xd8, 0x10, 0xba, 0x59, 0x92, 0x53, 0xc2, 0xfe, 0xc3, 0x5b, 0x43, 0xfb, 0x33, 0x19, 0xd6,
+	0x3f, 0x93, 0xe1, 0x17, 0xa2, 0x1c, 0xa7, 0xf8, 0xbd, 0x59, 0x38, 0x32, 0x81, 0x14, 0xcf, 0x4f,
+	0x03, 0xf7, 0xad, 0xe2, 0xf9, 0xa9, 0x21, 0xa3, 0x90, 0x18, 0x27, 0xca, 0x50, 0x65, 0x5f, 0xfc,
+	0x05, 0x10, 0x66, 0xe0, 0xef, 0xcd, 0x66, 0x12, 0x67, 0x9c, 0x98, 0xbb, 0x04, 0x1d, 0x51, 0x54,
+	0x29, 0x76, 0x44, 0xc1, 0xfa, 0xe0, 0x1c, 0x55, 0x5d, 0xdc, 0x39, 0x32, 0xde, 0x71, 0xad, 0xed,
+	0xce, 0x98, 0x4a, 0x27, 0xf4, 0x1c, 0x65, 0xdd, 0x7c, 0xc9, 0x60, 0x03, 0xd8, 0x78, 0x59, 0xf2,
+	0x5c, 0x27, 0x29, 0x56, 0x34, 0x36, 0x76, 0xf8, 0x9b, 0x03, 0x3d, 0xba, 0x5a, 0x2b, 0x55, 0xf5,
+	0xfe, 0xe2, 0xa9, 0xed, 0x2c, 0x3f, 0x59, 0xad, 0xeb, 0xb8, 0x78, 0x6f, 0xef, 0xc1, 0xe5, 0x2c,
+	0xc9, 0x57, 0x7c, 0xac, 0x36, 0xb3, 0x24, 0x6f, 0xfd, 0x66, 0x1e, 0x83, 0xcf, 0x17, 0x39, 0xd2,
+	0x61, 0x5b, 0x4b, 0xb7, 0xd2, 0x8f, 0xda, 0x71, 0xe1, 0x23, 0xd8, 0xda, 0x47, 0x4d, 0x3b, 0xab,
+	0xb7, 0xfd, 0x03, 0x86, 0x4f, 0xe0, 0x4a, 0x6b, 0x92, 0x2a, 0x44, 0xae, 0xd0, 0x3c, 0xae, 0x14,
+	0x52, 0xff, 0x20, 0x36, 0x97, 0xd2, 0x8a, 0x2a, 0x67, 0xf8, 0x14, 0xd8, 0xa1, 0x16, 0x12, 0x97,
+	0xb7, 0x7c, 0xcb, 0xc9, 0xd7, 0x60, 0x7b, 0x69, 0xb2, 0xdd, 0x3a, 0xfc, 0x10, 0xb6, 0x23, 0xcc,
+	0xc4, 0x31, 0xbe, 0x63, 0x1e, 0xd7, 0xe1, 0xea, 0xf2, 0x3c, 0xbb, 0xde, 0xc3, 0x5f, 0x3a, 0xe0,
+	0xee, 0xd3, 0xfe, 0xec, 0x13, 0xf0, 0x9a, 0x3f, 0x32, 0x0b, 0x9a, 0xcf, 0xc5, 0xb9, 0x6f, 0xf3,
+	0x60, 0x7b, 0xc5, 0xcf, 0xe5, 0x03, 0x87, 0x7d, 0x06, 0x5e, 0x53, 0xa8, 0xc5, 0xec, 0xf3, 0x05,
+	0x1f, 0xdc, 0x58, 0xe1, 0xa9, 0xaa, 0xfa, 0x25, 0xf8, 0xad, 0x8c, 0xd9, 0xa0, 0x39, 0xc1, 0x85,
+	0x1a, 0x0e, 0x6e, 0xae, 0xf4, 0x55, 0xeb, 0xbc, 0x80, 0x7e, 0x3b, 0x55, 0xd6, 0x04, 0xaf, 0x28,
+	0xdc, 0xe0, 0xd6, 0x6a, 0xa7, 0x5d, 0xea, 0xd9, 0xfd, 0x1f, 0xfe, 0x37, 0x4b, 0xf4, 0xbc, 0x1c,
+	0x0f, 0x63, 0x91, 0xed, 0xc6, 0xa9, 0x28, 0x27, 0x2a, 0xe6, 0x29, 0x0a, 0x39, 0xdb, 0xb5, 0xf3,
+	0x76, 0x65, 0x11, 0x3f, 0x95, 0x45, 0x3c, 0x76, 0xe9, 0xc6, 0x3e, 0xfa, 0x6b, 0x00, 0x77, 0x86,
+	0xca, 0x08, 0xa1, 0x0c, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// GraphxClient is the client API for Graphx service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type GraphxClient interface {
+	// Subscribe streams batches of metrics for the requested charts and names
+	// until the client cancels the call. a stream which ends on its own ends the
+	// call with FAILED_PRECONDITION when none of its chart metrics could be polled
+	// or ABORTED when it was closed, the status message carrying the reason.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Graphx_SubscribeClient, error)
+	// GetCharts returns the named charts, or every chart when no names are given.
+	GetCharts(ctx context.Context, in *GetChartsRequest, opts ...grpc.CallOption) (*GetChartsResponse, error)
+	// StoreCharts creates or replaces charts.
+	StoreCharts(ctx context.Context, in *StoreChartsRequest, opts ...grpc.CallOption) (*StoreChartsResponse, error)
+	// RemoveCharts removes the named charts.
+	RemoveCharts(ctx context.Context, in *RemoveChartsRequest, opts ...grpc.CallOption) (*RemoveChartsResponse, error)
+}
+
+type graphxClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewGraphxClient(cc *grpc.ClientConn) GraphxClient {
+	return &graphxClient{cc}
+}
+
+func (c *graphxClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Graphx_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Graphx_serviceDesc.Streams[0], "/graphx.Graphx/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &graphxSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Graphx_SubscribeClient interface {
+	Recv() (*MetricBatch, error)
+	grpc.ClientStream
+}
+
+type graphxSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *graphxSubscribeClient) Recv() (*MetricBatch, error) {
+	m := new(MetricBatch)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *graphxClient) GetCharts(ctx context.Context, in *GetChartsRequest, opts ...grpc.CallOption) (*GetChartsResponse, error) {
+	out := new(GetChartsResponse)
+	err := c.cc.Invoke(ctx, "/graphx.Graphx/GetCharts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *graphxClient) StoreCharts(ctx context.Context, in *StoreChartsRequest, opts ...grpc.CallOption) (*StoreChartsResponse, error) {
+	out := new(StoreChartsResponse)
+	err := c.cc.Invoke(ctx, "/graphx.Graphx/StoreCharts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *graphxClient) RemoveCharts(ctx context.Context, in *RemoveChartsRequest, opts ...grpc.CallOption) (*RemoveChartsResponse, error) {
+	out := new(RemoveChartsResponse)
+	err := c.cc.Invoke(ctx, "/graphx.Graphx/RemoveCharts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GraphxServer is the server API for Graphx service.
+type GraphxServer interface {
+	// Subscribe streams batches of metrics for the requested charts and names
+	// until the client cancels the call. a stream which ends on its own ends the
+	// call with FAILED_PRECONDITION when none of its chart metrics could be polled
+	// or ABORTED when it was closed, the status message carrying the reason.
+	Subscribe(*SubscribeRequest, Graphx_SubscribeServer) error
+	// GetCharts returns the named charts, or every chart when no names are given.
+	GetCharts(context.Context, *GetChartsRequest) (*GetChartsResponse, error)
+	// StoreCharts creates or replaces charts.
+	StoreCharts(context.Context, *StoreChartsRequest) (*StoreChartsResponse, error)
+	// RemoveCharts removes the named charts.
+	RemoveCharts(context.Context, *RemoveChartsRequest) (*RemoveChartsResponse, error)
+}
+
+// UnimplementedGraphxServer can be embedded to have forward compatible implementations.
+type UnimplementedGraphxServer struct {
+}
+
+func (*UnimplementedGraphxServer) Subscribe(req *SubscribeRequest, srv Graphx_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (*UnimplementedGraphxServer) GetCharts(ctx context.Context, req *GetChartsRequest) (*GetChartsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCharts not implemented")
+}
+func (*UnimplementedGraphxServer) StoreCharts(ctx context.Context, req *StoreChartsRequest) (*StoreChartsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StoreCharts not implemented")
+}
+func (*UnimplementedGraphxServer) RemoveCharts(ctx context.Context, req *RemoveChartsRequest) (*RemoveChartsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveCharts not implemented")
+}
+
+func RegisterGraphxServer(s *grpc.Server, srv GraphxServer) {
+	s.RegisterService(&_Graphx_serviceDesc, srv)
+}
+
+func _Graphx_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GraphxServer).Subscribe(m, &graphxSubscribeServer{stream})
+}
+
+type Graphx_SubscribeServer interface {
+	Send(*MetricBatch) error
+	grpc.ServerStream
+}
+
+type graphxSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *graphxSubscribeServer) Send(m *MetricBatch) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Graphx_GetCharts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChartsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GraphxServer).GetCharts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/graphx.Graphx/GetCharts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GraphxServer).GetCharts(ctx, req.(*GetChartsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Graphx_StoreCharts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StoreChartsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GraphxServer).StoreCharts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/graphx.Graphx/StoreCharts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GraphxServer).StoreCharts(ctx, req.(*StoreChartsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Graphx_RemoveCharts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveChartsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GraphxServer).RemoveCharts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/graphx.Graphx/RemoveCharts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GraphxServer).RemoveCharts(ctx, req.(*RemoveChartsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Graphx_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "graphx.Graphx",
+	HandlerType: (*GraphxServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCharts",
+			Handler:    _Graphx_GetCharts_Handler,
+		},
+		{
+			MethodName: "StoreCharts",
+			Handler:    _Graphx_StoreCharts_Handler,
+		},
+		{
+			MethodName: "RemoveCharts",
+			Handler:    _Graphx_RemoveCharts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Graphx_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "graphx.proto",
+}
@@ -0,0 +1,261 @@
+package rpc
+
+// graphx.pb.go is generated with protoc-gen-go v1.3.2, the version of github.com/golang/protobuf in go.mod
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative,Mgoogle/protobuf/wrappers.proto=github.com/golang/protobuf/ptypes/wrappers:. graphx.proto
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	// BatchWindow is how long Subscribe waits for further metrics before sending a batch
+	BatchWindow = 100 * time.Millisecond
+	// MaxBatchSize is the number of metrics which causes a batch to be sent immediately
+	MaxBatchSize = 1024
+)
+
+// server implements GraphxServer on top of the same ChartStore and StreamerFactory
+// used by the http handlers.
+type server struct {
+	v  *validator.Validate
+	cs graphx.ChartStore
+	sf graphx.StreamerFactory
+}
+
+// NewServer is a constructor for a GraphxServer.
+func NewServer(v *validator.Validate, cs graphx.ChartStore, sf graphx.StreamerFactory) GraphxServer {
+	return &server{
+		v:  v,
+		cs: cs,
+		sf: sf,
+	}
+}
+
+func (s *server) Subscribe(req *SubscribeRequest, stream Graphx_SubscribeServer) error {
+	cd := req.descriptor()
+	id := fmt.Sprintf("%s.%v", uuid.New().String(), cd.Names)
+	log.Printf("id: %v received subscribe request: %v", id, req)
+
+	// create context for this streaming session, cancelled when the client goes away
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	st, err := graphx.OpenStream(ctx, s.v, s.cs, s.sf, id, cd)
+	if err != nil {
+		log.Printf("id %s: %v", id, err)
+		if _, ok := err.(*graphx.ChartStoreError); ok {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer st.Close()
+
+	// deliver historical metrics before live metrics if requested
+	if req.Fill != 0 {
+		series, err := st.Fill(ctx, time.Time(cd.Fill))
+		if err != nil {
+			log.Printf("id %s: failed to backfill metrics: %v", id, err)
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		for _, sr := range series {
+			batch := &MetricBatch{}
+			for _, m := range sr.Metrics() {
+				batch.Metrics = append(batch.Metrics, fromMetric(m))
+			}
+			if err := stream.Send(batch); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Recv blocks, so pump metrics and query errors onto a channel we can batch from.
+	// the channel is closed once the stream ends
+	rChan := make(chan received, MaxBatchSize)
+	// why the stream ended, set before rChan is closed
+	var eos *graphx.EndOfStream
+	go func() {
+		defer close(rChan)
+		for {
+			var r received
+			r.m, r.err = st.Recv()
+			if r.err != nil {
+				if e, ok := r.err.(*graphx.EndOfStream); ok {
+					log.Printf("id %s: %v", id, e)
+					eos = e
+					return
+				}
+				switch r.err.(type) {
+				case *graphx.SeriesEvent, *graphx.Alert:
+				case *graphx.QueryError:
+					log.Printf("id %s: received error from stream: %v", id, r.err)
+				default:
+					log.Printf("id %s: received error from stream: %v", id, r.err)
+					continue
+				}
+			}
+			select {
+			case rChan <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	lossy, _ := st.(graphx.Lossy)
+	var dropped uint64
+	adaptive, _ := st.(graphx.Adaptive)
+	var changes uint64
+	var intervals map[string]graphx.Duration
+
+	log.Printf("id %s: beginning to stream metrics to client", id)
+	for {
+		// block for the first metric of a batch
+		var batch MetricBatch
+		select {
+		case <-ctx.Done():
+			return nil
+		case r, ok := <-rChan:
+			if !ok {
+				return endStatus(eos)
+			}
+			r.add(&batch)
+		}
+
+		// metrics from a single poll arrive in a burst, collect them into one batch
+		t := time.NewTimer(BatchWindow)
+		ended := false
+	collect:
+		for len(batch.Metrics)+len(batch.Errors)+len(batch.Series)+len(batch.Alerts) < MaxBatchSize {
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return nil
+			case r, ok := <-rChan:
+				if !ok {
+					// send what was collected before the stream ended
+					ended = true
+					break collect
+				}
+				r.add(&batch)
+			case <-t.C:
+				break collect
+			}
+		}
+		t.Stop()
+
+		if lossy != nil {
+			if total := lossy.Dropped(); total > dropped {
+				dropped = total
+				batch.Dropped = total
+			}
+		}
+		if adaptive != nil {
+			if c := adaptive.Changes(); c != changes {
+				changes = c
+				if cur := adaptive.Intervals(); !reflect.DeepEqual(cur, intervals) {
+					intervals = cur
+					batch.IntervalsMs = fromIntervals(cur)
+				}
+			}
+		}
+
+		if err := stream.Send(&batch); err != nil {
+			log.Printf("id %s: received error sending to client. ending stream: %v", id, err)
+			return err
+		}
+		if ended {
+			return endStatus(eos)
+		}
+	}
+}
+
+// endStatus returns the status a Subscribe call ends with once its stream ended. a stream
+// which ended on its own is reported with its reason
+func endStatus(eos *graphx.EndOfStream) error {
+	if eos == nil {
+		return nil
+	}
+	switch eos.Reason {
+	case graphx.EndFinished:
+		return status.Error(codes.FailedPrecondition, eos.Error())
+	case graphx.EndClosed:
+		return status.Error(codes.Aborted, eos.Error())
+	}
+	return nil
+}
+
+// received is the result of a single Recv on a Streamer. err is only ever a *graphx.QueryError,
+// a *graphx.SeriesEvent or a *graphx.Alert
+type received struct {
+	m   *graphx.Metric
+	err error
+}
+
+func (r received) add(batch *MetricBatch) {
+	switch err := r.err.(type) {
+	case *graphx.QueryError:
+		batch.Errors = append(batch.Errors, fromQueryError(err))
+	case *graphx.SeriesEvent:
+		batch.Series = append(batch.Series, fromSeriesEvent(err))
+	case *graphx.Alert:
+		batch.Alerts = append(batch.Alerts, fromAlert(err))
+	default:
+		batch.Metrics = append(batch.Metrics, fromMetric(r.m))
+	}
+}
+
+func (s *server) GetCharts(ctx context.Context, req *GetChartsRequest) (*GetChartsResponse, error) {
+	var charts []*graphx.Chart
+	var err error
+	if len(req.ChartNames) == 0 {
+		charts, err = s.cs.Get()
+	} else {
+		charts, err = s.cs.GetByNames(req.ChartNames)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to query chart store: %v", err)
+	}
+
+	resp := &GetChartsResponse{}
+	for i, chart := range charts {
+		if chart == nil {
+			return nil, status.Errorf(codes.NotFound, "chart %s does not exist", req.ChartNames[i])
+		}
+		resp.Charts = append(resp.Charts, fromChart(chart))
+	}
+	return resp, nil
+}
+
+func (s *server) StoreCharts(ctx context.Context, req *StoreChartsRequest) (*StoreChartsResponse, error) {
+	charts := make([]*graphx.Chart, 0, len(req.Charts))
+	for _, chart := range req.Charts {
+		if chart.Name == "" {
+			return nil, status.Error(codes.InvalidArgument, "charts must be named")
+		}
+		charts = append(charts, toChart(chart))
+	}
+
+	err := s.cs.Store(charts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to store charts: %v", err)
+	}
+	return &StoreChartsResponse{}, nil
+}
+
+func (s *server) RemoveCharts(ctx context.Context, req *RemoveChartsRequest) (*RemoveChartsResponse, error) {
+	err := s.cs.RemoveByNames(req.ChartNames)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to remove charts: %v", err)
+	}
+	return &RemoveChartsResponse{}, nil
+}
@@ -0,0 +1,207 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudscaleorg/graphx"
+	"github.com/cloudscaleorg/graphx/inmem"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// fakeStreamer delivers a fixed set of metrics then ends for end, or blocks until ctx is done
+type fakeStreamer struct {
+	ctx   context.Context
+	mChan chan *graphx.Metric
+	end   graphx.EndReason
+}
+
+func (f *fakeStreamer) Fill(ctx context.Context, from time.Time) ([]*graphx.Series, error) {
+	return nil, nil
+}
+
+func (f *fakeStreamer) Recv() (*graphx.Metric, error) {
+	select {
+	case m := <-f.mChan:
+		return m, nil
+	default:
+	}
+	if f.end != "" {
+		return nil, &graphx.EndOfStream{Reason: f.end}
+	}
+	select {
+	case <-f.ctx.Done():
+		return nil, &graphx.EndOfStream{Reason: graphx.EndCancelled, Err: f.ctx.Err()}
+	}
+}
+
+func (f *fakeStreamer) Close() error {
+	return nil
+}
+
+type fakeStreamerFactory struct {
+	metrics []*graphx.Metric
+	end     graphx.EndReason
+}
+
+func (f *fakeStreamerFactory) NewStreamer(ctx context.Context, id string, charts []*graphx.Chart, cd graphx.ChartsDescriptor) graphx.Streamer {
+	mChan := make(chan *graphx.Metric, len(f.metrics))
+	for _, m := range f.metrics {
+		mChan <- m
+	}
+	return &fakeStreamer{ctx: ctx, mChan: mChan, end: f.end}
+}
+
+func setupClient(t *testing.T, sf graphx.StreamerFactory) (GraphxClient, func()) {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	RegisterGraphxServer(s, NewServer(validator.New(), inmem.NewChartStore(), sf))
+	go s.Serve(lis)
+
+	dialer := func(string, time.Duration) (net.Conn, error) {
+		return lis.Dial()
+	}
+	cc, err := grpc.Dial("bufnet", grpc.WithDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+
+	return NewGraphxClient(cc), func() {
+		cc.Close()
+		s.Stop()
+	}
+}
+
+func TestChartManagement(t *testing.T) {
+	client, teardown := setupClient(t, &fakeStreamerFactory{})
+	defer teardown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chart := &Chart{
+		Name:        "cpu",
+		Aggregation: &Aggregation{Op: "top_k", K: 10, Other: "other"},
+		Metrics: []*ChartMetric{
+			{
+				Name: "usage", Chart: "cpu", Query: "container_cpu_usage", Datasource: "prometheus",
+				Transforms: []*Transform{{Type: "clamp", Max: &wrappers.DoubleValue{Value: 100}}},
+				Alerts:     []*AlertRule{{Name: "busy", Condition: "above", Threshold: 90, ForMs: 60000}},
+			},
+		},
+	}
+	_, err := client.StoreCharts(ctx, &StoreChartsRequest{Charts: []*Chart{chart}})
+	if err != nil {
+		t.Fatalf("failed to store charts: %v", err)
+	}
+
+	resp, err := client.GetCharts(ctx, &GetChartsRequest{ChartNames: []string{"cpu"}})
+	if err != nil {
+		t.Fatalf("failed to get charts: %v", err)
+	}
+	if len(resp.Charts) != 1 || resp.Charts[0].Name != "cpu" || len(resp.Charts[0].Metrics) != 1 {
+		t.Fatalf("unexpected charts returned: %v", resp.Charts)
+	}
+	if resp.Charts[0].Metrics[0].Query != "container_cpu_usage" {
+		t.Fatalf("expected query container_cpu_usage got: %v", resp.Charts[0].Metrics[0].Query)
+	}
+	transforms := resp.Charts[0].Metrics[0].Transforms
+	if len(transforms) != 1 || transforms[0].Max == nil || transforms[0].Max.Value != 100 || transforms[0].Min != nil {
+		t.Fatalf("expected a clamp transform with only a max got: %v", transforms)
+	}
+	if alerts := resp.Charts[0].Metrics[0].Alerts; len(alerts) != 1 || alerts[0].Name != "busy" || alerts[0].ForMs != 60000 {
+		t.Fatalf("expected the busy alert rule got: %v", alerts)
+	}
+	if ag := resp.Charts[0].Aggregation; ag == nil || ag.Op != "top_k" || ag.K != 10 || ag.Other != "other" {
+		t.Fatalf("expected a top_k aggregation got: %v", ag)
+	}
+
+	_, err = client.RemoveCharts(ctx, &RemoveChartsRequest{ChartNames: []string{"cpu"}})
+	if err != nil {
+		t.Fatalf("failed to remove charts: %v", err)
+	}
+
+	_, err = client.GetCharts(ctx, &GetChartsRequest{ChartNames: []string{"cpu"}})
+	if err == nil {
+		t.Fatalf("expected error retrieving removed chart")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	metrics := []*graphx.Metric{
+		{Name: "web_1", Chart: "usage", TimeStamp: 1548785535, Value: "1"},
+		{Name: "web_2", Chart: "usage", TimeStamp: 1548785535, Value: "2"},
+	}
+	client, teardown := setupClient(t, &fakeStreamerFactory{metrics: metrics})
+	defer teardown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.StoreCharts(ctx, &StoreChartsRequest{Charts: []*Chart{{Name: "cpu"}}})
+	if err != nil {
+		t.Fatalf("failed to store charts: %v", err)
+	}
+
+	// invalid descriptors are rejected before streaming
+	stream, err := client.Subscribe(ctx, &SubscribeRequest{ChartNames: []string{"cpu"}, Names: []string{"web_1"}, PollIntervalMs: 10})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Fatalf("expected error for sub second poll interval")
+	}
+
+	stream, err = client.Subscribe(ctx, &SubscribeRequest{ChartNames: []string{"cpu"}, Names: []string{"web_1", "web_2"}, PollIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	batch, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("failed to receive batch: %v", err)
+	}
+	if len(batch.Metrics) != len(metrics) {
+		t.Fatalf("expected a batch of %d metrics got: %v", len(metrics), batch.Metrics)
+	}
+	for i, m := range batch.Metrics {
+		if m.Name != metrics[i].Name || m.ChartName != metrics[i].Chart || m.TimeStamp != metrics[i].TimeStamp || m.Value != metrics[i].Value {
+			t.Fatalf("expected metric %v got: %v", metrics[i], m)
+		}
+	}
+}
+
+func TestSubscribeEnds(t *testing.T) {
+	metrics := []*graphx.Metric{{Name: "web_1", Chart: "usage", TimeStamp: 1548785535, Value: "1"}}
+	client, teardown := setupClient(t, &fakeStreamerFactory{metrics: metrics, end: graphx.EndFinished})
+	defer teardown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.StoreCharts(ctx, &StoreChartsRequest{Charts: []*Chart{{Name: "cpu"}}})
+	if err != nil {
+		t.Fatalf("failed to store charts: %v", err)
+	}
+	stream, err := client.Subscribe(ctx, &SubscribeRequest{ChartNames: []string{"cpu"}, Names: []string{"web_1"}, PollIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	// metrics streamed before the end are delivered
+	batch, err := stream.Recv()
+	if err != nil || len(batch.Metrics) != 1 {
+		t.Fatalf("expected the streamed metric got: %v %v", batch, err)
+	}
+	_, err = stream.Recv()
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.FailedPrecondition || !strings.Contains(st.Message(), string(graphx.EndFinished)) {
+		t.Fatalf("expected the end reason as the status got: %v", err)
+	}
+}
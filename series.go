@@ -0,0 +1,112 @@
+package graphx
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cloudscaleorg/graphx/internal/gorilla"
+)
+
+// Encoding determines how historical metrics are represented when delivered to a client.
+type Encoding string
+
+const (
+	// EncodingRows delivers each historical point as an individual Metric, identical to live metrics.
+	// this is the default when a client does not negotiate an encoding.
+	EncodingRows Encoding = "rows"
+	// EncodingColumnar delivers a Series with the name and chart once followed by
+	// arrays of timestamps and values.
+	EncodingColumnar Encoding = "columnar"
+	// EncodingGorilla delivers a Series whose timestamps and values are delta-of-delta and
+	// XOR compressed into Data.
+	EncodingGorilla Encoding = "gorilla"
+)
+
+// Series is a columnar representation of the Metrics sharing a name and chart.
+type Series struct {
+	// Name is the name this series is for
+	Name string `json:"name"`
+	// Chart is the chart this series should be routed for for the given name
+	Chart string `json:"chart_name"`
+	// timestamps in Unix format, in ascending order
+	TimeStamps []int64 `json:"time_stamps,omitempty"`
+	// the values to plot on the graph, index aligned with TimeStamps
+	Values []string `json:"values,omitempty"`
+	// TimeStamps and Values compressed with the gorilla encoding. base64 encoded on the wire.
+	Data []byte `json:"data,omitempty"`
+}
+
+// Backfill is delivered to a client ahead of live metrics when its ChartsDescriptor requests
+// a fill with a columnar encoding.
+type Backfill struct {
+	Encoding Encoding `json:"encoding"`
+	// the latest timestamp in Unix format contained in any of the series
+	End    int64     `json:"end"`
+	Series []*Series `json:"series"`
+}
+
+// Append adds a point to the series.
+func (s *Series) Append(ts int64, value string) {
+	s.TimeStamps = append(s.TimeStamps, ts)
+	s.Values = append(s.Values, value)
+}
+
+// Metrics expands the series into individual Metrics.
+func (s *Series) Metrics() []*Metric {
+	a := make([]*Metric, 0, len(s.TimeStamps))
+	for i := range s.TimeStamps {
+		a = append(a, &Metric{
+			Name:      s.Name,
+			Chart:     s.Chart,
+			TimeStamp: s.TimeStamps[i],
+			Value:     s.Values[i],
+		})
+	}
+	return a
+}
+
+// Compress moves TimeStamps and Values into Data using the gorilla encoding.
+func (s *Series) Compress() error {
+	e := gorilla.NewEncoder()
+	for i := range s.TimeStamps {
+		f, err := strconv.ParseFloat(s.Values[i], 64)
+		if err != nil {
+			return fmt.Errorf("series %s.%s: failed to parse value %q: %v", s.Chart, s.Name, s.Values[i], err)
+		}
+		e.Push(s.TimeStamps[i], f)
+	}
+
+	s.Data = e.Bytes()
+	s.TimeStamps = nil
+	s.Values = nil
+	return nil
+}
+
+// NewBackfill creates a Backfill of the provided series in the requested encoding.
+// EncodingRows is not representable as a Backfill, use Series.Metrics instead.
+func NewBackfill(enc Encoding, series []*Series) (*Backfill, error) {
+	var end int64
+	for _, s := range series {
+		if n := len(s.TimeStamps); n > 0 && s.TimeStamps[n-1] > end {
+			end = s.TimeStamps[n-1]
+		}
+	}
+
+	switch enc {
+	case EncodingColumnar:
+	case EncodingGorilla:
+		for _, s := range series {
+			if err := s.Compress(); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("encoding %q cannot be represented as a backfill", enc)
+	}
+
+	return &Backfill{
+		Encoding: enc,
+		End:      end,
+		Series:   series,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package graphx
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLinger is how long a session outlives its websocket waiting to be resumed
+	DefaultLinger = 30 * time.Second
+	// DefaultReplaySize is the number of messages retained for replay per session
+	DefaultReplaySize = 4096
+	// WriteTimeout bounds each write to a session's connection
+	WriteTimeout = 10 * time.Second
+)
+
+// Sessions tracks websocket sessions so a client whose connection drops may resume
+// its session, and the subscriptions within it, on a new connection.
+type Sessions struct {
+	mu sync.Mutex
+	m  map[string]*wsSession
+	// how long a detached session keeps streaming into its replay buffer before it is closed
+	linger time.Duration
+	// the number of messages retained for replay per session
+	replaySize int
+	// bounds each write to a session's connection
+	writeTimeout time.Duration
+}
+
+// NewSessions is a constructor for a session registry. a replay size of zero disables replay,
+// every resumed session is then backfilled.
+func NewSessions(linger time.Duration, replaySize int) (*Sessions, error) {
+	if linger < 0 {
+		return nil, errors.New("session linger is negative")
+	}
+	if replaySize < 0 {
+		return nil, errors.New("session replay size is negative")
+	}
+	return &Sessions{
+		m:            make(map[string]*wsSession),
+		linger:       linger,
+		replaySize:   replaySize,
+		writeTimeout: WriteTimeout,
+	}, nil
+}
+
+func (ss *Sessions) add(s *wsSession) {
+	ss.mu.Lock()
+	ss.m[s.id] = s
+	ss.mu.Unlock()
+}
+
+func (ss *Sessions) get(id string) *wsSession {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.m[id]
+}
+
+func (ss *Sessions) remove(id string) {
+	ss.mu.Lock()
+	delete(ss.m, id)
+	ss.mu.Unlock()
+}
@@ -0,0 +1,282 @@
+package graphx
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ldelossa/jsonerr"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	SSEStreamErrCode = "graphx.sse_handler"
+	// LastEventIDHeader is set by EventSource clients when reconnecting
+	LastEventIDHeader = "Last-Event-ID"
+)
+
+// SSEHandler streams metrics as Server-Sent Events for clients which cannot hold a websocket open.
+// the ChartsDescriptor is provided either as query parameters on a GET or as a JSON body on a POST.
+//
+// the stream is a session holding a single subscription. each event's id is the session and the
+// sequence number of the event, when a client reconnects with a Last-Event-ID the session is resumed
+// like a websocket session, replaying missed events or else backfilling from the latest metric.
+func SSEHandler(v *validator.Validate, cs ChartStore, sf StreamerFactory, sessions *Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var cd ChartsDescriptor
+		switch r.Method {
+		case http.MethodGet:
+			var err error
+			cd, err = descriptorFromQuery(r.URL.Query())
+			if err != nil {
+				log.Printf("failed to parse chart descriptor from query parameters: %v", err)
+				resp := jsonerr.NewResponse("", SSEStreamErrCode, err.Error())
+				jsonerr.Error(w, resp, http.StatusBadRequest)
+				return
+			}
+		case http.MethodPost:
+			err := json.NewDecoder(r.Body).Decode(&cd)
+			if err != nil {
+				log.Printf("failed to decode chart descriptor: %v", err)
+				resp := jsonerr.NewResponse("", SSEStreamErrCode, "failed to decode charts descriptor")
+				jsonerr.Error(w, resp, http.StatusBadRequest)
+				return
+			}
+		default:
+			log.Printf("methd not allowed")
+			resp := jsonerr.NewResponse("", SSEStreamErrCode, "method not allowed")
+			jsonerr.Error(w, resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			log.Printf("response writer does not support flushing")
+			resp := jsonerr.NewResponse("", SSEStreamErrCode, "streaming not supported")
+			jsonerr.Error(w, resp, http.StatusInternalServerError)
+			return
+		}
+		conn := &sseConn{w: w, f: flusher, done: make(chan struct{})}
+
+		// resume the session of the last event the client received
+		var session *wsSession
+		if lastID := r.Header.Get(LastEventIDHeader); lastID != "" {
+			id, seq, err := parseEventID(lastID)
+			if err != nil {
+				log.Printf("received malformed %s: %v", LastEventIDHeader, lastID)
+				resp := jsonerr.NewResponse("", SSEStreamErrCode, "malformed "+LastEventIDHeader)
+				jsonerr.Error(w, resp, http.StatusBadRequest)
+				return
+			}
+			conn.session = id
+			if session = sessions.get(id); session == nil || !session.resume(conn, seq) {
+				log.Printf("id %s: session to resume does not exist. opening a new session", id)
+				session = nil
+			}
+		}
+
+		if session == nil {
+			// the descriptor is rejected before the response is committed so the client is told with a status
+			charts, err := resolve(r.Context(), v, cs, cd)
+			if err != nil {
+				log.Printf("failed to open stream: %v", err)
+				resp := jsonerr.NewResponse("", SSEStreamErrCode, err.Error())
+				jsonerr.Error(w, resp, errorStatus(err))
+				return
+			}
+			session = newWSSession(uuid.New().String(), v, cs, sf, sessions)
+			conn.session = session.id
+			session.attach(conn)
+			log.Printf("id %s: opened event stream session", session.id)
+			session.subscribeCharts("", cd, charts)
+		}
+
+		select {
+		case <-r.Context().Done():
+		case <-conn.done:
+		}
+		session.detach(conn)
+	}
+}
+
+// parseEventID parses an event id into the session and sequence number it identifies
+func parseEventID(s string) (string, uint64, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("event id %q does not name a session", s)
+	}
+	seq, err := strconv.ParseUint(s[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return s[:i], seq, nil
+}
+
+// descriptorFromQuery builds a ChartsDescriptor from query parameters. list parameters
+// may be repeated or comma separated.
+func descriptorFromQuery(q url.Values) (ChartsDescriptor, error) {
+	cd := ChartsDescriptor{
+		ChartNames: splitParam(q["chart_names"]),
+		Names:      splitParam(q["names"]),
+		Encoding:   Encoding(q.Get("encoding")),
+		Downsample: Downsample(q.Get("downsample")),
+	}
+
+	if s := q.Get("poll_interval"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return cd, fmt.Errorf("failed to parse poll_interval: %v", err)
+		}
+		cd.PollInterval = Duration(d)
+	}
+
+	if s := q.Get("max_poll_interval"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return cd, fmt.Errorf("failed to parse max_poll_interval: %v", err)
+		}
+		cd.MaxPollInterval = Duration(d)
+	}
+
+	if s := q.Get("keepalive"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return cd, fmt.Errorf("failed to parse keepalive: %v", err)
+		}
+		cd.Keepalive = Duration(d)
+	}
+
+	if s := q.Get("series_grace"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return cd, fmt.Errorf("failed to parse series_grace: %v", err)
+		}
+		cd.SeriesGrace = Duration(d)
+	}
+
+	if s := q.Get("fill"); s != "" {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return cd, fmt.Errorf("failed to parse fill: %v", err)
+		}
+		cd.Fill = TimeStamp(ts)
+	}
+
+	if s := q.Get("max_points"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return cd, fmt.Errorf("failed to parse max_points: %v", err)
+		}
+		cd.MaxPoints = n
+	}
+
+	return cd, nil
+}
+
+func splitParam(values []string) []string {
+	a := []string{}
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s != "" {
+				a = append(a, s)
+			}
+		}
+	}
+	return a
+}
+
+// sseConn delivers a session's messages to an event stream. the response is committed as an
+// event stream by the first message. done is closed once the stream has ended or the session
+// moved to another connection
+type sseConn struct {
+	w       http.ResponseWriter
+	f       http.Flusher
+	session string
+	opened  sync.Once
+	done    chan struct{}
+	once    sync.Once
+}
+
+// open commits the response as an event stream
+func (c *sseConn) open() {
+	c.w.Header().Set("Content-Type", "text/event-stream")
+	c.w.Header().Set("Cache-Control", "no-cache")
+	c.w.Header().Set("Connection", "keep-alive")
+	// disable response buffering in nginx style proxies
+	c.w.Header().Set("X-Accel-Buffering", "no")
+	c.w.WriteHeader(http.StatusOK)
+	c.f.Flush()
+}
+
+func (c *sseConn) WriteJSON(v interface{}) error {
+	msg, ok := v.(*Message)
+	if !ok {
+		return fmt.Errorf("unexpected event %T", v)
+	}
+	event, data := sseEvent(msg)
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	c.opened.Do(c.open)
+
+	// the unsequenced session message does not move the client's position
+	if msg.Seq != 0 {
+		_, err = fmt.Fprintf(c.w, "id: %s:%d\n", c.session, msg.Seq)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(c.w, "event: %s\ndata: %s\n\n", event, b)
+	if err != nil {
+		return err
+	}
+	c.f.Flush()
+
+	if msg.Type == MessageEnd {
+		c.Close()
+	}
+	return nil
+}
+
+func (c *sseConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+// sseEvent returns the event name and data a message is delivered as
+func sseEvent(msg *Message) (string, interface{}) {
+	switch msg.Type {
+	case MessageSession:
+		return "session", msg.Session
+	case MessageMetric:
+		return "metric", msg.Metric
+	case MessageBackfill:
+		return "backfill", msg.Backfill
+	case MessageDropped:
+		return "dropped", map[string]uint64{"dropped": msg.Dropped}
+	case MessageError:
+		if msg.QueryError != nil {
+			return "query_error", msg.QueryError
+		}
+		return "error", map[string]string{"error": msg.Error}
+	case MessageAck:
+		return "ack", msg.Ack
+	case MessageEnd:
+		return "end", msg.End
+	case MessageIntervals:
+		return "intervals", msg.Intervals
+	case MessageSeries:
+		return "series", msg.Series
+	case MessageAlert:
+		return "alert", msg.Alert
+	}
+	return string(msg.Type), msg
+}
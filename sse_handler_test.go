@@ -0,0 +1,224 @@
+package graphx
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+var SSEHandlerStatusTT = []struct {
+	name        string
+	method      string
+	query       string
+	lastEventID string
+	cs          ChartStore
+	status      int
+}{
+	{
+		name:   "method",
+		method: http.MethodPut,
+		query:  "chart_names=cpu&names=web_1&poll_interval=1s",
+		cs:     fakeChartStore{},
+		status: http.StatusMethodNotAllowed,
+	},
+	{
+		name:   "malformed descriptor",
+		method: http.MethodGet,
+		query:  "chart_names=cpu&names=web_1&poll_interval=soon",
+		cs:     fakeChartStore{},
+		status: http.StatusBadRequest,
+	},
+	{
+		name:   "invalid descriptor",
+		method: http.MethodGet,
+		query:  "chart_names=cpu&names=web_1&poll_interval=100ms",
+		cs:     fakeChartStore{},
+		status: http.StatusBadRequest,
+	},
+	{
+		name:        "malformed last event id",
+		method:      http.MethodGet,
+		query:       "chart_names=cpu&names=web_1&poll_interval=1s",
+		lastEventID: "1571443200",
+		cs:          fakeChartStore{},
+		status:      http.StatusBadRequest,
+	},
+	{
+		name:   "chart store failure",
+		method: http.MethodGet,
+		query:  "chart_names=cpu&names=web_1&poll_interval=1s",
+		cs:     fakeChartStore{err: errors.New("unavailable")},
+		status: http.StatusInternalServerError,
+	},
+}
+
+func TestSSEHandlerStatus(t *testing.T) {
+	sessions, err := NewSessions(time.Minute, 0)
+	if err != nil {
+		t.Fatalf("failed to create sessions: %v", err)
+	}
+	for _, tt := range SSEHandlerStatusTT {
+		t.Run(tt.name, func(t *testing.T) {
+			h := SSEHandler(validator.New(), tt.cs, &fakeStreamerFactory{}, sessions)
+			r := httptest.NewRequest(tt.method, "/?"+tt.query, nil)
+			if tt.lastEventID != "" {
+				r.Header.Set(LastEventIDHeader, tt.lastEventID)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d got %d: %s", tt.status, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+// testEvent is a single event read from an event stream
+type testEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvents delivers the events of an event stream until it ends
+func readEvents(body io.Reader) <-chan testEvent {
+	c := make(chan testEvent)
+	go func() {
+		defer close(c)
+		var e testEvent
+		sc := bufio.NewScanner(body)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				c <- e
+				e = testEvent{}
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return c
+}
+
+func nextEvent(t *testing.T, events <-chan testEvent, event string) testEvent {
+	select {
+	case e := <-events:
+		if e.event != event {
+			t.Fatalf("expected %s event got %+v", event, e)
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("expected %s event", event)
+	}
+	return testEvent{}
+}
+
+func metricEvent(t *testing.T, events <-chan testEvent, ts int64) testEvent {
+	e := nextEvent(t, events, "metric")
+	var m Metric
+	if err := json.Unmarshal([]byte(e.data), &m); err != nil {
+		t.Fatalf("failed to decode metric %s: %v", e.data, err)
+	}
+	if m.TimeStamp != ts {
+		t.Fatalf("expected metric at %d got %+v", ts, m)
+	}
+	return e
+}
+
+func TestSSEHandlerResume(t *testing.T) {
+	st := &fakeStreamer{metrics: make(chan *Metric)}
+	sessions, err := NewSessions(time.Minute, 16)
+	if err != nil {
+		t.Fatalf("failed to create sessions: %v", err)
+	}
+	srv := httptest.NewServer(SSEHandler(validator.New(), fakeChartStore{}, &fakeStreamerFactory{st: st}, sessions))
+	defer srv.Close()
+	url := srv.URL + "?chart_names=cpu&names=web_1&poll_interval=1s"
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	events := readEvents(resp.Body)
+	var session Session
+	if err := json.Unmarshal([]byte(nextEvent(t, events, "session").data), &session); err != nil {
+		t.Fatalf("failed to decode session: %v", err)
+	}
+	nextEvent(t, events, "ack")
+	st.metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: 100, Value: "1"}
+	last := metricEvent(t, events, 100)
+	if last.id != session.ID+":2" {
+		t.Fatalf("expected the event id to be the session sequence got %s", last.id)
+	}
+
+	// the metric streamed while disconnected is replayed
+	resp.Body.Close()
+	s := sessions.get(session.ID)
+	waitSession(t, s, func(s *wsSession) bool { return s.conn == nil })
+	st.metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: 100, Value: "2"}
+	waitSession(t, s, func(s *wsSession) bool { return s.seq == 3 })
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set(LastEventIDHeader, last.id)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to resume event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	events = readEvents(resp.Body)
+	if err := json.Unmarshal([]byte(nextEvent(t, events, "session").data), &session); err != nil {
+		t.Fatalf("failed to decode session: %v", err)
+	}
+	if !session.Resumed || !session.Replayed {
+		t.Fatalf("expected a replayed session got %+v", session)
+	}
+	if e := metricEvent(t, events, 100); e.id != session.ID+":3" {
+		t.Fatalf("expected the replayed event to keep its id got %s", e.id)
+	}
+	st.metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: 101, Value: "2"}
+	if e := metricEvent(t, events, 101); e.id != session.ID+":4" {
+		t.Fatalf("expected the live event to follow the replay got %s", e.id)
+	}
+}
+
+func TestSSEHandlerResolvesOnce(t *testing.T) {
+	sessions, err := NewSessions(time.Minute, 0)
+	if err != nil {
+		t.Fatalf("failed to create sessions: %v", err)
+	}
+	var lookups int32
+	cs := fakeChartStore{lookups: &lookups}
+	srv := httptest.NewServer(SSEHandler(validator.New(), cs, &fakeStreamerFactory{}, sessions))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?chart_names=cpu&names=web_1&poll_interval=1s")
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	events := readEvents(resp.Body)
+	nextEvent(t, events, "session")
+	nextEvent(t, events, "ack")
+
+	// the charts resolved to pick the response status are the charts subscribed to
+	if n := atomic.LoadInt32(&lookups); n != 1 {
+		t.Fatalf("expected the charts to be retrieved once got %d", n)
+	}
+}
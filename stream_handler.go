@@ -2,9 +2,11 @@ package graphx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"reflect"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,7 +20,9 @@ const (
 	MetricsStreamErrCode = "graphx.stream_handler"
 )
 
-func StreamHandler(v *validator.Validate, cs ChartStore, sf StreamerFactory, ws websocket.Upgrader) http.HandlerFunc {
+// StreamHandler streams metrics over a websocket. clients multiplex subscriptions on the
+// connection with Control messages and may resume their session after the connection drops.
+func StreamHandler(v *validator.Validate, cs ChartStore, sf StreamerFactory, ws websocket.Upgrader, sessions *Sessions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// only support posts
 		if r.Method != http.MethodGet {
@@ -28,91 +32,260 @@ func StreamHandler(v *validator.Validate, cs ChartStore, sf StreamerFactory, ws
 			return
 		}
 
-		// create context for this streaming session
-		ctx := context.Background()
-		ctx, cancel := context.WithCancel(ctx)
-		defer cancel()
-
 		// upgrade to web socket
 		wsConn, err := ws.Upgrade(w, r, nil)
-		defer wsConn.Close()
-
 		if err != nil {
 			log.Printf("failed to upgrade to websocket: %v", err)
 			resp := jsonerr.NewResponse("", MetricsStreamErrCode, "failed to upgrade to websocket")
 			jsonerr.Error(w, resp, http.StatusBadRequest)
 			return
 		}
+		defer wsConn.Close()
 		log.Printf("successfully upgraded to websocket")
 
-		// TODO: handle timeouts
-		// set initial deadline see: https://github.com/golang/go/blob/master/src/net/net.go#L149
-
-		// wait for charts descriptor
-		var cd ChartsDescriptor
+		// read control messages until the client goes away. the session then lingers
+		// waiting to be resumed before its subscriptions are stopped.
+		var session *wsSession
 		for {
-			err := wsConn.ReadJSON(&cd)
+			_, b, err := wsConn.ReadMessage()
 			if err != nil {
-				log.Printf("received error waiting for chart descriptor: %v", err)
+				log.Printf("received error reading from websocket. detaching session: %v", err)
+				if session != nil {
+					session.detach(wsConn)
+				}
 				return
 			}
-			break
+
+			subscribed := func(string) bool { return false }
+			if session != nil {
+				subscribed = session.subscribed
+			}
+			c, err := ParseControl(b, subscribed)
+			if err != nil {
+				log.Printf("received malformed control message: %v", err)
+				if session == nil {
+					wsConn.WriteJSON(&Message{Type: MessageError, Error: err.Error()})
+					continue
+				}
+				session.writeError("", err)
+				continue
+			}
+
+			if session == nil {
+				session = open(wsConn, c, v, cs, sf, sessions)
+				if c.Op == OpResume {
+					continue
+				}
+			}
+			session.handle(c)
 		}
-		id := fmt.Sprintf("%s.%v", uuid.New().String(), cd.Names)
-		log.Printf("id: %v received chart descriptor: %v", id, cd)
+	}
+}
 
-		// validate struct
-		err = v.StructCtx(ctx, cd)
-		if err != nil {
-			log.Printf("id %s: struct validation error: %v", id, err)
-			return
+// open attaches a websocket to the session named by a resume or to a new session.
+func open(wsConn *websocket.Conn, c *Control, v *validator.Validate, cs ChartStore, sf StreamerFactory, sessions *Sessions) *wsSession {
+	if c.Op == OpResume {
+		if session := sessions.get(c.Session); session != nil && session.resume(wsConn, c.LastSeq) {
+			return session
 		}
+		log.Printf("id %s: session to resume does not exist", c.Session)
+	}
 
-		// do not allow polls of lower then a second
-		if time.Duration(cd.PollInterval) < 1*time.Second {
-			log.Printf("id %s: requested poll interval of less then 1 second", id)
-			return
+	session := newWSSession(uuid.New().String(), v, cs, sf, sessions)
+	session.attach(wsConn)
+	log.Printf("id %s: opened session", session.id)
+	if c.Op == OpResume {
+		session.writeError("", fmt.Errorf("session %s expired. subscriptions must be recreated", c.Session))
+	}
+	return session
+}
+
+// OpenStream validates a charts descriptor, retrieves the charts it names and creates
+// a streamer for them. this is the pipeline shared by every transport.
+func OpenStream(ctx context.Context, v *validator.Validate, cs ChartStore, sf StreamerFactory, id string, cd ChartsDescriptor) (Streamer, error) {
+	charts, err := resolve(ctx, v, cs, cd)
+	if err != nil {
+		return nil, err
+	}
+
+	// create streamer from our streamer factory
+	return sf.NewStreamer(ctx, id, charts, cd), nil
+}
+
+// resolve validates a charts descriptor and retrieves the charts it names from the chart store.
+func resolve(ctx context.Context, v *validator.Validate, cs ChartStore, cd ChartsDescriptor) ([]*Chart, error) {
+	// validate struct
+	err := v.StructCtx(ctx, cd)
+	if err != nil {
+		return nil, fmt.Errorf("struct validation error: %v", err)
+	}
+
+	// do not allow polls of lower then a second
+	if time.Duration(cd.PollInterval) < 1*time.Second {
+		return nil, errors.New("requested poll interval of less then 1 second")
+	}
+	if cd.MaxPollInterval != 0 && cd.MaxPollInterval < cd.PollInterval {
+		return nil, errors.New("requested max poll interval is less then the poll interval")
+	}
+	if cd.Keepalive < 0 {
+		return nil, errors.New("requested keepalive is negative")
+	}
+	if cd.SeriesGrace < 0 {
+		return nil, errors.New("requested series grace period is negative")
+	}
+
+	return getCharts(cs, cd.ChartNames)
+}
+
+// getCharts retrieves the named charts from the chart store, every name must exist.
+func getCharts(cs ChartStore, names []string) ([]*Chart, error) {
+	// receive configured charts from chart store
+	charts, err := cs.GetByNames(names)
+	if err != nil {
+		return nil, &ChartStoreError{Err: err}
+	}
+	for i, chart := range charts {
+		if chart == nil {
+			return nil, fmt.Errorf("chart %s does not exist", names[i])
 		}
+	}
+
+	return charts, nil
+}
+
+// streamWriter is implemented by each transport capable of delivering a stream to a client.
+type streamWriter interface {
+	WriteMetric(m *Metric) error
+	WriteBackfill(bf *Backfill) error
+	// WriteDropped reports the total number of metrics the stream has discarded
+	WriteDropped(total uint64) error
+	// WriteQueryError reports a failed query of a chart metric
+	WriteQueryError(qe *QueryError) error
+	// WriteEnd reports a stream which ended while the client is still connected
+	WriteEnd(eos *EndOfStream) error
+	// WriteIntervals reports the interval each chart of an adaptive stream is polled at
+	WriteIntervals(intervals map[string]Duration) error
+	// WriteSeries reports a series which was added to or removed from query results
+	WriteSeries(se *SeriesEvent) error
+	// WriteAlert reports an alert of a streamed chart which fired or resolved
+	WriteAlert(a *Alert) error
+}
 
-		// receive configured charts from chart store
-		charts, err := cs.GetByNames(cd.ChartNames)
+// fill retrieves historical metrics from the streamer and writes them to the client
+// in the encoding negotiated by the charts descriptor.
+func fill(ctx context.Context, sw streamWriter, st Streamer, cd ChartsDescriptor) error {
+	series, err := st.Fill(ctx, time.Time(cd.Fill))
+	if err != nil {
+		return err
+	}
+
+	switch cd.Encoding {
+	case "", EncodingRows:
+		for _, s := range series {
+			for _, m := range s.Metrics() {
+				if err := sw.WriteMetric(m); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		bf, err := NewBackfill(cd.Encoding, series)
 		if err != nil {
-			log.Printf("id %s: failed to query chart store: %v", err)
-			return
+			return err
 		}
+		return sw.WriteBackfill(bf)
+	}
+}
+
+// stream writes live metrics from the streamer to the client until the stream ends or a
+// write fails. the returned error is an *EndOfStream describing why the stream ended or
+// the error writing to the client.
+func stream(ctx context.Context, id string, sw streamWriter, st Streamer) error {
+	lossy, _ := st.(Lossy)
+	var dropped uint64
+	adaptive, _ := st.(Adaptive)
+	var changes uint64
+	var intervals map[string]Duration
 
-		// create streamer from our streamer factory
-		_ = sf.NewStreamer(ctx, id, charts, time.Duration(cd.PollInterval))
+	log.Printf("id %s: beginning to stream metrics to client", id)
+	for {
+		// retrieve message from metric stream and handle errors
+		m, err := st.Recv()
 		if err != nil {
-			log.Printf("id %s: failed to instantiate query streamer: %v", id, err)
-			return
+			eos, ok := err.(*EndOfStream)
+			if !ok && ctx.Err() != nil {
+				eos = &EndOfStream{Reason: EndCancelled, Err: ctx.Err()}
+			}
+			if eos != nil {
+				log.Printf("id %s: %v", id, eos)
+				// a cancelled stream has no client left to tell
+				if eos.Reason != EndCancelled {
+					sw.WriteEnd(eos)
+				}
+				return eos
+			}
+
+			if se, ok := err.(*SeriesEvent); ok {
+				err = sw.WriteSeries(se)
+				if err != nil {
+					log.Printf("id %s: received error writing to client. ending stream: %v", id, err)
+					return err
+				}
+				continue
+			}
+			if a, ok := err.(*Alert); ok {
+				err = sw.WriteAlert(a)
+				if err != nil {
+					log.Printf("id %s: received error writing to client. ending stream: %v", id, err)
+					return err
+				}
+				continue
+			}
+
+			log.Printf("id %s: received error from stream: %v", id, err)
+			if qe, ok := err.(*QueryError); ok {
+				err = sw.WriteQueryError(qe)
+				if err != nil {
+					log.Printf("id %s: received error writing to client. ending stream: %v", id, err)
+					return err
+				}
+			}
+			continue
 		}
 
-		// // begin streaming metrics to websocket
-		// log.Printf("id %s: beginning to stream metrics to client", id)
-		// for {
-		// 	// retrieve message from metric stream and handle errors
-		// 	m, err := st.Recv(ctx)
-		// 	if err != nil {
-		// 		// check if we've reached end of stream. i.e. query streamer receives no metrics from prometheus
-		// 		if _, ok := err.(*EndOfStream); ok {
-		// 			log.Printf("received end of stream from query streamer. returing")
-		// 			// all defers will run
-		// 			return
-		// 		}
-		// 		// else log the error
-		// 		log.Printf("id %s: received error from stream: %v", id, err)
-		// 		continue
-		// 	}
-		// 	log.Printf("id %s: streaming metric to client: %v", id, m)
-
-		// 	// write metric to websocket
-		// 	err = wsConn.WriteJSON(m)
-		// 	if err != nil {
-		// 		log.Printf("id %s: received error writing to websocket. returning from stream_handler: %v", id, err)
-		// 		return
-		// 	}
-		// }
+		// let the client know its view is lossy before delivering the next metric
+		if lossy != nil {
+			if total := lossy.Dropped(); total > dropped {
+				dropped = total
+				err = sw.WriteDropped(total)
+				if err != nil {
+					log.Printf("id %s: received error writing to client. ending stream: %v", id, err)
+					return err
+				}
+			}
+		}
 
+		// let the client know how often its charts update when polling adapted
+		if adaptive != nil {
+			if c := adaptive.Changes(); c != changes {
+				changes = c
+				if cur := adaptive.Intervals(); !reflect.DeepEqual(cur, intervals) {
+					intervals = cur
+					err = sw.WriteIntervals(cur)
+					if err != nil {
+						log.Printf("id %s: received error writing to client. ending stream: %v", id, err)
+						return err
+					}
+				}
+			}
+		}
+
+		// write metric to client
+		err = sw.WriteMetric(m)
+		if err != nil {
+			log.Printf("id %s: received error writing to client. ending stream: %v", id, err)
+			return err
+		}
 	}
 }
@@ -1,7 +1,110 @@
 package graphx
 
-// Streamer is an interface providing a streaming API to clients
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Streamer is an interface providing a streaming API to clients.
+// a Streamer ends when its context is done, when Close is called or once none of its
+// pollers are left running. Recv then returns an *EndOfStream describing why.
 type Streamer interface {
+	// Fill blocks until historical metrics from the provided time until now are retrieved.
+	Fill(ctx context.Context, from time.Time) ([]*Series, error)
 	// Recv blocks until either a metric or an error is available.
+	// once the streamer has ended and released its pollers Recv returns an *EndOfStream.
+	// a *SeriesEvent reports a series which appeared in or disappeared from query results
+	// and an *Alert an alert of one of the stream's charts which fired or resolved.
 	Recv() (*Metric, error)
+	// Close ends the stream and blocks until its pollers are released.
+	// it is safe to call Close more then once and after the stream has ended.
+	Close() error
+}
+
+// EndReason describes why a Streamer ended
+type EndReason string
+
+const (
+	// EndCancelled is a stream whose context was cancelled
+	EndCancelled EndReason = "cancelled"
+	// EndClosed is a stream ended by a call to Close
+	EndClosed EndReason = "closed"
+	// EndFinished is a stream with no pollers left running. for example every
+	// chart metric failed to subscribe
+	EndFinished EndReason = "finished"
+)
+
+// EndOfStream is returned by Recv once a Streamer has ended. no further metrics
+// will be delivered and every go routine polling for the stream has returned.
+type EndOfStream struct {
+	Reason EndReason `json:"reason"`
+	// the context's error when Reason is EndCancelled
+	Err error `json:"-"`
+}
+
+func (e *EndOfStream) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("end of stream: %s: %v", e.Reason, e.Err)
+	}
+	return fmt.Sprintf("end of stream: %s", e.Reason)
+}
+
+// SeriesState describes the presence of a series in query results
+type SeriesState string
+
+const (
+	// SeriesAdded is a series which started appearing in query results
+	SeriesAdded SeriesState = "added"
+	// SeriesRemoved is a series which has been missing from query results for longer than
+	// the grace period, for example because the container it describes stopped
+	SeriesRemoved SeriesState = "removed"
+)
+
+// SeriesEvent is returned by Recv when a series is added or removed. the metric a series
+// was added with is delivered after its event.
+type SeriesEvent struct {
+	State SeriesState `json:"state"`
+	Name  string      `json:"name"`
+	Chart string      `json:"chart_name"`
+	// the Unix timestamp of the latest sample of the series
+	LastSeen int64 `json:"last_seen,omitempty"`
+}
+
+func (e *SeriesEvent) Error() string {
+	return fmt.Sprintf("series %s of %s %s", e.Name, e.Chart, e.State)
+}
+
+// Updater is implemented by Streamers which can apply a modified ChartsDescriptor
+// in place, without interrupting the series it leaves unchanged.
+type Updater interface {
+	// Update applies the charts and descriptor and reports what changed.
+	Update(charts []*Chart, cd ChartsDescriptor) (*Diff, error)
+}
+
+// Diff describes the changes Update applied to a running Streamer.
+type Diff struct {
+	ChartsAdded   []string `json:"charts_added,omitempty"`
+	ChartsRemoved []string `json:"charts_removed,omitempty"`
+	// charts whose configuration changed in the chart store and were restarted
+	ChartsChanged []string `json:"charts_changed,omitempty"`
+	NamesAdded    []string `json:"names_added,omitempty"`
+	NamesRemoved  []string `json:"names_removed,omitempty"`
+	// set to the new poll interval when it changed
+	PollInterval Duration `json:"poll_interval,omitempty"`
+	// set to the new max poll interval when it changed
+	MaxPollInterval Duration `json:"max_poll_interval,omitempty"`
+	// set to the new keepalive when it changed
+	Keepalive Duration `json:"keepalive,omitempty"`
+	// set to the new series grace period when it changed
+	SeriesGrace Duration `json:"series_grace,omitempty"`
+}
+
+// Adaptive is implemented by Streamers whose poll interval adapts to the data they poll.
+type Adaptive interface {
+	// Changes returns a count which increases whenever an interval may have changed.
+	// it is cheap to call after every metric
+	Changes() uint64
+	// Intervals returns the interval each chart is currently polled at keyed by chart name
+	Intervals() map[string]Duration
 }
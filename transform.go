@@ -0,0 +1,83 @@
+package graphx
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TransformType identifies a Transform
+type TransformType string
+
+const (
+	// TransformScale multiplies values by Value, for example to convert bytes to megabytes
+	TransformScale TransformType = "scale"
+	// TransformOffset adds Value to values
+	TransformOffset TransformType = "offset"
+	// TransformMovingAverage replaces values with the mean of the last Window values
+	TransformMovingAverage TransformType = "moving_average"
+	// TransformEWMA replaces values with their exponentially weighted moving average using Alpha
+	TransformEWMA TransformType = "ewma"
+	// TransformRate replaces the values of a counter with their per second increase. a decrease
+	// is treated as a counter reset. the first point of a series has no rate and is dropped
+	TransformRate TransformType = "rate"
+	// TransformDerivative replaces values with their per second change. the first point of a
+	// series is dropped
+	TransformDerivative TransformType = "derivative"
+	// TransformCumulativeSum replaces values with the sum of every value up to them
+	TransformCumulativeSum TransformType = "cumulative_sum"
+	// TransformClamp limits values to Min and Max
+	TransformClamp TransformType = "clamp"
+	// TransformRound rounds values to Precision decimal places
+	TransformRound TransformType = "round"
+)
+
+// MaxRoundPrecision is the largest precision of TransformRound. a float64 holds no more
+// significant decimal digits
+const MaxRoundPrecision = 15
+
+// Transform is a single step of the transforms a ChartMetric's values are passed through
+// before delivery. transforms are applied in order to every series of the chart metric,
+// live and backfilled points alike.
+type Transform struct {
+	Type TransformType `json:"type"`
+	// the factor of TransformScale and the addend of TransformOffset
+	Value float64 `json:"value,omitempty"`
+	// the number of points averaged by TransformMovingAverage
+	Window int `json:"window,omitempty"`
+	// the smoothing factor of TransformEWMA. closer to 1 follows the latest values more closely
+	Alpha float64 `json:"alpha,omitempty"`
+	// the bounds of TransformClamp. either may be omitted
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// the number of decimal places TransformRound rounds to, at most MaxRoundPrecision
+	Precision int `json:"precision,omitempty"`
+}
+
+// Validate reports whether the transform's parameters suit its type.
+func (t Transform) Validate() error {
+	switch t.Type {
+	case TransformScale, TransformOffset, TransformRate, TransformDerivative, TransformCumulativeSum:
+	case TransformMovingAverage:
+		if t.Window < 1 {
+			return errors.New("moving_average requires a window of at least 1")
+		}
+	case TransformEWMA:
+		if t.Alpha <= 0 || t.Alpha > 1 {
+			return errors.New("ewma requires an alpha greater than 0 and at most 1")
+		}
+	case TransformClamp:
+		if t.Min == nil && t.Max == nil {
+			return errors.New("clamp requires a min or a max")
+		}
+		if t.Min != nil && t.Max != nil && *t.Min > *t.Max {
+			return errors.New("clamp requires min to be at most max")
+		}
+	case TransformRound:
+		if t.Precision < 0 || t.Precision > MaxRoundPrecision {
+			return fmt.Errorf("round requires a precision between 0 and %d", MaxRoundPrecision)
+		}
+	default:
+		return fmt.Errorf("unknown transform %q", t.Type)
+	}
+	return nil
+}
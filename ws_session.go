@@ -0,0 +1,500 @@
+package graphx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// sessionConn delivers a session's messages to a client. implemented by websockets and event streams
+type sessionConn interface {
+	WriteJSON(v interface{}) error
+	Close() error
+}
+
+// deadliner is implemented by connections whose writes can be bounded, such as websockets
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// wsSession multiplexes named subscriptions over a websocket, or an event stream. a session outlives
+// its connection for the registry's linger period so a client may resume it on a new connection.
+type wsSession struct {
+	// an id representing this websocket session
+	id       string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	v        *validator.Validate
+	cs       ChartStore
+	sf       StreamerFactory
+	sessions *Sessions
+	// protects subs. held while a control message is applied
+	smu sync.Mutex
+	// active subscriptions keyed by their client provided id
+	subs map[string]*subscription
+	// serializes writes, websocket connections support a single concurrent writer.
+	// protects the fields below
+	wmu sync.Mutex
+	// the attached connection, nil while detached
+	conn sessionConn
+	// the sequence number of the latest message
+	seq    uint64
+	replay *replayBuffer
+	// closes the session once it has been detached for the linger period
+	expiry *time.Timer
+	// set once the session expired, it can no longer be resumed
+	expired bool
+}
+
+// subscription is a single stream multiplexed on a session
+type subscription struct {
+	st     Streamer
+	cd     ChartsDescriptor
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the latest metric timestamp written to a websocket, used to backfill a resumed session
+	// which missed messages evicted from the replay buffer. accessed atomically
+	last int64
+	// held while live metrics are written and while the subscription is backfilled after a
+	// resume, so backfilled metrics are delivered before the live metrics which follow them
+	live sync.Mutex
+}
+
+func newWSSession(id string, v *validator.Validate, cs ChartStore, sf StreamerFactory, sessions *Sessions) *wsSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &wsSession{
+		id:       id,
+		ctx:      ctx,
+		cancel:   cancel,
+		v:        v,
+		cs:       cs,
+		sf:       sf,
+		sessions: sessions,
+		subs:     make(map[string]*subscription),
+		replay:   newReplayBuffer(sessions.replaySize),
+	}
+	sessions.add(s)
+	return s
+}
+
+// attach delivers the session's messages to conn
+func (s *wsSession) attach(conn sessionConn) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.conn = conn
+	s.writeSession(false, false)
+}
+
+// resume attaches conn to a detached session and redelivers every message after lastSeq.
+// if those messages were evicted from the replay buffer each subscription is instead
+// backfilled from the latest metric it delivered. false when the session expired before
+// conn could be attached.
+func (s *wsSession) resume(conn sessionConn, lastSeq uint64) bool {
+	s.wmu.Lock()
+	if s.expired {
+		s.wmu.Unlock()
+		return false
+	}
+	if s.expiry != nil {
+		s.expiry.Stop()
+		s.expiry = nil
+	}
+	if s.conn != nil {
+		// the previous connection has not noticed it is gone yet
+		s.conn.Close()
+	}
+	s.conn = conn
+
+	msgs, replayed := s.replay.since(lastSeq + 1)
+	if s.writeSession(true, replayed) {
+		for _, msg := range msgs {
+			if err := s.send(msg); err != nil {
+				log.Printf("id %s: failed to replay message to websocket: %v", s.id, err)
+				break
+			}
+		}
+	}
+	s.wmu.Unlock()
+
+	if replayed {
+		log.Printf("id %s: resumed session replaying %d messages", s.id, len(msgs))
+		return true
+	}
+
+	log.Printf("id %s: resumed session beyond replay buffer. backfilling subscriptions", s.id)
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	for name, sub := range s.subs {
+		last := atomic.LoadInt64(&sub.last)
+		if last == 0 {
+			continue
+		}
+		cd := sub.cd
+		cd.Fill = TimeStamp(time.Unix(last+1, 0))
+		// live delivery resumes once the gap is backfilled
+		sub.live.Lock()
+		go func(name string, sub *subscription) {
+			defer sub.live.Unlock()
+			s.fill(name, sub, cd)
+		}(name, sub)
+	}
+	return true
+}
+
+// detach stops delivering messages to conn and closes the session unless it is resumed
+// within the linger period. a connection which was already replaced is ignored.
+func (s *wsSession) detach(conn sessionConn) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if s.conn != conn {
+		return
+	}
+	s.release()
+}
+
+// release detaches the attached connection and starts the linger period. callers must hold wmu.
+func (s *wsSession) release() {
+	s.conn = nil
+	s.expiry = time.AfterFunc(s.sessions.linger, s.expire)
+}
+
+// expire closes a session which is still detached
+func (s *wsSession) expire() {
+	s.wmu.Lock()
+	detached := s.conn == nil
+	// a resume racing the expiry must not attach to the closed session
+	s.expired = detached
+	s.wmu.Unlock()
+	if !detached {
+		return
+	}
+
+	log.Printf("id %s: session was not resumed. closing", s.id)
+	s.sessions.remove(s.id)
+	s.cancel()
+}
+
+// subscribed reports whether a subscription with the provided id is active
+func (s *wsSession) subscribed(sub string) bool {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	_, ok := s.subs[sub]
+	return ok
+}
+
+// handle applies a control message to the session
+func (s *wsSession) handle(c *Control) {
+	log.Printf("id %s: received %s for subscription %q", s.id, c.Op, c.Subscription)
+
+	s.smu.Lock()
+	defer s.smu.Unlock()
+
+	switch c.Op {
+	case OpSubscribe:
+		if _, ok := s.subs[c.Subscription]; ok {
+			s.writeError(c.Subscription, fmt.Errorf("subscription %q already exists", c.Subscription))
+			return
+		}
+		s.subscribe(c.Subscription, *c.Descriptor)
+	case OpModify:
+		sub, ok := s.subs[c.Subscription]
+		if !ok {
+			s.writeError(c.Subscription, fmt.Errorf("subscription %q does not exist", c.Subscription))
+			return
+		}
+		if u, ok := sub.st.(Updater); ok {
+			s.update(c.Subscription, sub, u, *c.Descriptor)
+			return
+		}
+		// the previous stream is only replaced once the new descriptor is accepted
+		s.subscribe(c.Subscription, *c.Descriptor)
+	case OpCancel:
+		sub, ok := s.subs[c.Subscription]
+		if !ok {
+			s.writeError(c.Subscription, fmt.Errorf("subscription %q does not exist", c.Subscription))
+			return
+		}
+		sub.cancel()
+		delete(s.subs, c.Subscription)
+		s.writeAck(c.Subscription, &Ack{Op: OpCancel})
+	case OpResume:
+		s.writeError(c.Subscription, errors.New("resume must be the first message of a connection"))
+	}
+}
+
+// update applies a modified descriptor to a running subscription in place.
+// historical metrics are only filled when a subscription is first opened.
+func (s *wsSession) update(name string, sub *subscription, u Updater, cd ChartsDescriptor) {
+	charts, err := resolve(s.ctx, s.v, s.cs, cd)
+	if err != nil {
+		log.Printf("id %s: subscription %q: %v", s.id, name, err)
+		s.writeError(name, err)
+		return
+	}
+
+	diff, err := u.Update(charts, cd)
+	if err != nil {
+		log.Printf("id %s: subscription %q: failed to update stream: %v", s.id, name, err)
+		s.writeError(name, err)
+		return
+	}
+	sub.cd = cd
+	s.writeAck(name, &Ack{Op: OpModify, Diff: diff})
+}
+
+// subscribe opens a stream for the descriptor and delivers it to the client tagged with name.
+// an existing stream for name is stopped once the new stream is opened.
+func (s *wsSession) subscribe(name string, cd ChartsDescriptor) {
+	charts, err := resolve(s.ctx, s.v, s.cs, cd)
+	if err != nil {
+		log.Printf("id %s: subscription %q: %v", s.id, name, err)
+		s.writeError(name, err)
+		return
+	}
+	s.open(name, cd, charts)
+}
+
+// subscribeCharts opens a subscription for charts the descriptor was already resolved to
+func (s *wsSession) subscribeCharts(name string, cd ChartsDescriptor, charts []*Chart) {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	s.open(name, cd, charts)
+}
+
+// open streams the resolved charts of a descriptor to the client tagged with name. callers must hold smu.
+func (s *wsSession) open(name string, cd ChartsDescriptor, charts []*Chart) {
+	id := fmt.Sprintf("%s.%s.%v", s.id, name, cd.Names)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	st := s.sf.NewStreamer(ctx, id, charts, cd)
+	op := OpSubscribe
+	if prev, ok := s.subs[name]; ok {
+		prev.cancel()
+		op = OpModify
+	}
+	sub := &subscription{
+		st:     st,
+		cd:     cd,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	s.subs[name] = sub
+	s.writeAck(name, &Ack{Op: op})
+
+	go func() {
+		defer st.Close()
+
+		// deliver historical metrics before live metrics if requested
+		if !time.Time(cd.Fill).IsZero() {
+			s.fill(name, sub, cd)
+		}
+
+		err := stream(ctx, id, &wsWriter{s: s, name: name, sub: sub, live: true}, st)
+		if eos, ok := err.(*EndOfStream); ok && eos.Reason != EndCancelled {
+			s.remove(name, sub)
+		}
+	}()
+}
+
+// remove forgets a subscription whose stream ended on its own unless it was already replaced
+func (s *wsSession) remove(name string, sub *subscription) {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	if s.subs[name] == sub {
+		sub.cancel()
+		delete(s.subs, name)
+	}
+}
+
+// fill backfills a subscription from the descriptor's fill timestamp
+func (s *wsSession) fill(name string, sub *subscription, cd ChartsDescriptor) {
+	err := fill(sub.ctx, &wsWriter{s: s, name: name, sub: sub}, sub.st, cd)
+	if err != nil && sub.ctx.Err() == nil {
+		log.Printf("id %s: subscription %q: failed to backfill metrics: %v", s.id, name, err)
+		s.writeError(name, err)
+	}
+}
+
+// write sequences a message, retains it for replay and delivers it if a websocket is attached.
+// reports whether the message was written to a websocket.
+func (s *wsSession) write(msg *Message) bool {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.seq++
+	msg.Seq = s.seq
+	s.replay.push(msg)
+
+	if s.conn == nil {
+		return false
+	}
+	if err := s.send(msg); err != nil {
+		log.Printf("id %s: failed to write message %d to websocket: %v", s.id, msg.Seq, err)
+		return false
+	}
+	return true
+}
+
+// send writes a message to the attached connection within the write timeout. every subscription
+// writes through the session, so a connection whose write fails or times out is closed and
+// detached rather than stalling them. the session may then be resumed within the linger period.
+// callers must hold wmu and a connection must be attached.
+func (s *wsSession) send(msg *Message) error {
+	if d, ok := s.conn.(deadliner); ok {
+		d.SetWriteDeadline(time.Now().Add(s.sessions.writeTimeout))
+	}
+	err := s.conn.WriteJSON(msg)
+	if err != nil {
+		s.conn.Close()
+		s.release()
+	}
+	return err
+}
+
+// writeSession delivers the unsequenced session message, reporting whether it was written.
+// callers must hold wmu.
+func (s *wsSession) writeSession(resumed bool, replayed bool) bool {
+	msg := &Message{
+		Type: MessageSession,
+		Session: &Session{
+			ID:       s.id,
+			Seq:      s.seq,
+			Resumed:  resumed,
+			Replayed: replayed,
+		},
+	}
+	if err := s.send(msg); err != nil {
+		log.Printf("id %s: failed to write session to websocket: %v", s.id, err)
+		return false
+	}
+	return true
+}
+
+func (s *wsSession) writeError(name string, err error) {
+	qe, _ := err.(*QueryError)
+	s.write(&Message{
+		Type:         MessageError,
+		Subscription: name,
+		Error:        err.Error(),
+		QueryError:   qe,
+	})
+}
+
+func (s *wsSession) writeAck(name string, ack *Ack) {
+	s.write(&Message{
+		Type:         MessageAck,
+		Subscription: name,
+		Ack:          ack,
+	})
+}
+
+// wsWriter writes a single subscription's stream to the session
+type wsWriter struct {
+	s    *wsSession
+	name string
+	sub  *subscription
+	// whether the writer delivers the live stream rather than a backfill
+	live bool
+}
+
+// write writes a message of the subscription to the session. live messages wait for a
+// running backfill
+func (w *wsWriter) write(msg *Message) bool {
+	if w.live {
+		w.sub.live.Lock()
+		defer w.sub.live.Unlock()
+	}
+	return w.s.write(msg)
+}
+
+func (w *wsWriter) WriteMetric(m *Metric) error {
+	delivered := w.write(&Message{
+		Type:         MessageMetric,
+		Subscription: w.name,
+		Metric:       m,
+	})
+	if delivered {
+		w.delivered(m.TimeStamp)
+	}
+	return nil
+}
+
+func (w *wsWriter) WriteBackfill(bf *Backfill) error {
+	delivered := w.write(&Message{
+		Type:         MessageBackfill,
+		Subscription: w.name,
+		Backfill:     bf,
+	})
+	if delivered {
+		w.delivered(bf.End)
+	}
+	return nil
+}
+
+func (w *wsWriter) WriteDropped(total uint64) error {
+	w.write(&Message{
+		Type:         MessageDropped,
+		Subscription: w.name,
+		Dropped:      total,
+	})
+	return nil
+}
+
+func (w *wsWriter) WriteQueryError(qe *QueryError) error {
+	w.write(&Message{
+		Type:         MessageError,
+		Subscription: w.name,
+		Error:        qe.Error(),
+		QueryError:   qe,
+	})
+	return nil
+}
+
+func (w *wsWriter) WriteEnd(eos *EndOfStream) error {
+	w.write(&Message{
+		Type:         MessageEnd,
+		Subscription: w.name,
+		End:          eos,
+	})
+	return nil
+}
+
+func (w *wsWriter) WriteIntervals(intervals map[string]Duration) error {
+	w.write(&Message{
+		Type:         MessageIntervals,
+		Subscription: w.name,
+		Intervals:    intervals,
+	})
+	return nil
+}
+
+func (w *wsWriter) WriteSeries(se *SeriesEvent) error {
+	w.write(&Message{
+		Type:         MessageSeries,
+		Subscription: w.name,
+		Series:       se,
+	})
+	return nil
+}
+
+func (w *wsWriter) WriteAlert(a *Alert) error {
+	w.write(&Message{
+		Type:         MessageAlert,
+		Subscription: w.name,
+		Alert:        a,
+	})
+	return nil
+}
+
+// delivered records the latest timestamp written to a websocket for the subscription
+func (w *wsWriter) delivered(ts int64) {
+	if ts > atomic.LoadInt64(&w.sub.last) {
+		atomic.StoreInt64(&w.sub.last, ts)
+	}
+}
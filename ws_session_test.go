@@ -0,0 +1,413 @@
+package graphx
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// fakeChartStore returns a chart for every requested name, or err when set
+type fakeChartStore struct {
+	err error
+	// counts calls to GetByNames when set
+	lookups *int32
+}
+
+func (fakeChartStore) Get() ([]*Chart, error) { return nil, nil }
+
+func (cs fakeChartStore) GetByNames(names []string) ([]*Chart, error) {
+	if cs.lookups != nil {
+		atomic.AddInt32(cs.lookups, 1)
+	}
+	if cs.err != nil {
+		return nil, cs.err
+	}
+	charts := make([]*Chart, 0, len(names))
+	for _, name := range names {
+		charts = append(charts, &Chart{Name: name})
+	}
+	return charts, nil
+}
+
+func (fakeChartStore) Store([]*Chart) error { return nil }
+
+func (fakeChartStore) RemoveByNames([]string) error { return nil }
+
+// fakeStreamer delivers the metrics sent on metrics and the errors sent on errs. Fill reports the time it was asked to fill
+// from on fills and returns a single point at that time once release is closed
+type fakeStreamer struct {
+	ctx     context.Context
+	metrics chan *Metric
+	errs    chan error
+	fills   chan time.Time
+	release chan struct{}
+}
+
+func (st *fakeStreamer) Fill(ctx context.Context, from time.Time) ([]*Series, error) {
+	st.fills <- from
+	<-st.release
+	return []*Series{{Name: "web_1", Chart: "cpu", TimeStamps: []int64{from.Unix()}, Values: []string{"1"}}}, nil
+}
+
+func (st *fakeStreamer) Recv() (*Metric, error) {
+	select {
+	case m := <-st.metrics:
+		return m, nil
+	case err := <-st.errs:
+		return nil, err
+	case <-st.ctx.Done():
+		return nil, &EndOfStream{Reason: EndCancelled, Err: st.ctx.Err()}
+	}
+}
+
+func (st *fakeStreamer) Close() error { return nil }
+
+// fakeStreamerFactory hands out st when set, or else a new fakeStreamer for every stream
+type fakeStreamerFactory struct {
+	st     *fakeStreamer
+	mu     sync.Mutex
+	opened []*fakeStreamer
+}
+
+func (sf *fakeStreamerFactory) NewStreamer(ctx context.Context, id string, charts []*Chart, cd ChartsDescriptor) Streamer {
+	st := sf.st
+	if st == nil {
+		st = &fakeStreamer{metrics: make(chan *Metric)}
+	}
+	st.ctx = ctx
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.opened = append(sf.opened, st)
+	return st
+}
+
+// streamer returns the i'th streamer opened
+func (sf *fakeStreamerFactory) streamer(i int) *fakeStreamer {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.opened[i]
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) *Message {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	return &msg
+}
+
+// waitSession waits until cond holds for the session while holding its write lock
+func waitSession(t *testing.T, s *wsSession, cond func(s *wsSession) bool) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.wmu.Lock()
+		ok := cond(s)
+		s.wmu.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session did not reach the expected state")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func subscribeControl(name string) *Control {
+	return &Control{
+		Op:           OpSubscribe,
+		Subscription: name,
+		Descriptor: &ChartsDescriptor{
+			ChartNames:   []string{"cpu"},
+			Names:        []string{"web_1"},
+			PollInterval: Duration(time.Second),
+		},
+	}
+}
+
+func TestStreamHandlerMultiplexes(t *testing.T) {
+	sf := &fakeStreamerFactory{}
+	sessions, err := NewSessions(time.Minute, DefaultReplaySize)
+	if err != nil {
+		t.Fatalf("failed to create sessions: %v", err)
+	}
+	srv := httptest.NewServer(StreamHandler(validator.New(), fakeChartStore{}, sf, websocket.Upgrader{}, sessions))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	for _, name := range []string{"a", "b"} {
+		if err := conn.WriteJSON(subscribeControl(name)); err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+	}
+	if msg := readMessage(t, conn); msg.Type != MessageSession {
+		t.Fatalf("expected the session got %+v", msg)
+	}
+	for _, name := range []string{"a", "b"} {
+		if msg := readMessage(t, conn); msg.Type != MessageAck || msg.Subscription != name || msg.Ack.Op != OpSubscribe {
+			t.Fatalf("expected %s to be acknowledged got %+v", name, msg)
+		}
+	}
+
+	// metrics are tagged with the subscription they were streamed for
+	for i, name := range []string{"a", "b"} {
+		sf.streamer(i).metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: int64(100 + i), Value: "1"}
+		if msg := readMessage(t, conn); msg.Type != MessageMetric || msg.Subscription != name {
+			t.Fatalf("expected a metric of %s got %+v", name, msg)
+		}
+	}
+
+	if err := conn.WriteJSON(subscribeControl("a")); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if msg := readMessage(t, conn); msg.Type != MessageError || msg.Subscription != "a" {
+		t.Fatalf("expected a duplicate subscription to be rejected got %+v", msg)
+	}
+
+	// cancelling a subscription leaves the others streaming
+	if err := conn.WriteJSON(&Control{Op: OpCancel, Subscription: "a"}); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if msg := readMessage(t, conn); msg.Type != MessageAck || msg.Subscription != "a" || msg.Ack.Op != OpCancel {
+		t.Fatalf("expected the cancel to be acknowledged got %+v", msg)
+	}
+	select {
+	case <-sf.streamer(0).ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("expected the cancelled stream to be stopped")
+	}
+	sf.streamer(1).metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: 102, Value: "1"}
+	if msg := readMessage(t, conn); msg.Type != MessageMetric || msg.Subscription != "b" {
+		t.Fatalf("expected a metric of b got %+v", msg)
+	}
+}
+
+func TestStreamHandlerQueryErrors(t *testing.T) {
+	st := &fakeStreamer{metrics: make(chan *Metric), errs: make(chan error)}
+	sessions, err := NewSessions(time.Minute, DefaultReplaySize)
+	if err != nil {
+		t.Fatalf("failed to create sessions: %v", err)
+	}
+	srv := httptest.NewServer(StreamHandler(validator.New(), fakeChartStore{}, &fakeStreamerFactory{st: st}, websocket.Upgrader{}, sessions))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(subscribeControl("a")); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	readMessage(t, conn)
+	readMessage(t, conn)
+
+	cm := ChartMetric{Name: "usage", Chart: "cpu", Query: "rate(cpu[1m])", Datasource: "prometheus"}
+	st.errs <- NewQueryError(QueryErrorTimeout, cm, errors.New("deadline exceeded"))
+	msg := readMessage(t, conn)
+	if msg.Type != MessageError || msg.Subscription != "a" || msg.QueryError == nil {
+		t.Fatalf("expected a query error of a got %+v", msg)
+	}
+	if qe := msg.QueryError; qe.Kind != QueryErrorTimeout || qe.Chart != "cpu" || qe.Metric != "usage" {
+		t.Fatalf("expected the failing chart metric to be identified got %+v", qe)
+	}
+
+	// other errors are not delivered and the stream continues
+	st.errs <- errors.New("transient")
+	st.metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: 100, Value: "1"}
+	if msg := readMessage(t, conn); msg.Type != MessageMetric {
+		t.Fatalf("expected the stream to continue got %+v", msg)
+	}
+}
+
+func TestResumeBackfillsBeforeLive(t *testing.T) {
+	st := &fakeStreamer{
+		metrics: make(chan *Metric),
+		fills:   make(chan time.Time, 1),
+		release: make(chan struct{}),
+	}
+	// without replay every resumed session is backfilled
+	sessions, err := NewSessions(time.Minute, 0)
+	if err != nil {
+		t.Fatalf("failed to create sessions: %v", err)
+	}
+	srv := httptest.NewServer(StreamHandler(validator.New(), fakeChartStore{}, &fakeStreamerFactory{st: st}, websocket.Upgrader{}, sessions))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	err = conn.WriteJSON(&Control{
+		Op:           OpSubscribe,
+		Subscription: "a",
+		Descriptor: &ChartsDescriptor{
+			ChartNames:   []string{"cpu"},
+			Names:        []string{"web_1"},
+			PollInterval: Duration(time.Second),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	id := readMessage(t, conn).Session.ID
+	if msg := readMessage(t, conn); msg.Type != MessageAck {
+		t.Fatalf("expected an ack got %+v", msg)
+	}
+	st.metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: 100, Value: "1"}
+	last := readMessage(t, conn)
+	if last.Metric == nil || last.Metric.TimeStamp != 100 {
+		t.Fatalf("expected the live metric got %+v", last)
+	}
+
+	// the metric streamed while detached is missed
+	conn.Close()
+	s := sessions.get(id)
+	waitSession(t, s, func(s *wsSession) bool { return s.conn == nil })
+	st.metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: 101, Value: "1"}
+	waitSession(t, s, func(s *wsSession) bool { return s.seq > last.Seq })
+
+	conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(&Control{Op: OpResume, Session: id, LastSeq: last.Seq}); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+	msg := readMessage(t, conn)
+	if msg.Session == nil || !msg.Session.Resumed || msg.Session.Replayed {
+		t.Fatalf("expected a resumed session without replay got %+v", msg)
+	}
+
+	select {
+	case from := <-st.fills:
+		if from.Unix() != 101 {
+			t.Fatalf("expected a backfill from 101 got %d", from.Unix())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the subscription to be backfilled")
+	}
+	// a live metric arriving during the backfill is held back until it completes
+	st.metrics <- &Metric{Name: "web_1", Chart: "cpu", TimeStamp: 102, Value: "1"}
+	time.Sleep(20 * time.Millisecond)
+	close(st.release)
+
+	for _, ts := range []int64{101, 102} {
+		msg := readMessage(t, conn)
+		if msg.Metric == nil || msg.Metric.TimeStamp != ts {
+			t.Fatalf("expected metric at %d got %+v", ts, msg)
+		}
+	}
+}
+
+// nopConn discards the messages of a session
+type nopConn struct{}
+
+func (nopConn) WriteJSON(v interface{}) error { return nil }
+
+func (nopConn) Close() error { return nil }
+
+func TestResumeExpiredSession(t *testing.T) {
+	sessions, err := NewSessions(time.Minute, DefaultReplaySize)
+	if err != nil {
+		t.Fatalf("failed to create sessions: %v", err)
+	}
+	s := newWSSession("a", validator.New(), fakeChartStore{}, &fakeStreamerFactory{}, sessions)
+	s.attach(nopConn{})
+	s.detach(nopConn{})
+
+	// the session was looked up just before it expired
+	s.expire()
+	if s.resume(nopConn{}, 0) {
+		t.Fatalf("expected an expired session to not be resumed")
+	}
+	if sessions.get("a") != nil || s.ctx.Err() == nil {
+		t.Fatalf("expected the expired session to be closed")
+	}
+}
+
+// stalledConn is a client which stops reading once stalled, its writes wait for the write deadline
+type stalledConn struct {
+	mu       sync.Mutex
+	stalled  bool
+	deadline time.Time
+	closed   bool
+}
+
+func (c *stalledConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.stalled {
+		return nil
+	}
+	time.Sleep(time.Until(c.deadline))
+	return errors.New("i/o timeout")
+}
+
+func (c *stalledConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *stalledConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return nil
+}
+
+func TestStalledConnDetached(t *testing.T) {
+	sessions, err := NewSessions(time.Minute, DefaultReplaySize)
+	if err != nil {
+		t.Fatalf("failed to create sessions: %v", err)
+	}
+	sessions.writeTimeout = 20 * time.Millisecond
+	s := newWSSession("a", validator.New(), fakeChartStore{}, &fakeStreamerFactory{}, sessions)
+	conn := &stalledConn{}
+	s.attach(conn)
+	conn.mu.Lock()
+	conn.stalled = true
+	conn.mu.Unlock()
+
+	// the stalled write times out and the connection is closed and detached
+	start := time.Now()
+	if s.write(&Message{Type: MessageMetric}) {
+		t.Fatalf("expected the write to the stalled client to fail")
+	}
+	if s.write(&Message{Type: MessageMetric}) {
+		t.Fatalf("expected the detached session to not write")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected writes to be bounded by the write timeout took %v", d)
+	}
+	conn.mu.Lock()
+	closed := conn.closed
+	conn.mu.Unlock()
+	if !closed {
+		t.Fatalf("expected the stalled connection to be closed")
+	}
+
+	// the session lingers to be resumed
+	if !s.resume(nopConn{}, 0) {
+		t.Fatalf("expected the session to be resumed")
+	}
+}